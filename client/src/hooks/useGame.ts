@@ -46,8 +46,10 @@ export function useGame() {
     
     submitGuessMutation.mutate({
       sessionId: store.sessionId,
+      roundNumber: store.currentRound,
       airportIata,
       confidence,
+      idempotencyKey: crypto.randomUUID(),
     })
   }
 
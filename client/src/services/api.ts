@@ -4,6 +4,7 @@ import type {
   GuessRequest,
   GuessResponse,
   EndGameResponse,
+  GameStateResponse,
   FlightsResponse,
   LeaderboardResponse,
   Difficulty,
@@ -61,6 +62,10 @@ export const api = {
     })
   },
 
+  async getGame(sessionId: string): Promise<GameStateResponse> {
+    return fetchJson<GameStateResponse>(`${API_BASE}/game/${encodeURIComponent(sessionId)}`)
+  },
+
   async endGame(sessionId: string): Promise<EndGameResponse> {
     return fetchJson<EndGameResponse>(`${API_BASE}/game/end`, {
       method: 'POST',
@@ -107,8 +107,10 @@ export interface StartGameResponse {
 
 export interface GuessRequest {
   sessionId: string
+  roundNumber: number
   airportIata: string
   confidence?: number
+  idempotencyKey?: string
 }
 
 export interface GuessResponse {
@@ -124,9 +126,34 @@ export interface EndGameResponse {
   totalScore: number
   rounds: Round[]
   rank: number
+  percentile: number
+  recorded: boolean
   difficulty: Difficulty
 }
 
+export interface CompletedRound {
+  roundNumber: number
+  playerGuess: string
+  actualArrival: string
+  pointsEarned: number
+  guessTime: number
+  score?: ScoreResult
+}
+
+export interface GameStateResponse {
+  sessionId: string
+  username: string
+  difficulty: Difficulty
+  status: 'in_progress' | 'completed' | 'abandoned'
+  totalRounds: number
+  currentRound?: number
+  flight?: Flight
+  roundStartedAt?: string
+  deadline?: string
+  completedRounds: CompletedRound[]
+  totalScore: number
+}
+
 export interface FlightsResponse {
   flights: Flight[]
   count: number
@@ -161,6 +188,10 @@ export interface WSGuessResult {
   totalScore: number
 }
 
+export interface WSGameState {
+  state: GameStateResponse
+}
+
 export interface WSGameEnd {
   sessionId: string
   totalScore: number
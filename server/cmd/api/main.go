@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"expvar"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -14,6 +17,7 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/skyquest/server/internal/config"
 	"github.com/skyquest/server/internal/handlers"
+	"github.com/skyquest/server/internal/models"
 	"github.com/skyquest/server/internal/repository"
 	"github.com/skyquest/server/internal/services"
 	"github.com/skyquest/server/internal/websocket"
@@ -29,15 +33,25 @@ func main() {
 	// Load configuration
 	cfg := config.Load()
 
-	// Initialize MongoDB
-	mongoRepo, err := repository.NewMongoRepository(cfg.MongoURI, cfg.MongoDB)
+	// Initialize storage
+	store, err := openStore(cfg)
 	if err != nil {
-		log.Printf("Warning: Failed to connect to MongoDB: %v", err)
-		log.Println("Game sessions and leaderboard will not be persisted.")
-		log.Println("Start MongoDB with: docker-compose up -d")
+		log.Fatalf("Failed to open %s storage: %v", cfg.StorageBackend, err)
 	}
-	if mongoRepo != nil {
-		defer mongoRepo.Close()
+	defer store.Close()
+
+	// "api migrate" applies pending schema migrations and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrateStore(store); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		log.Println("Migrations complete")
+		return
+	}
+	if cfg.AutoMigrate {
+		if err := migrateStore(store); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
 	}
 
 	// Initialize Redis
@@ -53,25 +67,133 @@ func main() {
 	aviationClient := aviation.NewClient(cfg.AviationStackAPIKey)
 
 	// Initialize services
-	flightService := services.NewFlightService(aviationClient, redisClient)
-	var gameService *services.GameService
-	var scoreService *services.ScoreService
-	if mongoRepo != nil {
-		gameService = services.NewGameService(mongoRepo, flightService)
-		scoreService = services.NewScoreService(mongoRepo)
-	} else {
-		// Create services with nil repo (limited functionality)
-		gameService = services.NewGameService(nil, flightService)
-		scoreService = services.NewScoreService(nil)
+	routeStats := services.NewRouteStats()
+	flightService := services.NewFlightService(aviationClient, redisClient, routeStats)
+	completionPolicy := services.CompletionPolicy{
+		MinRoundsPlayed: cfg.MinRoundsForLeaderboard,
+		RecordAbandoned: cfg.AbandonedScorePolicy == "partial",
+	}
+	progressionPolicy := services.ProgressionPolicy{UnlockLevels: make(map[models.Difficulty]int)}
+	for difficulty, level := range cfg.DifficultyUnlockLevels {
+		progressionPolicy.UnlockLevels[models.Difficulty(difficulty)] = level
+	}
+	selectionPolicy := services.SelectionPolicy{
+		MaxPerCity:    cfg.SelectionMaxPerCity,
+		MaxPerAirline: cfg.SelectionMaxPerAirline,
+		MinSpreadKm:   float64(cfg.SelectionMinSpreadKm),
+		RecentGames:   cfg.SelectionRecentGames,
+	}
+	var leaderboardStore repository.LeaderboardStore = store
+	if redisClient != nil {
+		// Rank with Redis sorted sets, rebuilt from the storage backend
+		redisLeaderboard := repository.NewRedisLeaderboardStore(store, redisClient)
+		rebuildCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if err := redisLeaderboard.Rebuild(rebuildCtx); err != nil {
+			log.Printf("Warning: Failed to build leaderboard index: %v", err)
+		}
+		cancel()
+		leaderboardStore = redisLeaderboard
+	}
+	scoreService := services.NewScoreService(leaderboardStore, store)
+	userService := services.NewUserService(store, leaderboardStore, store, flightService)
+	var sessionStore repository.SessionStore = store
+	if redisClient != nil {
+		// Serve in-progress games from Redis, writing through to durable storage
+		sessionStore = repository.NewCachedSessionStore(store, redisClient, cfg.SessionTTL)
 	}
+	statsService := services.NewStatsService(store, store, store, flightService)
+	ratingService := services.NewRatingService(store, store, store, routeStats)
 
 	// Initialize WebSocket hub
 	wsHub := websocket.NewHub()
+
+	achievements, err := services.LoadAchievements(cfg.AchievementsDir)
+	if err != nil {
+		log.Fatalf("Failed to load achievements: %v", err)
+	}
+	achievementService := services.NewAchievementService(achievements, store, store, flightService, wsHub)
+	spectators := services.NewSpectators(wsHub, cfg.SpectatorDelay)
+	gameService := services.NewGameService(sessionStore, store, flightService, scoreService, statsService, ratingService, achievementService, spectators, cfg.SessionTTL, completionPolicy, progressionPolicy, selectionPolicy)
+	roomService := services.NewRoomService(gameService, wsHub, services.RoomPolicy{
+		MaxPlayers:     cfg.RoomMaxPlayers,
+		RoundDuration:  cfg.RoomRoundDuration,
+		RevealDuration: cfg.RoomRevealDuration,
+		LobbyTTL:       cfg.RoomLobbyTTL,
+	})
+	challengeService := services.NewChallengeService(store, sessionStore, gameService, flightService, cfg.ChallengeTTL)
+	tournamentService := services.NewTournamentService(store, store, sessionStore, gameService, flightService, services.SystemClock)
+
+	// "api backfill-stats" recomputes players' stats from their stored games and exits
+	if len(os.Args) > 1 && os.Args[1] == "backfill-stats" {
+		players, err := statsService.Backfill(context.Background())
+		if err != nil {
+			log.Fatalf("Stats backfill failed: %v", err)
+		}
+		log.Printf("Stats backfill complete: %d players updated", players)
+		return
+	}
+
+	// "api recompute-ratings" rates every stored game again, in the order they ended, and exits
+	if len(os.Args) > 1 && os.Args[1] == "recompute-ratings" {
+		players, err := ratingService.Recompute(context.Background())
+		if err != nil {
+			log.Fatalf("Rating recompute failed: %v", err)
+		}
+		log.Printf("Rating recompute complete: %d players updated", players)
+		return
+	}
+
+	// Estimate how hard routes are from past games, for ratings and drawing flights
+	if err := routeStats.Load(context.Background(), store); err != nil {
+		log.Printf("Warning: Failed to load route difficulty: %v", err)
+	}
+
+	// Keep the flights of tournaments still being played out of the public feed
+	if err := tournamentService.Load(context.Background()); err != nil {
+		log.Printf("Warning: Failed to load tournaments: %v", err)
+	}
+	// Likewise the flights of challenges still open
+	if err := challengeService.Load(context.Background()); err != nil {
+		log.Printf("Warning: Failed to load challenges: %v", err)
+	}
+
+	authService := services.NewAuthService(store, jwtSecret(cfg), cfg.AuthTokenTTL)
+	ssoService := services.NewSSOService(authService, store, identityProviders(cfg))
+
+	// Clients registering for a session get its state, if they may play it
+	wsHub.OnRegister(func(sessionID, token string) (*models.GameStateResponse, error) {
+		var userID string
+		if token != "" {
+			claims, err := authService.ParseToken(token)
+			if err != nil {
+				return nil, err
+			}
+			userID = claims.Subject
+		}
+		return gameService.GetPlayerGameState(context.Background(), sessionID, userID)
+	})
+	// Multiplayer rooms are played over the WebSocket
+	wsHub.OnRoomMessage(roomService.HandleMessage, roomService.HandleLeave)
+	wsHub.OnSpectate(roomService.HandleSpectate)
 	go wsHub.Run()
 
+	// Relay rooms and featured games to spectators in background
+	go spectators.Start()
+
+	// Evaluate achievements in background
+	go achievementService.Start()
+
 	// Start flight data polling in background
 	go flightService.StartPolling(wsHub, 5*time.Minute)
 
+	// Expire idle game sessions in background
+	lifecycleManager := services.NewLifecycleManager(gameService, wsHub, cfg.MemorySessionRetention)
+	go lifecycleManager.Start(cfg.SessionSweepInterval)
+
+	// Archive the winners of ended leaderboard periods in background
+	leaderboardArchiver := services.NewLeaderboardArchiver(scoreService, cfg.LeaderboardArchiveWinners)
+	go leaderboardArchiver.Start(cfg.LeaderboardArchiveInterval)
+
 	// Initialize Gin router
 	router := gin.Default()
 
@@ -90,14 +212,30 @@ func main() {
 	}))
 
 	// Initialize handlers
-	gameHandler := handlers.NewGameHandler(gameService, scoreService)
+	gameHandler := handlers.NewGameHandler(gameService)
 	flightHandler := handlers.NewFlightHandler(flightService)
 	leaderboardHandler := handlers.NewLeaderboardHandler(scoreService)
+	ratingHandler := handlers.NewRatingHandler(ratingService)
+	roomHandler := handlers.NewRoomHandler(roomService)
+	tournamentHandler := handlers.NewTournamentHandler(tournamentService)
+	challengeHandler := handlers.NewChallengeHandler(challengeService)
+	adminHandler := handlers.NewAdminHandler(routeStats)
+	userHandler := handlers.NewUserHandler(userService, statsService)
+	achievementHandler := handlers.NewAchievementHandler(achievementService)
+	authHandler := handlers.NewAuthHandler(authService)
+	ssoHandler := handlers.NewSSOHandler(ssoService, cfg.AuthRedirectURL)
 	wsHandler := handlers.NewWebSocketHandler(wsHub)
 
 	// API routes
-	api := router.Group("/api")
+	api := router.Group("/api", handlers.Authenticate(authService))
 	{
+		// Account endpoints
+		api.POST("/auth/register", authHandler.Register)
+		api.POST("/auth/login", authHandler.Login)
+		api.GET("/auth/providers", ssoHandler.GetProviders)
+		api.GET("/auth/sso/:provider/login", ssoHandler.Login)
+		api.GET("/auth/sso/:provider/callback", ssoHandler.Callback)
+
 		// Flight endpoints
 		api.GET("/flights", flightHandler.GetFlights)
 
@@ -105,14 +243,70 @@ func main() {
 		api.POST("/game/start", gameHandler.StartGame)
 		api.POST("/game/guess", gameHandler.SubmitGuess)
 		api.POST("/game/end", gameHandler.EndGame)
+		api.GET("/game/:sessionId", gameHandler.GetGame)
+		api.GET("/games/:sessionId/replay", gameHandler.GetReplay)
+
+		// Multiplayer room endpoints; rounds are played over the WebSocket
+		api.POST("/rooms", roomHandler.CreateRoom)
+		api.POST("/rooms/:code/join", roomHandler.JoinRoom)
+		api.GET("/rooms/:code", roomHandler.GetRoom)
+
+		// Spectator endpoints; games are watched over the WebSocket
+		api.GET("/spectate/games", gameHandler.GetFeaturedGames)
+
+		// Tournament endpoints
+		api.GET("/tournaments", tournamentHandler.ListTournaments)
+		api.GET("/tournaments/:id", tournamentHandler.GetTournament)
+		api.GET("/tournaments/:id/standings", tournamentHandler.GetStandings)
+		api.GET("/tournaments/:id/export", tournamentHandler.ExportResults)
+		api.POST("/tournaments", handlers.RequireUser(), tournamentHandler.CreateTournament)
+		api.POST("/tournaments/:id/register", handlers.RequireUser(), tournamentHandler.Register)
+		api.POST("/tournaments/:id/checkin", handlers.RequireUser(), tournamentHandler.CheckIn)
+		api.POST("/tournaments/:id/play", handlers.RequireUser(), tournamentHandler.Play)
+
+		// Challenge endpoints
+		api.POST("/challenges", handlers.RequireUser(), challengeHandler.CreateChallenge)
+		api.GET("/challenges/:id", challengeHandler.GetChallenge)
+		api.POST("/challenges/:id/accept", challengeHandler.AcceptChallenge)
+		api.GET("/challenges/:id/diff/:number", challengeHandler.GetDiff)
+
+		// Achievement endpoints
+		api.GET("/achievements", achievementHandler.GetAchievements)
 
 		// Leaderboard endpoints
 		api.GET("/leaderboard", leaderboardHandler.GetLeaderboard)
+		api.GET("/leaderboard/me", leaderboardHandler.GetMe)
+		api.GET("/leaderboard/around", leaderboardHandler.GetAround)
+		api.GET("/leaderboard/archive", leaderboardHandler.GetArchive)
+		api.GET("/leaderboard/countries", leaderboardHandler.GetCountries)
+		api.GET("/leaderboard/ratings", ratingHandler.GetRatingBoard)
+
+		// User endpoints. Gin needs one name for the wildcard: profiles and
+		// homes are addressed by username, game histories by user ID.
+		api.GET("/users/:user/profile", userHandler.GetProfile)
+		api.GET("/users/:user/games", gameHandler.GetUserGames)
+		api.GET("/users/:user/achievements", achievementHandler.GetPlayerAchievements)
+		api.PUT("/users/:user/home", userHandler.SetHome)
+		me := api.Group("/users/me", handlers.RequireUser())
+		me.GET("", authHandler.Me)
+		me.GET("/sessions", gameHandler.GetUserSessions)
+		me.POST("/claim", gameHandler.ClaimSessions)
+		me.POST("/identities/:provider", ssoHandler.LinkIdentity)
+
+		// Admin endpoints
+		admin := api.Group("/admin", handlers.RequireAdmin(authService, cfg.AdminUsers))
+		admin.GET("/routes", adminHandler.GetRoutes)
+		admin.POST("/featured", gameHandler.FeatureGame)
+		admin.DELETE("/featured/:sessionId", gameHandler.UnfeatureGame)
 	}
 
 	// WebSocket endpoint
 	router.GET("/ws", wsHandler.HandleWebSocket)
 
+	// Metrics (expvar), for admins only
+	router.GET("/debug/vars", handlers.Authenticate(authService), handlers.RequireAdmin(authService, cfg.AdminUsers),
+		gin.WrapH(expvar.Handler()))
+
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
@@ -149,3 +343,94 @@ func main() {
 
 	log.Println("Server exited")
 }
+
+// openStore opens the configured storage backend. MongoDB falls back to
+// in-memory storage when it can't be reached.
+func openStore(cfg *config.Config) (repository.Store, error) {
+	switch cfg.StorageBackend {
+	case "memory":
+		log.Println("Using in-memory storage. Game sessions and leaderboard will not be persisted.")
+		return repository.NewMemoryStore(), nil
+	case "sqlite":
+		sqlStore, err := repository.NewSQLiteStore(cfg.SQLitePath)
+		if err != nil {
+			return nil, err
+		}
+		return sqlStore, nil
+	case "postgres":
+		sqlStore, err := repository.NewPostgresStore(cfg.PostgresURL)
+		if err != nil {
+			return nil, err
+		}
+		return sqlStore, nil
+	case "mongo":
+		mongoRepo, err := repository.NewMongoRepository(cfg.MongoURI, cfg.MongoDB)
+		if err != nil {
+			log.Printf("Warning: Failed to connect to MongoDB: %v", err)
+			log.Println("Game sessions and leaderboard will not be persisted.")
+			log.Println("Start MongoDB with: docker-compose up -d")
+			return repository.NewMemoryStore(), nil
+		}
+		return mongoRepo, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (expected mongo, postgres, sqlite or memory)", cfg.StorageBackend)
+	}
+}
+
+// migrateStore applies pending schema migrations if the store has any
+func migrateStore(store repository.Store) error {
+	migrator, ok := store.(repository.Migrator)
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	return migrator.Migrate(ctx)
+}
+
+// jwtSecret returns the configured token signing key, or a random one that
+// logs everyone out when the server restarts
+func jwtSecret(cfg *config.Config) []byte {
+	if cfg.JWTSecret != "" {
+		return []byte(cfg.JWTSecret)
+	}
+	log.Println("Warning: JWT_SECRET is not set; using a random secret, so logins won't survive a restart")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("Failed to generate JWT secret: %v", err)
+	}
+	return secret
+}
+
+// identityProviders sets up the configured SSO providers. Providers that are
+// misconfigured or whose issuer can't be reached are left out.
+func identityProviders(cfg *config.Config) map[string]services.IdentityProvider {
+	providers := make(map[string]services.IdentityProvider)
+	for _, p := range cfg.IdentityProviders {
+		if p.ClientID == "" {
+			log.Printf("Warning: identity provider %s has no client ID; skipping it", p.Name)
+			continue
+		}
+		redirectURL := cfg.PublicURL + "/api/auth/sso/" + p.Name + "/callback"
+		switch p.Type {
+		case "github":
+			providers[p.Name] = services.NewGitHubProvider(p.Issuer, p.APIURL, p.ClientID, p.ClientSecret, redirectURL, p.Scopes)
+		case "oidc":
+			if p.Issuer == "" {
+				log.Printf("Warning: identity provider %s has no issuer; skipping it", p.Name)
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			provider, err := services.NewOIDCProvider(ctx, p.Issuer, p.ClientID, p.ClientSecret, redirectURL, p.Scopes)
+			cancel()
+			if err != nil {
+				log.Printf("Warning: identity provider %s is unavailable: %v", p.Name, err)
+				continue
+			}
+			providers[p.Name] = provider
+		default:
+			log.Printf("Warning: identity provider %s has unknown type %q (expected oidc or github); skipping it", p.Name, p.Type)
+		}
+	}
+	return providers
+}
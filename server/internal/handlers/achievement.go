@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skyquest/server/internal/services"
+)
+
+type AchievementHandler struct {
+	achievementService *services.AchievementService
+}
+
+func NewAchievementHandler(achievementService *services.AchievementService) *AchievementHandler {
+	return &AchievementHandler{
+		achievementService: achievementService,
+	}
+}
+
+// GetAchievements handles GET /api/achievements
+func (h *AchievementHandler) GetAchievements(c *gin.Context) {
+	achievements := h.achievementService.Achievements()
+	c.JSON(http.StatusOK, gin.H{
+		"achievements": achievements,
+		"count":        len(achievements),
+	})
+}
+
+// GetPlayerAchievements handles GET /api/users/:username/achievements
+func (h *AchievementHandler) GetPlayerAchievements(c *gin.Context) {
+	achievements, err := h.achievementService.GetPlayerAchievements(c.Request.Context(), c.Param("user"))
+	if errors.Is(err, services.ErrPlayerNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Player not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get achievements: " + err.Error()})
+		return
+	}
+
+	unlocked := 0
+	for _, achievement := range achievements {
+		if achievement.Unlocked {
+			unlocked++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"achievements": achievements,
+		"unlocked":     unlocked,
+	})
+}
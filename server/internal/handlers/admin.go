@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skyquest/server/internal/services"
+)
+
+type AdminHandler struct {
+	routeStats *services.RouteStats
+}
+
+func NewAdminHandler(routeStats *services.RouteStats) *AdminHandler {
+	return &AdminHandler{
+		routeStats: routeStats,
+	}
+}
+
+// GetRoutes handles GET /api/admin/routes
+func (h *AdminHandler) GetRoutes(c *gin.Context) {
+	order := c.DefaultQuery("order", "hardest")
+	if order != "hardest" && order != "easiest" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order. Must be: hardest or easiest"})
+		return
+	}
+
+	minRounds, err := strconv.Atoi(c.DefaultQuery("minRounds", "1"))
+	if err != nil || minRounds < 1 {
+		minRounds = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	if limit > 500 {
+		limit = 500
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	routes := h.routeStats.List(minRounds, order == "easiest", offset, limit)
+	c.JSON(http.StatusOK, gin.H{
+		"routes": routes,
+		"count":  len(routes),
+		"order":  order,
+	})
+}
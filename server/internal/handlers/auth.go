@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/services"
+)
+
+// userIDKey is the context key holding the ID of the logged-in player
+const userIDKey = "userID"
+
+type AuthHandler struct {
+	authService *services.AuthService
+}
+
+func NewAuthHandler(authService *services.AuthService) *AuthHandler {
+	return &AuthHandler{authService: authService}
+}
+
+// Authenticate identifies the player from an "Authorization: Bearer <token>"
+// header. Requests without one continue as guests; invalid tokens are rejected.
+func Authenticate(authService *services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			c.Next()
+			return
+		}
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header must be a Bearer token"})
+			return
+		}
+		claims, err := authService.ParseToken(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		c.Set(userIDKey, claims.Subject)
+		c.Next()
+	}
+}
+
+// RequireUser rejects requests from guests
+func RequireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if currentUserID(c) == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Login required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireAdmin rejects requests from anyone but the registered players named in admins
+func RequireAdmin(authService *services.AuthService, admins []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := currentUserID(c)
+		if userID == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Login required"})
+			return
+		}
+		user, err := authService.GetUser(c.Request.Context(), userID)
+		if err != nil || !user.Registered() || !slices.Contains(admins, user.Username) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// currentUserID returns the logged-in player's ID, or "" for guests
+func currentUserID(c *gin.Context) string {
+	return c.GetString(userIDKey)
+}
+
+// Register handles POST /api/auth/register
+func (h *AuthHandler) Register(c *gin.Context) {
+	var req models.RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	resp, err := h.authService.Register(c.Request.Context(), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidUsername), errors.Is(err, services.ErrInvalidPassword):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUsernameTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": "Username is already registered"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// Login handles POST /api/auth/login
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req models.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	resp, err := h.authService.Login(c.Request.Context(), req)
+	if errors.Is(err, services.ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Me handles GET /api/users/me
+func (h *AuthHandler) Me(c *gin.Context) {
+	user, err := h.authService.GetUser(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
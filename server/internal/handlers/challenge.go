@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/services"
+)
+
+type ChallengeHandler struct {
+	challengeService *services.ChallengeService
+}
+
+func NewChallengeHandler(challengeService *services.ChallengeService) *ChallengeHandler {
+	return &ChallengeHandler{
+		challengeService: challengeService,
+	}
+}
+
+// CreateChallenge handles POST /api/challenges
+func (h *ChallengeHandler) CreateChallenge(c *gin.Context) {
+	var req models.CreateChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	challenge, err := h.challengeService.CreateChallenge(c.Request.Context(), currentUserID(c), req.SessionID)
+	if err != nil {
+		challengeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, challenge)
+}
+
+// GetChallenge handles GET /api/challenges/:id
+func (h *ChallengeHandler) GetChallenge(c *gin.Context) {
+	challenge, err := h.challengeService.GetChallenge(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		challengeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, challenge)
+}
+
+// AcceptChallenge handles POST /api/challenges/:id/accept, starting the
+// player's game on the challenge's flights. The game is then played through
+// the /api/game endpoints.
+func (h *ChallengeHandler) AcceptChallenge(c *gin.Context) {
+	// Logged-in players needn't send a body
+	var req models.AcceptChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	game, err := h.challengeService.AcceptChallenge(c.Request.Context(), c.Param("id"), models.StartGameRequest{
+		Username: req.Username,
+		UserID:   currentUserID(c),
+	})
+	if err != nil {
+		challengeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, game)
+}
+
+// GetDiff handles GET /api/challenges/:id/diff/:number. Guests send their
+// game's session ID as the sessionId query parameter.
+func (h *ChallengeHandler) GetDiff(c *gin.Context) {
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid game number"})
+		return
+	}
+
+	diff, err := h.challengeService.GetDiff(c.Request.Context(), c.Param("id"), number, currentUserID(c), c.Query("sessionId"))
+	if err != nil {
+		challengeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// challengeError responds with the status for a challenge service error
+func challengeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrChallengeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Challenge not found"})
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Game session not found"})
+	case errors.Is(err, services.ErrAttemptNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotYourGame), errors.Is(err, services.ErrNotYourDiff):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUsernameRegistered):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Username belongs to a registered player. Log in to play as them."})
+	case errors.Is(err, services.ErrUsernameRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username is required"})
+	case errors.Is(err, services.ErrGameNotChallengeable), errors.Is(err, services.ErrOwnChallenge):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrGameInProgress):
+		c.JSON(http.StatusConflict, gin.H{"error": "Game is still in progress"})
+	case errors.Is(err, services.ErrChallengeTaken), errors.Is(err, services.ErrChallengeFull),
+		errors.Is(err, services.ErrChallengeExpired):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrConcurrentUpdate):
+		c.JSON(http.StatusConflict, gin.H{"error": "Challenge was updated concurrently, please retry"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Challenge request failed: " + err.Error()})
+	}
+}
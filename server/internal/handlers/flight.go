@@ -29,7 +29,7 @@ func (h *FlightHandler) GetFlights(c *gin.Context) {
 		req.Limit = 50
 	}
 
-	flights := h.flightService.GetFlights(req.Difficulty)
+	flights := h.flightService.GetPublicFlights(req.Difficulty)
 
 	// Limit results
 	if len(flights) > req.Limit {
@@ -50,4 +50,3 @@ func (h *FlightHandler) GetAirports(c *gin.Context) {
 		"count":    len(airports),
 	})
 }
-
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/skyquest/server/internal/models"
@@ -9,14 +11,12 @@ import (
 )
 
 type GameHandler struct {
-	gameService  *services.GameService
-	scoreService *services.ScoreService
+	gameService *services.GameService
 }
 
-func NewGameHandler(gameService *services.GameService, scoreService *services.ScoreService) *GameHandler {
+func NewGameHandler(gameService *services.GameService) *GameHandler {
 	return &GameHandler{
-		gameService:  gameService,
-		scoreService: scoreService,
+		gameService: gameService,
 	}
 }
 
@@ -36,11 +36,28 @@ func (h *GameHandler) StartGame(c *gin.Context) {
 		return
 	}
 
+	req.UserID = currentUserID(c)
+
 	resp, err := h.gameService.StartGame(c.Request.Context(), req)
 	if err != nil {
-		if err == services.ErrNoFlights {
+		if errors.Is(err, services.ErrDifficultyLocked) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrNotEnoughFlights) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Not enough flights for a game right now: " + err.Error()})
+			return
+		}
+		switch err {
+		case services.ErrNoFlights:
 			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No flights available. Please try again later."})
 			return
+		case services.ErrUsernameRequired:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "username is required"})
+			return
+		case services.ErrUsernameRegistered:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Username belongs to a registered player. Log in to play as them."})
+			return
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start game: " + err.Error()})
 		return
@@ -56,16 +73,30 @@ func (h *GameHandler) SubmitGuess(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
 		return
 	}
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = c.GetHeader("Idempotency-Key")
+	}
+	req.UserID = currentUserID(c)
 
 	resp, err := h.gameService.SubmitGuess(c.Request.Context(), req)
 	if err != nil {
 		switch err {
 		case services.ErrSessionNotFound:
 			c.JSON(http.StatusNotFound, gin.H{"error": "Game session not found"})
+		case services.ErrNotSessionPlayer:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Game belongs to another player"})
 		case services.ErrGameCompleted:
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Game already completed"})
+		case services.ErrGameExpired:
+			c.JSON(http.StatusGone, gin.H{"error": "Game session expired"})
 		case services.ErrInvalidRound:
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid round"})
+		case services.ErrStaleRound:
+			c.JSON(http.StatusConflict, gin.H{"error": "Guess is not for the current round"})
+		case services.ErrIdempotencyKeyReused:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency key was already used for another round"})
+		case services.ErrConcurrentUpdate:
+			c.JSON(http.StatusConflict, gin.H{"error": "Game is being updated by another request, please retry"})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process guess: " + err.Error()})
 		}
@@ -75,6 +106,21 @@ func (h *GameHandler) SubmitGuess(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
+// GetGame handles GET /api/game/:sessionId
+func (h *GameHandler) GetGame(c *gin.Context) {
+	state, err := h.gameService.GetPlayerGameState(c.Request.Context(), c.Param("sessionId"), currentUserID(c))
+	if errors.Is(err, services.ErrNotSessionPlayer) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Game belongs to another player"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Game session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, state)
+}
+
 // EndGame handles POST /api/game/end
 func (h *GameHandler) EndGame(c *gin.Context) {
 	var req models.EndGameRequest
@@ -83,32 +129,174 @@ func (h *GameHandler) EndGame(c *gin.Context) {
 		return
 	}
 
-	// Get the session to save score
-	session, err := h.gameService.GetSession(c.Request.Context(), req.SessionID)
+	req.UserID = currentUserID(c)
+
+	resp, err := h.gameService.EndGame(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Game session not found"})
+		switch {
+		case errors.Is(err, services.ErrSessionNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Game session not found"})
+		case errors.Is(err, services.ErrNotSessionPlayer):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Game belongs to another player"})
+		case errors.Is(err, services.ErrGameExpired):
+			c.JSON(http.StatusGone, gin.H{"error": "Game session expired"})
+		case errors.Is(err, services.ErrConcurrentUpdate):
+			c.JSON(http.StatusConflict, gin.H{"error": "Game is being updated by another request, please retry"})
+		case errors.Is(err, services.ErrScoreNotSaved):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Game ended but the score could not be saved, please retry"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end game: " + err.Error()})
+		}
 		return
 	}
 
-	// End the game
-	resp, err := h.gameService.EndGame(c.Request.Context(), req.SessionID)
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetUserSessions handles GET /api/users/me/sessions
+func (h *GameHandler) GetUserSessions(c *gin.Context) {
+	offset, limit := historyPage(c)
+	page, err := h.gameService.GetUserSessions(c.Request.Context(), currentUserID(c), offset, limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end game: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions: " + err.Error()})
 		return
 	}
 
-	// Save score to leaderboard
-	if err := h.scoreService.SaveScore(c.Request.Context(), session); err != nil {
-		// Log but don't fail the request
-		// Score saving is non-critical
+	resp := gin.H{
+		"sessions": page.Sessions,
+		"count":    len(page.Sessions),
 	}
+	if page.NextOffset > 0 {
+		resp["nextOffset"] = page.NextOffset
+	}
+	c.JSON(http.StatusOK, resp)
+}
 
-	// Get user's rank
-	rank, err := h.scoreService.GetUserRank(c.Request.Context(), session.Username, session.Difficulty)
-	if err == nil {
-		resp.Rank = rank
+// GetUserGames handles GET /api/users/:id/games
+func (h *GameHandler) GetUserGames(c *gin.Context) {
+	offset, limit := historyPage(c)
+	page, err := h.gameService.GetUserGames(c.Request.Context(), c.Param("user"), currentUserID(c), offset, limit)
+	if errors.Is(err, services.ErrPlayerNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Player not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch games: " + err.Error()})
+		return
 	}
 
+	resp := gin.H{
+		"games": page.Sessions,
+		"count": len(page.Sessions),
+	}
+	if page.NextOffset > 0 {
+		resp["nextOffset"] = page.NextOffset
+	}
 	c.JSON(http.StatusOK, resp)
 }
 
+// GetReplay handles GET /api/games/:sessionId/replay
+func (h *GameHandler) GetReplay(c *gin.Context) {
+	replay, err := h.gameService.GetReplay(c.Request.Context(), c.Param("sessionId"))
+	switch {
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Game session not found"})
+		return
+	case errors.Is(err, services.ErrGameInProgress):
+		c.JSON(http.StatusConflict, gin.H{"error": "Game is still in progress"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get replay: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, replay)
+}
+
+// historyPage reads the offset and limit of a page of game history
+func historyPage(c *gin.Context) (offset, limit int) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	offset, err = strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return offset, limit
+}
+
+// ClaimSessions handles POST /api/users/me/claim
+func (h *GameHandler) ClaimSessions(c *gin.Context) {
+	var req models.ClaimSessionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	claimed, err := h.gameService.ClaimSessions(c.Request.Context(), currentUserID(c), req.SessionIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTooManySessions):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrConcurrentUpdate):
+			c.JSON(http.StatusConflict, gin.H{"error": "A game is being updated by another request, please retry"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim sessions: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"claimed": claimed,
+		"count":   len(claimed),
+	})
+}
+
+// GetFeaturedGames handles GET /api/spectate/games
+func (h *GameHandler) GetFeaturedGames(c *gin.Context) {
+	games, err := h.gameService.GetFeaturedGames(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch featured games: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"games":        games,
+		"count":        len(games),
+		"delaySeconds": h.gameService.SpectatorDelay().Seconds(),
+	})
+}
+
+// FeatureGame handles POST /api/admin/featured
+func (h *GameHandler) FeatureGame(c *gin.Context) {
+	var req models.FeatureGameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	spectateID, err := h.gameService.FeatureGame(c.Request.Context(), req.SessionID)
+	switch {
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Game session not found"})
+		return
+	case errors.Is(err, services.ErrGameCompleted):
+		c.JSON(http.StatusConflict, gin.H{"error": "Game is already over"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to feature game: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessionId": req.SessionID, "spectateId": spectateID, "featured": true})
+}
+
+// UnfeatureGame handles DELETE /api/admin/featured/:sessionId
+func (h *GameHandler) UnfeatureGame(c *gin.Context) {
+	h.gameService.UnfeatureGame(c.Param("sessionId"))
+	c.JSON(http.StatusOK, gin.H{"sessionId": c.Param("sessionId"), "featured": false})
+}
@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/repository"
 	"github.com/skyquest/server/internal/services"
 )
 
@@ -43,16 +46,251 @@ func (h *LeaderboardHandler) GetLeaderboard(c *gin.Context) {
 		}
 	}
 
-	entries, err := h.scoreService.GetLeaderboard(c.Request.Context(), difficulty, limit)
+	window := models.LeaderboardWindow(c.DefaultQuery("window", string(models.WindowAllTime)))
+	if !services.ValidWindow(window) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid window. Must be: day, week, month, 24h, 7d, 30d, or all"})
+		return
+	}
+
+	ranking, ok := parseRanking(c)
+	if !ok {
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	country := strings.ToUpper(c.Query("country"))
+	airport := strings.ToUpper(c.Query("airport"))
+
+	page, err := h.scoreService.GetLeaderboard(c.Request.Context(), services.LeaderboardOptions{
+		Difficulty: difficulty,
+		Window:     window,
+		Ranking:    ranking,
+		Country:    country,
+		Airport:    airport,
+		Limit:      limit,
+		Offset:     offset,
+		Cursor:     c.Query("cursor"),
+	})
+	if errors.Is(err, services.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch leaderboard: " + err.Error()})
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"leaderboard": page.Entries,
+		"count":       len(page.Entries),
+		"difficulty":  difficulty,
+		"window":      window,
+		"ranking":     ranking,
+		"country":     country,
+		"airport":     airport,
+		"nextCursor":  page.NextCursor,
+	})
+}
+
+// GetCountries handles GET /api/leaderboard/countries
+func (h *LeaderboardHandler) GetCountries(c *gin.Context) {
+	difficulty := models.Difficulty(c.Query("difficulty"))
+	switch difficulty {
+	case models.DifficultyEasy, models.DifficultyMedium, models.DifficultyHard:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid difficulty. Must be: easy, medium, or hard"})
+		return
+	}
+
+	window := models.LeaderboardWindow(c.DefaultQuery("window", string(models.WindowAllTime)))
+	if !services.ValidWindow(window) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid window. Must be: day, week, month, 24h, 7d, 30d, or all"})
+		return
+	}
+
+	top, err := strconv.Atoi(c.DefaultQuery("top", "10"))
+	if err != nil || top <= 0 {
+		top = 10
+	}
+	if top > 100 {
+		top = 100
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	if limit > 250 {
+		limit = 250
+	}
+
+	countries, err := h.scoreService.GetCountryLeaderboard(c.Request.Context(), difficulty, window, top, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch leaderboard: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"countries":  countries,
+		"count":      len(countries),
+		"difficulty": difficulty,
+		"window":     window,
+		"top":        top,
+	})
+}
+
+// GetArchive handles GET /api/leaderboard/archive
+func (h *LeaderboardHandler) GetArchive(c *gin.Context) {
+	window := models.LeaderboardWindow(c.Query("window"))
+	switch window {
+	case models.WindowDay, models.WindowWeek, models.WindowMonth:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid window. Must be: day, week, or month"})
+		return
+	}
+
+	difficulty := models.Difficulty(c.Query("difficulty"))
+	switch difficulty {
+	case models.DifficultyEasy, models.DifficultyMedium, models.DifficultyHard:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid difficulty. Must be: easy, medium, or hard"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	snapshots, err := h.scoreService.GetArchivedWinners(c.Request.Context(), window, difficulty, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch leaderboard archive: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"snapshots":  snapshots,
+		"count":      len(snapshots),
+		"window":     window,
+		"difficulty": difficulty,
+	})
+}
+
+// GetMe handles GET /api/leaderboard/me
+func (h *LeaderboardHandler) GetMe(c *gin.Context) {
+	username, difficulty, ok := parsePlayerQuery(c)
+	if !ok {
+		return
+	}
+
+	window := models.LeaderboardWindow(c.DefaultQuery("window", string(models.WindowAllTime)))
+	if !services.ValidWindow(window) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid window. Must be: day, week, month, 24h, 7d, 30d, or all"})
+		return
+	}
+
+	ranking, ok := parseRanking(c)
+	if !ok {
+		return
+	}
+
+	standing, err := h.scoreService.GetPlayerStanding(c.Request.Context(), username, difficulty, window, ranking, parseRadius(c))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Player has no score on this leaderboard"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch leaderboard: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"player":     standing.Entry,
+		"rank":       standing.Entry.Rank,
+		"percentile": standing.Percentile,
+		"players":    standing.Players,
+		"above":      standing.Above,
+		"below":      standing.Below,
+		"difficulty": difficulty,
+		"window":     window,
+		"ranking":    ranking,
+	})
+}
+
+// GetAround handles GET /api/leaderboard/around, the all-time players around
+// username on a difficulty's leaderboard. It predates GetMe, which it's kept
+// as an alias of for older clients.
+func (h *LeaderboardHandler) GetAround(c *gin.Context) {
+	username, difficulty, ok := parsePlayerQuery(c)
+	if !ok {
+		return
+	}
+
+	standing, err := h.scoreService.GetPlayerStanding(c.Request.Context(), username, difficulty, models.WindowAllTime, repository.RankCompetition, parseRadius(c))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Player has no score for this difficulty"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch leaderboard: " + err.Error()})
+		return
+	}
+
+	entries := append(append(standing.Above, standing.Entry), standing.Below...)
 	c.JSON(http.StatusOK, gin.H{
 		"leaderboard": entries,
 		"count":       len(entries),
 		"difficulty":  difficulty,
+		"username":    username,
 	})
 }
 
+// parsePlayerQuery reads the username and difficulty query parameters of a
+// player's standing, responding with an error if they're invalid
+func parsePlayerQuery(c *gin.Context) (string, models.Difficulty, bool) {
+	username := c.Query("username")
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username is required"})
+		return "", "", false
+	}
+
+	difficulty := models.Difficulty(c.Query("difficulty"))
+	switch difficulty {
+	case models.DifficultyEasy, models.DifficultyMedium, models.DifficultyHard:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid difficulty. Must be: easy, medium, or hard"})
+		return "", "", false
+	}
+	return username, difficulty, true
+}
+
+// parseRadius reads the radius query parameter: how many neighbours to show
+// on each side of a player, 5 by default and at most 50
+func parseRadius(c *gin.Context) int {
+	radius, err := strconv.Atoi(c.DefaultQuery("radius", "5"))
+	if err != nil || radius < 0 {
+		radius = 5
+	}
+	if radius > 50 {
+		radius = 50
+	}
+	return radius
+}
+
+// parseRanking reads the ranking query parameter, responding with an error if it's invalid
+func parseRanking(c *gin.Context) (repository.Ranking, bool) {
+	ranking := repository.Ranking(c.DefaultQuery("ranking", string(repository.RankCompetition)))
+	switch ranking {
+	case repository.RankCompetition, repository.RankDense:
+		return ranking, true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ranking. Must be: competition or dense"})
+	return "", false
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/services"
+)
+
+type RatingHandler struct {
+	ratingService *services.RatingService
+}
+
+func NewRatingHandler(ratingService *services.RatingService) *RatingHandler {
+	return &RatingHandler{
+		ratingService: ratingService,
+	}
+}
+
+// GetRatingBoard handles GET /api/leaderboard/ratings
+func (h *RatingHandler) GetRatingBoard(c *gin.Context) {
+	difficulty := models.Difficulty(c.Query("difficulty"))
+	switch difficulty {
+	case models.DifficultyEasy, models.DifficultyMedium, models.DifficultyHard:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid difficulty. Must be: easy, medium, or hard"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	ratings, err := h.ratingService.GetRatingBoard(c.Request.Context(), difficulty, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ratings: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ratings":    ratings,
+		"count":      len(ratings),
+		"difficulty": difficulty,
+	})
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/services"
+)
+
+type RoomHandler struct {
+	roomService *services.RoomService
+}
+
+func NewRoomHandler(roomService *services.RoomService) *RoomHandler {
+	return &RoomHandler{
+		roomService: roomService,
+	}
+}
+
+// CreateRoom handles POST /api/rooms
+func (h *RoomHandler) CreateRoom(c *gin.Context) {
+	var req models.CreateRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	// Validate difficulty
+	switch req.Difficulty {
+	case models.DifficultyEasy, models.DifficultyMedium, models.DifficultyHard:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid difficulty. Must be: easy, medium, or hard"})
+		return
+	}
+
+	req.UserID = currentUserID(c)
+
+	ticket, err := h.roomService.CreateRoom(c.Request.Context(), req)
+	if err != nil {
+		roomError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, ticket)
+}
+
+// JoinRoom handles POST /api/rooms/:code/join
+func (h *RoomHandler) JoinRoom(c *gin.Context) {
+	var req models.JoinRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	req.UserID = currentUserID(c)
+
+	ticket, err := h.roomService.JoinRoom(c.Request.Context(), strings.ToUpper(c.Param("code")), req)
+	if err != nil {
+		roomError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ticket)
+}
+
+// GetRoom handles GET /api/rooms/:code
+func (h *RoomHandler) GetRoom(c *gin.Context) {
+	room, err := h.roomService.GetRoom(strings.ToUpper(c.Param("code")))
+	if err != nil {
+		roomError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, room)
+}
+
+// roomError responds with the status for a room service error
+func roomError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrRoomNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+	case errors.Is(err, services.ErrRoomStarted), errors.Is(err, services.ErrRoomFull),
+		errors.Is(err, services.ErrRoomUsernameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrDifficultyLocked):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUsernameRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username is required"})
+	case errors.Is(err, services.ErrUsernameRegistered):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Username belongs to a registered player. Log in to play as them."})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Room request failed: " + err.Error()})
+	}
+}
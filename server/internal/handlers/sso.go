@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/services"
+)
+
+const (
+	// loginFlowCookie holds a login in progress, scoped to the callback
+	loginFlowCookie     = "skyquest_sso"
+	loginFlowCookiePath = "/api/auth/sso"
+)
+
+type SSOHandler struct {
+	ssoService *services.SSOService
+	// redirectURL is the frontend page logins finish on; empty to respond with JSON
+	redirectURL string
+}
+
+func NewSSOHandler(ssoService *services.SSOService, redirectURL string) *SSOHandler {
+	return &SSOHandler{
+		ssoService:  ssoService,
+		redirectURL: redirectURL,
+	}
+}
+
+// GetProviders handles GET /api/auth/providers
+func (h *SSOHandler) GetProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.ssoService.Providers()})
+}
+
+// Login handles GET /api/auth/sso/:provider/login, redirecting the player to
+// the provider. A "link" ticket from LinkIdentity links the identity to the
+// ticket's account instead of logging in with it.
+func (h *SSOHandler) Login(c *gin.Context) {
+	authURL, flowToken, err := h.ssoService.BeginLogin(c.Param("provider"), c.Query("link"))
+	switch {
+	case errors.Is(err, services.ErrUnknownProvider):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	case errors.Is(err, services.ErrInvalidToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link ticket"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login: " + err.Error()})
+		return
+	}
+
+	h.setFlowCookie(c, flowToken, int(services.LoginFlowTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback handles GET /api/auth/sso/:provider/callback, where the provider
+// returns the player. The result goes to the frontend in the URL fragment,
+// which browsers don't send to servers or in Referer headers.
+func (h *SSOHandler) Callback(c *gin.Context) {
+	flowToken, _ := c.Cookie(loginFlowCookie)
+	// The flow is single use
+	h.setFlowCookie(c, "", -1)
+
+	if providerError := c.Query("error"); providerError != "" {
+		h.finish(c, http.StatusUnauthorized, nil, "Login was cancelled or denied: "+providerError)
+		return
+	}
+
+	resp, err := h.ssoService.CompleteLogin(c.Request.Context(), c.Param("provider"), flowToken, c.Query("state"), c.Query("code"))
+	switch {
+	case err == nil:
+		h.finish(c, http.StatusOK, resp, "")
+	case errors.Is(err, services.ErrUnknownProvider):
+		h.finish(c, http.StatusNotFound, nil, "Unknown identity provider")
+	case errors.Is(err, services.ErrInvalidLoginFlow):
+		h.finish(c, http.StatusBadRequest, nil, "Login expired or was started in another browser; please try again")
+	case errors.Is(err, services.ErrIdentityLinked):
+		h.finish(c, http.StatusConflict, nil, "This identity is linked to another account")
+	case errors.Is(err, services.ErrIdentityProvider):
+		log.Printf("SSO login with %s failed: %v", c.Param("provider"), err)
+		h.finish(c, http.StatusBadGateway, nil, "The identity provider rejected the login")
+	default:
+		h.finish(c, http.StatusInternalServerError, nil, "Failed to log in: "+err.Error())
+	}
+}
+
+// LinkIdentity handles POST /api/users/me/identities/:provider, returning the
+// login URL that links an identity at the provider to the logged-in account
+func (h *SSOHandler) LinkIdentity(c *gin.Context) {
+	provider := c.Param("provider")
+	ticket, err := h.ssoService.LinkTicket(provider, currentUserID(c))
+	if errors.Is(err, services.ErrUnknownProvider) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start linking: " + err.Error()})
+		return
+	}
+
+	loginURL := loginFlowCookiePath + "/" + url.PathEscape(provider) + "/login?" + url.Values{"link": {ticket}}.Encode()
+	c.JSON(http.StatusOK, gin.H{"url": loginURL})
+}
+
+// finish sends the login result to the frontend, or as JSON without one
+func (h *SSOHandler) finish(c *gin.Context, status int, resp *models.AuthResponse, message string) {
+	if h.redirectURL == "" {
+		if resp != nil {
+			c.JSON(status, resp)
+		} else {
+			c.JSON(status, gin.H{"error": message})
+		}
+		return
+	}
+
+	fragment := url.Values{}
+	if resp != nil {
+		fragment.Set("token", resp.Token)
+		fragment.Set("expiresAt", strconv.FormatInt(resp.ExpiresAt.Unix(), 10))
+	} else {
+		fragment.Set("error", message)
+	}
+	c.Redirect(http.StatusFound, h.redirectURL+"#"+fragment.Encode())
+}
+
+func (h *SSOHandler) setFlowCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(loginFlowCookie, value, maxAge, loginFlowCookiePath, "", c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https", true)
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/services"
+)
+
+type TournamentHandler struct {
+	tournamentService *services.TournamentService
+}
+
+func NewTournamentHandler(tournamentService *services.TournamentService) *TournamentHandler {
+	return &TournamentHandler{
+		tournamentService: tournamentService,
+	}
+}
+
+// CreateTournament handles POST /api/tournaments
+func (h *TournamentHandler) CreateTournament(c *gin.Context) {
+	var req models.CreateTournamentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	req.UserID = currentUserID(c)
+
+	tournament, err := h.tournamentService.CreateTournament(c.Request.Context(), req)
+	if err != nil {
+		tournamentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, tournament)
+}
+
+// ListTournaments handles GET /api/tournaments
+func (h *TournamentHandler) ListTournaments(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	tournaments, err := h.tournamentService.ListTournaments(c.Request.Context(), limit, offset)
+	if err != nil {
+		tournamentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tournaments": tournaments,
+		"count":       len(tournaments),
+	})
+}
+
+// GetTournament handles GET /api/tournaments/:id
+func (h *TournamentHandler) GetTournament(c *gin.Context) {
+	tournament, err := h.tournamentService.GetTournament(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		tournamentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tournament)
+}
+
+// Register handles POST /api/tournaments/:id/register
+func (h *TournamentHandler) Register(c *gin.Context) {
+	tournament, err := h.tournamentService.Register(c.Request.Context(), c.Param("id"), currentUserID(c))
+	if err != nil {
+		tournamentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tournament)
+}
+
+// CheckIn handles POST /api/tournaments/:id/checkin
+func (h *TournamentHandler) CheckIn(c *gin.Context) {
+	tournament, err := h.tournamentService.CheckIn(c.Request.Context(), c.Param("id"), currentUserID(c))
+	if err != nil {
+		tournamentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tournament)
+}
+
+// Play handles POST /api/tournaments/:id/play, starting the player's game in
+// the current stage. The game is then played through the /api/game endpoints.
+func (h *TournamentHandler) Play(c *gin.Context) {
+	game, err := h.tournamentService.Play(c.Request.Context(), c.Param("id"), currentUserID(c))
+	if err != nil {
+		tournamentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, game)
+}
+
+// GetStandings handles GET /api/tournaments/:id/standings
+func (h *TournamentHandler) GetStandings(c *gin.Context) {
+	standings, err := h.tournamentService.GetStandings(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		tournamentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, standings)
+}
+
+// ExportResults handles GET /api/tournaments/:id/export?format=json|csv
+func (h *TournamentHandler) ExportResults(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format. Must be: json or csv"})
+		return
+	}
+
+	tournament, results, err := h.tournamentService.ExportResults(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		tournamentError(c, err)
+		return
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, gin.H{
+			"tournamentId": tournament.ID,
+			"name":         tournament.Name,
+			"difficulty":   tournament.Difficulty,
+			"results":      results,
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="tournament-%s.csv"`, tournament.ID))
+	c.Status(http.StatusOK)
+	c.Writer.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"place", "username", "stage_reached", "stage_rank", "stages_played", "total_score"})
+	for _, result := range results {
+		w.Write([]string{
+			strconv.Itoa(result.Place),
+			result.Username,
+			result.StageReached,
+			strconv.Itoa(result.StageRank),
+			strconv.Itoa(result.StagesPlayed),
+			strconv.Itoa(result.TotalScore),
+		})
+	}
+	w.Flush()
+}
+
+// tournamentError responds with the status for a tournament service error
+func tournamentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrTournamentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tournament not found"})
+	case errors.Is(err, services.ErrInvalidTournament), errors.Is(err, services.ErrNotEnoughFlights),
+		errors.Is(err, services.ErrNoFlights):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotEligible), errors.Is(err, services.ErrNotRegistered),
+		errors.Is(err, services.ErrNotInStage):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrRegistrationClosed), errors.Is(err, services.ErrCheckInClosed),
+		errors.Is(err, services.ErrNoStageOpen), errors.Is(err, services.ErrStageAlreadyPlayed),
+		errors.Is(err, services.ErrTournamentNotFinished):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrConcurrentUpdate):
+		c.JSON(http.StatusConflict, gin.H{"error": "Tournament was updated concurrently, please retry"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Tournament request failed: " + err.Error()})
+	}
+}
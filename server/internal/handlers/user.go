@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/services"
+)
+
+type UserHandler struct {
+	userService  *services.UserService
+	statsService *services.StatsService
+}
+
+func NewUserHandler(userService *services.UserService, statsService *services.StatsService) *UserHandler {
+	return &UserHandler{
+		userService:  userService,
+		statsService: statsService,
+	}
+}
+
+// GetProfile handles GET /api/users/:username/profile
+func (h *UserHandler) GetProfile(c *gin.Context) {
+	profile, err := h.statsService.GetProfile(c.Request.Context(), c.Param("user"))
+	if errors.Is(err, services.ErrPlayerNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Player not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get profile: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// SetHome handles PUT /api/users/:username/home
+func (h *UserHandler) SetHome(c *gin.Context) {
+	var req models.SetHomeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	user, err := h.userService.SetHome(c.Request.Context(), currentUserID(c), c.Param("user"), req)
+	if errors.Is(err, services.ErrInvalidCountry) || errors.Is(err, services.ErrInvalidAirport) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrNotAccountOwner) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Log in as this player to change their home"})
+		return
+	}
+	if errors.Is(err, services.ErrNotGuestPlayer) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set home: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
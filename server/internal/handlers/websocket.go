@@ -38,7 +38,7 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 	}
 
 	sessionID := c.Query("sessionId")
-	client := ws.NewClient(h.hub, conn, sessionID)
+	client := ws.NewClient(h.hub, conn, ws.Identity{Player: sessionID})
 	h.hub.Register(client)
 
 	// Start goroutines for reading and writing
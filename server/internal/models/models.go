@@ -18,6 +18,21 @@ const (
 	DifficultyHard   Difficulty = "hard"
 )
 
+// Game session statuses
+const (
+	SessionInProgress = "in_progress"
+	SessionCompleted  = "completed"
+	SessionAbandoned  = "abandoned" // expired after being idle too long
+)
+
+// Game result statuses, tracking whether a finished game reached the leaderboard
+const (
+	ResultPending  = "pending"  // claimed by the request finishing the game
+	ResultRecorded = "recorded" // score saved to the leaderboard
+	ResultSkipped  = "skipped"  // not eligible under the completion policy
+	ResultFailed   = "failed"   // saving failed; ending the game again retries
+)
+
 // User represents a player in the system
 type User struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
@@ -25,43 +40,182 @@ type User struct {
 	Email     string             `bson:"email,omitempty" json:"email,omitempty"`
 	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
 	Stats     UserStats          `bson:"stats" json:"stats"`
+	// Progression is the player's experience and level
+	Progression Progression `bson:"progression" json:"progression"`
+	// Home the player competes for on country and airport leaderboards
+	HomeCountry string `bson:"homeCountry,omitempty" json:"homeCountry,omitempty"` // ISO 3166-1 alpha-2 code
+	HomeAirport string `bson:"homeAirport,omitempty" json:"homeAirport,omitempty"` // IATA code
+	// PasswordHash is the bcrypt hash of a registered player's password
+	PasswordHash string `bson:"passwordHash,omitempty" json:"-"`
+	// Identities are the external accounts the player logs in with
+	Identities []UserIdentity `bson:"identities,omitempty" json:"identities,omitempty"`
+}
+
+// Registered reports whether the user has an account, as opposed to being a
+// guest profile that anyone may register
+func (u *User) Registered() bool {
+	return u.PasswordHash != "" || len(u.Identities) > 0
+}
+
+// UserIdentity links a user to an account at an identity provider
+type UserIdentity struct {
+	Provider string    `bson:"provider" json:"provider"`
+	Subject  string    `bson:"subject" json:"-"` // the provider's stable user ID
+	Email    string    `bson:"email,omitempty" json:"email,omitempty"`
+	LinkedAt time.Time `bson:"linkedAt" json:"linkedAt"`
+}
+
+// Progression is a player's experience, earned every round, and the level it has earned them
+type Progression struct {
+	XP    int `bson:"xp" json:"xp"`
+	Level int `bson:"level" json:"level"` // from 1
 }
 
-// UserStats tracks player statistics
+// LevelUp reports the levels a player gained
+type LevelUp struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// UserStats tracks player statistics over every finished game with a graded round
 type UserStats struct {
 	GamesPlayed int `bson:"gamesPlayed" json:"gamesPlayed"`
 	TotalScore  int `bson:"totalScore" json:"totalScore"`
 	AvgScore    int `bson:"avgScore" json:"avgScore"`
 	BestScore   int `bson:"bestScore" json:"bestScore"`
+	// RoundsPlayed counts graded rounds; MatchTypes counts them by ScoreResult.MatchType
+	RoundsPlayed int            `bson:"roundsPlayed,omitempty" json:"roundsPlayed"`
+	MatchTypes   map[string]int `bson:"matchTypes,omitempty" json:"matchTypes,omitempty"`
+	// Distance between guessed and actual airports, over rounds where both are known
+	TotalDistanceKm float64 `bson:"totalDistanceKm,omitempty" json:"totalDistanceKm"`
+	DistanceRounds  int     `bson:"distanceRounds,omitempty" json:"distanceRounds"`
+	AvgDistanceKm   float64 `bson:"avgDistanceKm,omitempty" json:"avgDistanceKm"`
+	TotalGuessTime  float64 `bson:"totalGuessTime,omitempty" json:"totalGuessTime"` // seconds
+	AvgGuessTime    float64 `bson:"avgGuessTime,omitempty" json:"avgGuessTime"`
+	// Streaks of consecutive rounds guessed right, i.e. an exact or same-city match
+	CurrentStreak int `bson:"currentStreak,omitempty" json:"currentStreak"`
+	BestStreak    int `bson:"bestStreak,omitempty" json:"bestStreak"`
+	// Difficulties breaks the games down by difficulty
+	Difficulties map[Difficulty]*DifficultyStats `bson:"difficulties,omitempty" json:"difficulties,omitempty"`
+	// Airports counts, by IATA code, how often each airport was guessed and
+	// how often it was the arrival and missed
+	Airports     map[string]*AirportStats `bson:"airports,omitempty" json:"airports,omitempty"`
+	LastPlayedAt *time.Time               `bson:"lastPlayedAt,omitempty" json:"lastPlayedAt,omitempty"`
+}
+
+// Clone returns a deep copy of the stats
+func (s UserStats) Clone() UserStats {
+	clone := s
+	if s.MatchTypes != nil {
+		clone.MatchTypes = make(map[string]int, len(s.MatchTypes))
+		for matchType, n := range s.MatchTypes {
+			clone.MatchTypes[matchType] = n
+		}
+	}
+	if s.Difficulties != nil {
+		clone.Difficulties = make(map[Difficulty]*DifficultyStats, len(s.Difficulties))
+		for difficulty, stats := range s.Difficulties {
+			copied := *stats
+			clone.Difficulties[difficulty] = &copied
+		}
+	}
+	if s.Airports != nil {
+		clone.Airports = make(map[string]*AirportStats, len(s.Airports))
+		for iata, stats := range s.Airports {
+			copied := *stats
+			clone.Airports[iata] = &copied
+		}
+	}
+	if s.LastPlayedAt != nil {
+		lastPlayedAt := *s.LastPlayedAt
+		clone.LastPlayedAt = &lastPlayedAt
+	}
+	return clone
+}
+
+// DifficultyStats are a player's statistics for one difficulty
+type DifficultyStats struct {
+	GamesPlayed  int `bson:"gamesPlayed" json:"gamesPlayed"`
+	TotalScore   int `bson:"totalScore" json:"totalScore"`
+	AvgScore     int `bson:"avgScore" json:"avgScore"`
+	BestScore    int `bson:"bestScore" json:"bestScore"`
+	RoundsPlayed int `bson:"roundsPlayed" json:"roundsPlayed"`
+	ExactMatches int `bson:"exactMatches" json:"exactMatches"`
+}
+
+// AirportStats count a player's guesses of an airport and misses of it as the arrival
+type AirportStats struct {
+	Guessed int `bson:"guessed,omitempty" json:"guessed,omitempty"`
+	Missed  int `bson:"missed,omitempty" json:"missed,omitempty"`
 }
 
 // GameSession represents a single game session
 type GameSession struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	SessionID  string             `bson:"sessionId" json:"sessionId"`
-	UserID     string             `bson:"userId,omitempty" json:"userId,omitempty"`
-	Username   string             `bson:"username" json:"username"`
-	StartedAt  time.Time          `bson:"startedAt" json:"startedAt"`
-	EndedAt    *time.Time         `bson:"endedAt,omitempty" json:"endedAt,omitempty"`
-	Difficulty Difficulty         `bson:"difficulty" json:"difficulty"`
-	TotalScore int                `bson:"totalScore" json:"totalScore"`
-	Rounds     []Round            `bson:"rounds" json:"rounds"`
-	Status     string             `bson:"status" json:"status"` // "in_progress", "completed"
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SessionID      string             `bson:"sessionId" json:"sessionId"`
+	UserID         string             `bson:"userId,omitempty" json:"userId,omitempty"`
+	Username       string             `bson:"username" json:"username"`
+	StartedAt      time.Time          `bson:"startedAt" json:"startedAt"`
+	EndedAt        *time.Time         `bson:"endedAt,omitempty" json:"endedAt,omitempty"`
+	Difficulty     Difficulty         `bson:"difficulty" json:"difficulty"`
+	TotalScore     int                `bson:"totalScore" json:"totalScore"`
+	Rounds         []Round            `bson:"rounds" json:"rounds"`
+	Status         string             `bson:"status" json:"status"` // "in_progress", "completed", "abandoned"
+	LastActivityAt time.Time          `bson:"lastActivityAt" json:"lastActivityAt"`
+	Result         *GameResult        `bson:"result,omitempty" json:"result,omitempty"`
+	// StartXP is the player's experience when the game started, which the
+	// levels it gains are reported from. Unset for games from before levels.
+	StartXP *int `bson:"startXp,omitempty" json:"-"`
+	// TournamentID is set on games played in a tournament stage
+	TournamentID string `bson:"tournamentId,omitempty" json:"tournamentId,omitempty"`
+	// ChallengeID is set on games played taking up a challenge
+	ChallengeID string `bson:"challengeId,omitempty" json:"challengeId,omitempty"`
+	Version     int64  `bson:"version" json:"-"` // optimistic concurrency control
+}
+
+// GameResult is the outcome of recording a finished game on the leaderboard
+type GameResult struct {
+	Status     string    `bson:"status" json:"status"`
+	Rank       int       `bson:"rank,omitempty" json:"rank,omitempty"`
+	Percentile float64   `bson:"percentile,omitempty" json:"percentile,omitempty"`
+	UpdatedAt  time.Time `bson:"updatedAt" json:"updatedAt"`
+	// StatsCounted is set once the game is counted in the player's stats
+	StatsCounted bool `bson:"statsCounted,omitempty" json:"statsCounted,omitempty"`
+	// EventPublished is set once the game's completion is published to achievements
+	EventPublished bool `bson:"eventPublished,omitempty" json:"eventPublished,omitempty"`
+	// RatingCounted is set once the game is counted in the player's rating and
+	// the difficulty estimates of its routes
+	RatingCounted bool `bson:"ratingCounted,omitempty" json:"ratingCounted,omitempty"`
 }
 
 // Round represents a single round in a game
 type Round struct {
-	RoundNumber   int        `bson:"roundNumber" json:"roundNumber"`
-	FlightID      string     `bson:"flightId" json:"flightId"`
-	Flight        *Flight    `bson:"flight,omitempty" json:"flight,omitempty"`
-	Departure     string     `bson:"departure" json:"departure"`
-	ActualArrival string     `bson:"actualArrival" json:"actualArrival"`
-	PlayerGuess   string     `bson:"playerGuess,omitempty" json:"playerGuess,omitempty"`
-	PointsEarned  int        `bson:"pointsEarned" json:"pointsEarned"`
-	GuessTime     float64    `bson:"guessTime" json:"guessTime"` // seconds
-	Confidence    int        `bson:"confidence,omitempty" json:"confidence,omitempty"`
-	StartedAt     time.Time  `bson:"startedAt" json:"startedAt"`
-	CompletedAt   *time.Time `bson:"completedAt,omitempty" json:"completedAt,omitempty"`
+	RoundNumber   int              `bson:"roundNumber" json:"roundNumber"`
+	FlightID      string           `bson:"flightId" json:"flightId"`
+	Token         string           `bson:"token" json:"token"` // opaque ID shown to the player instead of FlightID
+	Flight        *Flight          `bson:"flight,omitempty" json:"flight,omitempty"`
+	Display       *DisplayPosition `bson:"display,omitempty" json:"display,omitempty"`
+	Departure     string           `bson:"departure" json:"departure"`
+	ActualArrival string           `bson:"actualArrival" json:"actualArrival"`
+	PlayerGuess   string           `bson:"playerGuess,omitempty" json:"playerGuess,omitempty"`
+	PointsEarned  int              `bson:"pointsEarned" json:"pointsEarned"`
+	GuessTime     float64          `bson:"guessTime" json:"guessTime"` // seconds
+	Confidence    int              `bson:"confidence,omitempty" json:"confidence,omitempty"`
+	Score         *ScoreResult     `bson:"score,omitempty" json:"score,omitempty"`
+	GuessKey      string           `bson:"guessKey,omitempty" json:"-"` // idempotency key of the graded guess
+	StartedAt     time.Time        `bson:"startedAt" json:"startedAt"`
+	CompletedAt   *time.Time       `bson:"completedAt,omitempty" json:"completedAt,omitempty"`
+}
+
+// DisplayPosition is the randomized position and hint a round's flight is shown with
+type DisplayPosition struct {
+	Latitude      float64 `bson:"latitude" json:"latitude"`
+	Longitude     float64 `bson:"longitude" json:"longitude"`
+	Altitude      float64 `bson:"altitude" json:"altitude"`
+	Speed         float64 `bson:"speed" json:"speed"`
+	Direction     float64 `bson:"direction" json:"direction"`
+	VerticalSpeed float64 `bson:"verticalSpeed" json:"verticalSpeed"`
+	Hint          string  `bson:"hint,omitempty" json:"hint,omitempty"`
 }
 
 // LeaderboardEntry represents a score on the leaderboard
@@ -73,6 +227,80 @@ type LeaderboardEntry struct {
 	TotalScore  int                `bson:"totalScore" json:"totalScore"`
 	GamesPlayed int                `bson:"gamesPlayed" json:"gamesPlayed"`
 	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
+	Country     string             `bson:"country,omitempty" json:"country,omitempty"` // player's home country
+	Airport     string             `bson:"airport,omitempty" json:"airport,omitempty"` // player's home airport
+}
+
+// CountryEntry is a country's place on the country vs country leaderboard
+type CountryEntry struct {
+	Rank         int     `bson:"rank" json:"rank"`
+	Country      string  `bson:"country" json:"country"`
+	Players      int     `bson:"players" json:"players"` // players counted towards the average
+	AverageScore float64 `bson:"averageScore" json:"averageScore"`
+}
+
+// PlayerRating is a player's Glicko-2 skill rating on a difficulty
+type PlayerRating struct {
+	UserID     string     `bson:"userId" json:"-"`
+	Username   string     `bson:"username" json:"username"`
+	Difficulty Difficulty `bson:"difficulty" json:"difficulty"`
+	Rating     float64    `bson:"rating" json:"rating"`
+	RD         float64    `bson:"rd" json:"rd"` // rating deviation
+	Volatility float64    `bson:"volatility" json:"volatility"`
+	Games      int        `bson:"games" json:"games"` // rated games
+	UpdatedAt  time.Time  `bson:"updatedAt" json:"updatedAt"`
+	Rank       int        `bson:"-" json:"rank,omitempty"` // set on rating boards
+}
+
+// RouteDifficulty is how well players have guessed a route flown by an airline
+type RouteDifficulty struct {
+	Departure    string `json:"departure"`
+	Arrival      string `json:"arrival"`
+	Airline      string `json:"airline"`
+	Rounds       int    `json:"rounds"`
+	ExactMatches int    `json:"exactMatches"`
+	// Ease is the estimated share of points a guess gets, from 0 to 1
+	Ease float64 `json:"ease"`
+	// Rating is the route's difficulty on the skill rating scale
+	Rating float64 `json:"rating"`
+}
+
+// LeaderboardWindow is the period a leaderboard covers
+type LeaderboardWindow string
+
+const (
+	// Calendar windows, in UTC; weeks start on Monday
+	WindowDay   LeaderboardWindow = "day"
+	WindowWeek  LeaderboardWindow = "week"
+	WindowMonth LeaderboardWindow = "month"
+	// Rolling windows ending now
+	Window24Hours LeaderboardWindow = "24h"
+	Window7Days   LeaderboardWindow = "7d"
+	Window30Days  LeaderboardWindow = "30d"
+
+	WindowAllTime LeaderboardWindow = "all"
+)
+
+// ScoreRecord is the score of a single finished game
+type ScoreRecord struct {
+	SessionID  string     `bson:"sessionId" json:"sessionId"`
+	UserID     string     `bson:"userId,omitempty" json:"userId,omitempty"`
+	Username   string     `bson:"username" json:"username"`
+	Difficulty Difficulty `bson:"difficulty" json:"difficulty"`
+	Score      int        `bson:"score" json:"score"`
+	PlayedAt   time.Time  `bson:"playedAt" json:"playedAt"`
+	Country    string     `bson:"country,omitempty" json:"country,omitempty"`
+	Airport    string     `bson:"airport,omitempty" json:"airport,omitempty"`
+}
+
+// LeaderboardSnapshot archives the top of a leaderboard for a period that has ended
+type LeaderboardSnapshot struct {
+	Window      LeaderboardWindow  `bson:"window" json:"window"`
+	Difficulty  Difficulty         `bson:"difficulty" json:"difficulty"`
+	PeriodStart time.Time          `bson:"periodStart" json:"periodStart"`
+	PeriodEnd   time.Time          `bson:"periodEnd" json:"periodEnd"`
+	Entries     []LeaderboardEntry `bson:"entries" json:"entries"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
 }
 
 // Flight represents flight data from Aviation Edge API
@@ -138,8 +366,9 @@ type ScoreResult struct {
 
 // StartGameRequest represents the request to start a new game
 type StartGameRequest struct {
-	Username   string     `json:"username" binding:"required"`
+	Username   string     `json:"username"` // required for guests; logged-in players play as themselves
 	Difficulty Difficulty `json:"difficulty" binding:"required"`
+	UserID     string     `json:"-"` // set from the caller's login
 }
 
 // StartGameResponse represents the response when starting a game
@@ -153,9 +382,12 @@ type StartGameResponse struct {
 
 // GuessRequest represents a player's guess
 type GuessRequest struct {
-	SessionID   string `json:"sessionId" binding:"required"`
-	AirportIATA string `json:"airportIata" binding:"required"`
-	Confidence  int    `json:"confidence"`
+	SessionID      string `json:"sessionId" binding:"required"`
+	RoundNumber    int    `json:"roundNumber" binding:"required"`
+	AirportIATA    string `json:"airportIata" binding:"required"`
+	Confidence     int    `json:"confidence"`
+	IdempotencyKey string `json:"idempotencyKey"` // may also be sent as the Idempotency-Key header
+	UserID         string `json:"-"`              // set from the caller's login
 }
 
 // GuessResponse represents the response after a guess
@@ -165,11 +397,14 @@ type GuessResponse struct {
 	IsGameOver  bool        `json:"isGameOver"`
 	NextFlight  *Flight     `json:"nextFlight,omitempty"`
 	TotalScore  int         `json:"totalScore"`
+	XPEarned    int         `json:"xpEarned"`
+	LevelUp     *LevelUp    `json:"levelUp,omitempty"` // set when the round's experience gained a level
 }
 
 // EndGameRequest represents the request to end a game
 type EndGameRequest struct {
 	SessionID string `json:"sessionId" binding:"required"`
+	UserID    string `json:"-"` // set from the caller's login
 }
 
 // EndGameResponse represents the final game results
@@ -178,7 +413,206 @@ type EndGameResponse struct {
 	TotalScore int        `json:"totalScore"`
 	Rounds     []Round    `json:"rounds"`
 	Rank       int        `json:"rank"`
+	Percentile float64    `json:"percentile"`
+	Recorded   bool       `json:"recorded"` // false if the game wasn't eligible for the leaderboard
 	Difficulty Difficulty `json:"difficulty"`
+	XPEarned   int        `json:"xpEarned"`
+	LevelUp    *LevelUp   `json:"levelUp,omitempty"` // set when the game's experience gained a level
+}
+
+// GameStateResponse is a redacted view of a session used to resume a game
+type GameStateResponse struct {
+	SessionID       string           `json:"sessionId"`
+	Username        string           `json:"username"`
+	Difficulty      Difficulty       `json:"difficulty"`
+	Status          string           `json:"status"`
+	TotalRounds     int              `json:"totalRounds"`
+	CurrentRound    int              `json:"currentRound,omitempty"` // 0 once the game is over
+	Flight          *Flight          `json:"flight,omitempty"`
+	RoundStartedAt  time.Time        `json:"roundStartedAt,omitempty"`
+	Deadline        time.Time        `json:"deadline,omitempty"` // session is abandoned if idle past this
+	CompletedRounds []CompletedRound `json:"completedRounds"`
+	TotalScore      int              `json:"totalScore"`
+}
+
+// CompletedRound is a graded round as shown to the player
+type CompletedRound struct {
+	RoundNumber   int          `json:"roundNumber"`
+	PlayerGuess   string       `json:"playerGuess"`
+	ActualArrival string       `json:"actualArrival"`
+	PointsEarned  int          `json:"pointsEarned"`
+	GuessTime     float64      `json:"guessTime"`
+	Score         *ScoreResult `json:"score,omitempty"`
+}
+
+// RegisterRequest creates an account
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Email    string `json:"email"`
+}
+
+// LoginRequest logs in with a username and password
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// AuthResponse carries the bearer token for a logged-in player
+type AuthResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	User      *User     `json:"user"`
+}
+
+// ClaimSessionsRequest lists sessions a player played as a guest, to attach to their account
+type ClaimSessionsRequest struct {
+	SessionIDs []string `json:"sessionIds" binding:"required"`
+}
+
+// SessionSummary is a game in a player's history
+type SessionSummary struct {
+	SessionID    string     `json:"sessionId,omitempty"` // left out of others' unfinished games
+	Username     string     `json:"username"`
+	Difficulty   Difficulty `json:"difficulty"`
+	Status       string     `json:"status"`
+	TotalScore   int        `json:"totalScore"`
+	RoundsPlayed int        `json:"roundsPlayed"`
+	TotalRounds  int        `json:"totalRounds"`
+	StartedAt    time.Time  `json:"startedAt"`
+	EndedAt      *time.Time `json:"endedAt,omitempty"`
+	Recorded     bool       `json:"recorded"`
+}
+
+// Achievement is a badge and the rule that unlocks it. Rules are data files;
+// see services/achievements.
+type Achievement struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Event is the game event that counts towards the badge: "round:scored",
+	// "game:completed" or "streak:reached"
+	Event string               `json:"event"`
+	When  AchievementCondition `json:"when"`
+	// Count is how many matching events unlock the badge, 1 when unset
+	Count int `json:"count,omitempty"`
+	// Distinct counts the different destinations of matching rounds instead:
+	// "airport", "country" or "continent"
+	Distinct string `json:"distinct,omitempty"`
+}
+
+// AchievementCondition selects the events that count towards an achievement.
+// Unset fields match every event.
+type AchievementCondition struct {
+	Difficulty Difficulty `json:"difficulty,omitempty"`
+	// MatchTypes and MaxGuessTime (seconds) apply to scored rounds
+	MatchTypes   []string `json:"matchTypes,omitempty"`
+	MaxGuessTime float64  `json:"maxGuessTime,omitempty"`
+	// MinPoints is a scored round's points, or a completed game's total score
+	MinPoints int `json:"minPoints,omitempty"`
+	// MinStreak is the number of right guesses in a row within a game
+	MinStreak int `json:"minStreak,omitempty"`
+	// Perfect matches completed games with every round guessed exactly
+	Perfect bool `json:"perfect,omitempty"`
+}
+
+// PlayerAchievements are the achievements a player has unlocked and their
+// progress towards the others
+type PlayerAchievements struct {
+	UserID   string                          `bson:"userId" json:"-"`
+	Unlocked []UnlockedAchievement           `bson:"unlocked" json:"unlocked"`
+	Progress map[string]*AchievementProgress `bson:"progress" json:"progress"` // key: achievement ID
+	Version  int                             `bson:"version" json:"-"`
+}
+
+// UnlockedAchievement records when and in which game a player unlocked an achievement
+type UnlockedAchievement struct {
+	ID         string    `bson:"id" json:"id"`
+	SessionID  string    `bson:"sessionId" json:"sessionId"`
+	UnlockedAt time.Time `bson:"unlockedAt" json:"unlockedAt"`
+}
+
+// AchievementProgress counts the events towards a locked achievement
+type AchievementProgress struct {
+	Count int      `bson:"count" json:"count"`
+	Seen  []string `bson:"seen,omitempty" json:"seen,omitempty"` // the distinct values counted
+}
+
+// AchievementStatus is a player's standing on an achievement
+type AchievementStatus struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Unlocked    bool       `json:"unlocked"`
+	UnlockedAt  *time.Time `json:"unlockedAt,omitempty"`
+	SessionID   string     `json:"sessionId,omitempty"` // the game it was unlocked in
+	Progress    int        `json:"progress"`
+	Goal        int        `json:"goal"`
+}
+
+// GameReplay is a finished game round by round, for reviewing and sharing
+type GameReplay struct {
+	SessionID  string        `json:"sessionId"`
+	Username   string        `json:"username"`
+	Difficulty Difficulty    `json:"difficulty"`
+	Status     string        `json:"status"`
+	TotalScore int           `json:"totalScore"`
+	StartedAt  time.Time     `json:"startedAt"`
+	EndedAt    *time.Time    `json:"endedAt,omitempty"`
+	Rounds     []ReplayRound `json:"rounds"` // the graded rounds
+}
+
+// ReplayRound is a graded round of a replay
+type ReplayRound struct {
+	RoundNumber int     `json:"roundNumber"`
+	Flight      *Flight `json:"flight"` // as it was shown to the player
+	Departure   Airport `json:"departure"`
+	// Withheld is set while the flight is being played in another game. The
+	// arrival, the guess and how it scored are left out, since any of them
+	// could give the arrival away.
+	Withheld       bool     `json:"withheld,omitempty"`
+	Arrival        *Airport `json:"arrival,omitempty"`
+	Guess          string   `json:"guess"`
+	GuessedAirport *Airport `json:"guessedAirport,omitempty"`
+	MatchType      string   `json:"matchType"`
+	DistanceKm     float64  `json:"distanceKm"`
+	Points         int      `json:"points"`
+	GuessTime      float64  `json:"guessTime"`
+}
+
+// PlayerProfile is a player's public profile and lifetime statistics
+type PlayerProfile struct {
+	Username    string      `json:"username"`
+	Registered  bool        `json:"registered"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	HomeCountry string      `json:"homeCountry,omitempty"`
+	HomeAirport string      `json:"homeAirport,omitempty"`
+	Stats       UserStats   `json:"stats"`
+	Progression Progression `json:"progression"`
+	// NextLevelXP is the experience the next level is reached at
+	NextLevelXP int `json:"nextLevelXp"`
+	// Ratings are the player's skill ratings on the difficulties they've played
+	Ratings []PlayerRating `json:"ratings"`
+	// Accuracy is the share of graded rounds per match type
+	Accuracy    map[string]float64 `json:"accuracy"`
+	MostGuessed []AirportCount     `json:"mostGuessed"`
+	MostMissed  []AirportCount     `json:"mostMissed"`
+}
+
+// AirportCount is how often something happened at an airport
+type AirportCount struct {
+	IATA  string `json:"iata"`
+	Name  string `json:"name,omitempty"`
+	Count int    `json:"count"`
+}
+
+// SetHomeRequest sets the home a player competes for; empty fields clear it
+type SetHomeRequest struct {
+	Country string `json:"country"` // ISO 3166-1 alpha-2 code, e.g. DE
+	Airport string `json:"airport"` // IATA code, e.g. FRA
+	// SessionID is a game a guest played under the username, proving they're
+	// the player; logged-in players needn't send it
+	SessionID string `json:"sessionId"`
 }
 
 // GetFlightsRequest represents query parameters for getting flights
@@ -215,9 +649,442 @@ type WSGuessResult struct {
 	TotalScore  int         `json:"totalScore"`
 }
 
+// WSGameState carries the resumable state of a session after a client registers
+type WSGameState struct {
+	State *GameStateResponse `json:"state"`
+}
+
+// WSGameExpired notifies a player that their idle game was abandoned
+type WSGameExpired struct {
+	SessionID    string `json:"sessionId"`
+	TotalScore   int    `json:"totalScore"`
+	RoundsPlayed int    `json:"roundsPlayed"`
+}
+
+// WSAchievementUnlocked announces an achievement a player unlocked in a game
+type WSAchievementUnlocked struct {
+	SessionID   string    `json:"sessionId"`
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	UnlockedAt  time.Time `json:"unlockedAt"`
+}
+
 // WSGameEnd represents the end of a game
 type WSGameEnd struct {
 	SessionID  string `json:"sessionId"`
 	TotalScore int    `json:"totalScore"`
 	Rank       int    `json:"rank"`
 }
+
+// Multiplayer room types
+
+// RoomState is where a multiplayer room is in its game
+type RoomState string
+
+const (
+	RoomLobby    RoomState = "lobby"   // waiting for the host to start
+	RoomPlaying  RoomState = "playing" // a round is open for guesses
+	RoomReveal   RoomState = "reveal"  // a round's results are shown
+	RoomFinished RoomState = "finished"
+)
+
+// CreateRoomRequest is the request to open a multiplayer room as its host
+type CreateRoomRequest struct {
+	Username   string     `json:"username"` // required for guests; logged-in players play as themselves
+	Difficulty Difficulty `json:"difficulty" binding:"required"`
+	UserID     string     `json:"-"` // set from the caller's login
+}
+
+// JoinRoomRequest is the request to join a room's lobby
+type JoinRoomRequest struct {
+	Username string `json:"username"` // required for guests; logged-in players play as themselves
+	UserID   string `json:"-"`        // set from the caller's login
+}
+
+// RoomTicket is a player's place in a room. The player ID is sent with
+// room:join over the WebSocket and is only known to the player.
+type RoomTicket struct {
+	Code     string    `json:"code"`
+	PlayerID string    `json:"playerId"`
+	Room     *RoomView `json:"room"`
+}
+
+// RoomView is a room as shown to its players
+type RoomView struct {
+	Code         string       `json:"code"`
+	State        RoomState    `json:"state"`
+	Difficulty   Difficulty   `json:"difficulty"`
+	Host         string       `json:"host"` // username
+	TotalRounds  int          `json:"totalRounds"`
+	CurrentRound int          `json:"currentRound,omitempty"`
+	RoundEndsAt  *time.Time   `json:"roundEndsAt,omitempty"`
+	Scoreboard   []RoomPlayer `json:"scoreboard"` // highest score first
+}
+
+// RoomPlayer is a player's standing in a room
+type RoomPlayer struct {
+	Username  string `json:"username"`
+	Score     int    `json:"score"`
+	Connected bool   `json:"connected"`
+	LockedIn  bool   `json:"lockedIn,omitempty"` // has guessed the open round
+}
+
+// RoomGuess is a player's result in a revealed round
+type RoomGuess struct {
+	Username string      `json:"username"`
+	Guess    string      `json:"guess,omitempty"` // empty if time ran out
+	Score    ScoreResult `json:"score"`
+}
+
+// WSRoomState carries a room's state to its players
+type WSRoomState struct {
+	Room *RoomView `json:"room"`
+}
+
+// WSRoomRound opens a round to every player in a room at once
+type WSRoomRound struct {
+	Code        string    `json:"code"`
+	RoundNumber int       `json:"roundNumber"`
+	TotalRounds int       `json:"totalRounds"`
+	Flight      *Flight   `json:"flight"`
+	EndsAt      time.Time `json:"endsAt"`
+}
+
+// WSRoomLocked confirms a player's guess is locked in until the round ends
+type WSRoomLocked struct {
+	Code        string `json:"code"`
+	RoundNumber int    `json:"roundNumber"`
+	Guess       string `json:"guess"`
+}
+
+// WSRoomReveal reveals a round's answer and every player's result together
+type WSRoomReveal struct {
+	Code        string       `json:"code"`
+	RoundNumber int          `json:"roundNumber"`
+	Arrival     Airport      `json:"arrival"`
+	Results     []RoomGuess  `json:"results"`
+	Scoreboard  []RoomPlayer `json:"scoreboard"`
+	NextRoundAt *time.Time   `json:"nextRoundAt,omitempty"` // unset after the last round
+}
+
+// WSRoomError reports a room message the server turned down
+type WSRoomError struct {
+	Error string `json:"error"`
+}
+
+// Spectator types
+
+// FeaturedGame is a solo game in progress that spectators can watch. They
+// watch it by its spectate ID rather than its session ID, which would let
+// them play it.
+type FeaturedGame struct {
+	SpectateID   string     `json:"spectateId"`
+	Username     string     `json:"username"`
+	Difficulty   Difficulty `json:"difficulty"`
+	CurrentRound int        `json:"currentRound"`
+	TotalRounds  int        `json:"totalRounds"`
+	TotalScore   int        `json:"totalScore"`
+	FeaturedAt   time.Time  `json:"featuredAt"`
+}
+
+// FeatureGameRequest is the request to feature a solo game for spectators
+type FeatureGameRequest struct {
+	SessionID string `json:"sessionId" binding:"required"`
+}
+
+// Tournament types
+
+// TournamentStatus is where a tournament is in its schedule
+type TournamentStatus string
+
+const (
+	TournamentRegistration TournamentStatus = "registration"
+	TournamentCheckIn      TournamentStatus = "check_in" // checked-in players play the first stage
+	TournamentRunning      TournamentStatus = "running"
+	TournamentFinished     TournamentStatus = "finished" // the final stage is scored
+)
+
+// Advancement rule types
+const (
+	AdvanceTopN              = "top_n"              // the N best scores go through
+	AdvanceSingleElimination = "single_elimination" // the winner of each pairing goes through
+)
+
+// AdvancementRule decides who goes through from a stage to the next
+type AdvancementRule struct {
+	Type string `bson:"type" json:"type"`
+	N    int    `bson:"n,omitempty" json:"n,omitempty"` // for top_n
+}
+
+// Tournament is an organized competition: players register, check in, and
+// play a game on each stage's fixed flights, with the best going through to
+// the next stage
+type Tournament struct {
+	ID          string     `bson:"_id" json:"id"`
+	Name        string     `bson:"name" json:"name"`
+	OrganizerID string     `bson:"organizerId" json:"organizerId"`
+	Organizer   string     `bson:"organizer" json:"organizer"` // username
+	Difficulty  Difficulty `bson:"difficulty" json:"difficulty"`
+	// Registration is open until RegistrationClosesAt, and check-in from
+	// CheckInOpensAt until the first stage starts
+	RegistrationClosesAt time.Time `bson:"registrationClosesAt" json:"registrationClosesAt"`
+	CheckInOpensAt       time.Time `bson:"checkInOpensAt" json:"checkInOpensAt"`
+	// Eligible lists the usernames allowed to register; anyone may when empty
+	Eligible  []string           `bson:"eligible" json:"eligible"`
+	Players   []TournamentPlayer `bson:"players" json:"players"` // in the order they registered
+	Stages    []TournamentStage  `bson:"stages" json:"stages"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	Version   int                `bson:"version" json:"-"` // optimistic concurrency control
+}
+
+// TournamentPlayer is a registered player
+type TournamentPlayer struct {
+	UserID       string     `bson:"userId" json:"userId"`
+	Username     string     `bson:"username" json:"username"`
+	RegisteredAt time.Time  `bson:"registeredAt" json:"registeredAt"`
+	CheckedInAt  *time.Time `bson:"checkedInAt,omitempty" json:"checkedInAt,omitempty"`
+}
+
+// TournamentStage is a window in which each of its players plays one game on
+// the stage's flights. Its players are seeded when it starts and scored when
+// it ends.
+type TournamentStage struct {
+	Name        string          `bson:"name" json:"name"`
+	StartsAt    time.Time       `bson:"startsAt" json:"startsAt"`
+	EndsAt      time.Time       `bson:"endsAt" json:"endsAt"`
+	Advancement AdvancementRule `bson:"advancement" json:"advancement"`
+	// Rounds are the stage's flights, shown the same way to every player
+	Rounds   []PresetRound     `bson:"rounds" json:"rounds"`
+	Seeded   bool              `bson:"seeded" json:"seeded"`
+	Entries  []StageEntry      `bson:"entries" json:"entries"` // by seed
+	Matches  []TournamentMatch `bson:"matches,omitempty" json:"matches,omitempty"`
+	Resolved bool              `bson:"resolved" json:"resolved"`
+}
+
+// PresetRound is a flight fixed ahead of a game, with the position it's shown at
+type PresetRound struct {
+	Flight  Flight          `bson:"flight" json:"flight"`
+	Display DisplayPosition `bson:"display" json:"display"`
+}
+
+// StageEntry is a player's game in a stage
+type StageEntry struct {
+	UserID       string `bson:"userId" json:"userId"`
+	Username     string `bson:"username" json:"username"`
+	Seed         int    `bson:"seed" json:"seed"`
+	SessionID    string `bson:"sessionId,omitempty" json:"sessionId,omitempty"`
+	Score        int    `bson:"score" json:"score"`
+	RoundsPlayed int    `bson:"roundsPlayed" json:"roundsPlayed"`
+	Rank         int    `bson:"rank,omitempty" json:"rank,omitempty"` // set once the stage is scored
+	Advanced     bool   `bson:"advanced,omitempty" json:"advanced,omitempty"`
+}
+
+// TournamentMatch pairs players in a single elimination stage. A match with
+// one player is a bye.
+type TournamentMatch struct {
+	Players []string `bson:"players" json:"players"` // usernames
+	Winner  string   `bson:"winner,omitempty" json:"winner,omitempty"`
+}
+
+// CreateTournamentRequest is the request to organize a tournament
+type CreateTournamentRequest struct {
+	Name                 string               `json:"name" binding:"required"`
+	Difficulty           Difficulty           `json:"difficulty" binding:"required"`
+	RegistrationClosesAt time.Time            `json:"registrationClosesAt" binding:"required"`
+	CheckInOpensAt       time.Time            `json:"checkInOpensAt" binding:"required"`
+	Eligible             []string             `json:"eligible"`
+	Stages               []CreateStageRequest `json:"stages" binding:"required"`
+	UserID               string               `json:"-"` // set from the caller's login
+}
+
+// CreateStageRequest schedules a stage. Its flights are drawn when no flight
+// IDs are given.
+type CreateStageRequest struct {
+	Name        string          `json:"name" binding:"required"`
+	StartsAt    time.Time       `json:"startsAt" binding:"required"`
+	EndsAt      time.Time       `json:"endsAt" binding:"required"`
+	FlightIDs   []string        `json:"flightIds"`
+	Advancement AdvancementRule `json:"advancement"` // required on every stage but the last
+}
+
+// TournamentView is a tournament as shown to players. Stage flights are left out.
+type TournamentView struct {
+	ID                   string           `json:"id"`
+	Name                 string           `json:"name"`
+	Organizer            string           `json:"organizer"`
+	Difficulty           Difficulty       `json:"difficulty"`
+	Status               TournamentStatus `json:"status"`
+	RegistrationOpen     bool             `json:"registrationOpen"`
+	RegistrationClosesAt time.Time        `json:"registrationClosesAt"`
+	CheckInOpensAt       time.Time        `json:"checkInOpensAt"`
+	Eligible             []string         `json:"eligible,omitempty"`
+	Players              []PlayerView     `json:"players"`
+	Stages               []StageView      `json:"stages"`
+	CurrentStage         int              `json:"currentStage,omitempty"` // 1-based; 0 between stages
+}
+
+// PlayerView is a registered player as shown to others
+type PlayerView struct {
+	Username  string `json:"username"`
+	CheckedIn bool   `json:"checkedIn"`
+}
+
+// StageView is a stage's schedule and rule
+type StageView struct {
+	Name        string          `json:"name"`
+	StartsAt    time.Time       `json:"startsAt"`
+	EndsAt      time.Time       `json:"endsAt"`
+	Advancement AdvancementRule `json:"advancement"`
+	Players     int             `json:"players"` // once seeded
+}
+
+// TournamentStandings ranks each stage's players
+type TournamentStandings struct {
+	TournamentID string           `json:"tournamentId"`
+	Status       TournamentStatus `json:"status"`
+	Stages       []StageStandings `json:"stages"`
+}
+
+// StageStandings ranks a stage's players. Until the stage is scored, its
+// players are ranked by their games so far.
+type StageStandings struct {
+	Name     string            `json:"name"`
+	Resolved bool              `json:"resolved"`
+	Entries  []StandingEntry   `json:"entries"`
+	Matches  []TournamentMatch `json:"matches,omitempty"`
+}
+
+// StandingEntry is a player's place in a stage
+type StandingEntry struct {
+	Rank         int    `json:"rank"`
+	Username     string `json:"username"`
+	Seed         int    `json:"seed"`
+	Score        int    `json:"score"`
+	RoundsPlayed int    `json:"roundsPlayed"`
+	Played       bool   `json:"played"` // has started the stage's game
+	Advanced     bool   `json:"advanced,omitempty"`
+}
+
+// TournamentResult is a player's final place in a finished tournament
+type TournamentResult struct {
+	Place        int    `json:"place"`
+	Username     string `json:"username"`
+	StageReached string `json:"stageReached"`
+	StageRank    int    `json:"stageRank"` // within the stage reached
+	StagesPlayed int    `json:"stagesPlayed"`
+	TotalScore   int    `json:"totalScore"` // over every stage
+}
+
+// Challenge types
+
+// Challenge outcomes, for the player taking up a challenge
+const (
+	ChallengeWon  = "won"
+	ChallengeLost = "lost"
+	ChallengeTied = "tied"
+)
+
+// Challenge offers the flights of a finished game, shown at the same
+// positions, for friends to play and compare round by round. The flights are
+// pinned in the challenge, so it doesn't depend on the live feed.
+type Challenge struct {
+	ID              string             `bson:"_id" json:"id"`
+	ChallengerID    string             `bson:"challengerId" json:"challengerId"`
+	Challenger      string             `bson:"challenger" json:"challenger"` // username
+	SourceSessionID string             `bson:"sourceSessionId" json:"sourceSessionId"`
+	Difficulty      Difficulty         `bson:"difficulty" json:"difficulty"`
+	Score           int                `bson:"score" json:"score"` // the challenger's
+	Rounds          []PresetRound      `bson:"rounds" json:"rounds"`
+	Attempts        []ChallengeAttempt `bson:"attempts" json:"attempts"`
+	CreatedAt       time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt       time.Time          `bson:"expiresAt" json:"expiresAt"`
+	Version         int                `bson:"version" json:"-"` // optimistic concurrency control
+}
+
+// ChallengeAttempt is a player's game taking up a challenge. Its comparison
+// with the challenger's game is recorded once it finishes.
+type ChallengeAttempt struct {
+	UserID     string     `bson:"userId,omitempty" json:"userId,omitempty"` // empty for guests
+	Username   string     `bson:"username" json:"username"`
+	SessionID  string     `bson:"sessionId" json:"sessionId"`
+	StartedAt  time.Time  `bson:"startedAt" json:"startedAt"`
+	FinishedAt *time.Time `bson:"finishedAt,omitempty" json:"finishedAt,omitempty"`
+	Score      int        `bson:"score" json:"score"`
+	Outcome    string     `bson:"outcome,omitempty" json:"outcome,omitempty"`
+}
+
+// CreateChallengeRequest is the request to challenge friends with a finished game
+type CreateChallengeRequest struct {
+	SessionID string `json:"sessionId" binding:"required"`
+}
+
+// AcceptChallengeRequest is the request to play a challenge
+type AcceptChallengeRequest struct {
+	Username string `json:"username"` // when playing as a guest
+}
+
+// ChallengeView is a challenge as shown to anyone with its link
+type ChallengeView struct {
+	ID         string          `json:"id"`
+	Challenger string          `json:"challenger"`
+	Difficulty Difficulty      `json:"difficulty"`
+	Score      int             `json:"score"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	ExpiresAt  time.Time       `json:"expiresAt"`
+	Expired    bool            `json:"expired"`
+	Attempts   []ChallengeTake `json:"attempts"`
+}
+
+// ChallengeTake is an attempt at a challenge as shown to others. Its number
+// looks up its diff; its session ID is never shown, as it would let others
+// play or claim the game.
+type ChallengeTake struct {
+	Number    int       `json:"number"`
+	Username  string    `json:"username"`
+	StartedAt time.Time `json:"startedAt"`
+	Finished  bool      `json:"finished"`
+	Score     int       `json:"score,omitempty"`
+	Outcome   string    `json:"outcome,omitempty"`
+}
+
+// ChallengeDiff compares a finished attempt at a challenge with the
+// challenger's game, round by round
+type ChallengeDiff struct {
+	ChallengeID string               `json:"challengeId"`
+	Difficulty  Difficulty           `json:"difficulty"`
+	Challenger  ChallengeSide        `json:"challenger"`
+	Opponent    ChallengeSide        `json:"opponent"`
+	Outcome     string               `json:"outcome"` // for the opponent
+	Rounds      []ChallengeRoundDiff `json:"rounds"`
+}
+
+// ChallengeSide is one player's game in a diff
+type ChallengeSide struct {
+	Username   string `json:"username"`
+	TotalScore int    `json:"totalScore"`
+}
+
+// ChallengeRoundDiff is a round of a diff: the flight both players were
+// shown, its true route and each player's guess
+type ChallengeRoundDiff struct {
+	RoundNumber int             `json:"roundNumber"`
+	Flight      *Flight         `json:"flight"` // as shown during the game
+	Departure   Airport         `json:"departure"`
+	Arrival     *Airport        `json:"arrival,omitempty"` // withheld while the flight is in play elsewhere
+	Challenger  *ChallengeGuess `json:"challenger,omitempty"`
+	Opponent    *ChallengeGuess `json:"opponent,omitempty"`
+	// PointsDiff is the opponent's points less the challenger's
+	PointsDiff int `json:"pointsDiff"`
+}
+
+// ChallengeGuess is a player's guess in a round of a diff. Rounds a player
+// didn't guess have none.
+type ChallengeGuess struct {
+	Guess          string   `json:"guess"`
+	GuessedAirport *Airport `json:"guessedAirport,omitempty"`
+	MatchType      string   `json:"matchType,omitempty"`
+	DistanceKm     float64  `json:"distanceKm"`
+	Points         int      `json:"points"`
+	GuessTime      float64  `json:"guessTime"`
+}
@@ -0,0 +1,864 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/skyquest/server/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore keeps sessions, users and the leaderboard in process memory.
+// It's used when no database is configured or MongoDB is unreachable.
+type MemoryStore struct {
+	sessions    map[string]*models.GameSession
+	sessionsMux sync.RWMutex
+	scores      map[string]*models.LeaderboardEntry // key: username:difficulty
+	scoresMux   sync.RWMutex
+	users       map[string]*models.User // key: user ID
+	usersMux    sync.RWMutex
+	records     map[string]*models.ScoreRecord // key: session ID; guarded by scoresMux
+	snapshots   []models.LeaderboardSnapshot   // guarded by scoresMux
+	// achievements is keyed by user ID
+	achievements    map[string]*models.PlayerAchievements
+	achievementsMux sync.RWMutex
+	// ratings is keyed by user ID and difficulty
+	ratings    map[string]*models.PlayerRating
+	ratingsMux sync.RWMutex
+	// tournaments is keyed by tournament ID
+	tournaments    map[string]*models.Tournament
+	tournamentsMux sync.RWMutex
+	// challenges is keyed by challenge ID
+	challenges    map[string]*models.Challenge
+	challengesMux sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]*models.GameSession),
+		scores:   make(map[string]*models.LeaderboardEntry),
+		users:    make(map[string]*models.User),
+		records:  make(map[string]*models.ScoreRecord),
+
+		achievements: make(map[string]*models.PlayerAchievements),
+		ratings:      make(map[string]*models.PlayerRating),
+		tournaments:  make(map[string]*models.Tournament),
+		challenges:   make(map[string]*models.Challenge),
+	}
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// Game Session methods
+
+func (m *MemoryStore) CreateSession(ctx context.Context, session *models.GameSession) error {
+	session.ID = primitive.NewObjectID()
+	m.sessionsMux.Lock()
+	defer m.sessionsMux.Unlock()
+	m.sessions[session.SessionID] = cloneSession(session)
+	return nil
+}
+
+func (m *MemoryStore) GetSession(ctx context.Context, sessionID string) (*models.GameSession, error) {
+	m.sessionsMux.RLock()
+	defer m.sessionsMux.RUnlock()
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	// Hand out a copy so callers never mutate the stored session without the lock
+	return cloneSession(session), nil
+}
+
+func (m *MemoryStore) UpdateSession(ctx context.Context, session *models.GameSession) error {
+	m.sessionsMux.Lock()
+	defer m.sessionsMux.Unlock()
+	stored, ok := m.sessions[session.SessionID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != session.Version {
+		return ErrVersionConflict
+	}
+	session.Version++
+	m.sessions[session.SessionID] = cloneSession(session)
+	return nil
+}
+
+func (m *MemoryStore) FindIdleSessions(ctx context.Context, cutoff time.Time) ([]models.GameSession, error) {
+	m.sessionsMux.RLock()
+	defer m.sessionsMux.RUnlock()
+	var idle []models.GameSession
+	for _, session := range m.sessions {
+		if session.Status == models.SessionInProgress && session.LastActivityAt.Before(cutoff) {
+			idle = append(idle, *cloneSession(session))
+		}
+	}
+	return idle, nil
+}
+
+func (m *MemoryStore) GetUserSessions(ctx context.Context, userID string, offset, limit int) ([]models.GameSession, error) {
+	m.sessionsMux.RLock()
+	defer m.sessionsMux.RUnlock()
+	var sessions []models.GameSession
+	for _, session := range m.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, *cloneSession(session))
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].StartedAt.Equal(sessions[j].StartedAt) {
+			return sessions[i].StartedAt.After(sessions[j].StartedAt)
+		}
+		return sessions[i].SessionID < sessions[j].SessionID
+	})
+	if offset >= len(sessions) {
+		return nil, nil
+	}
+	sessions = sessions[offset:]
+	if len(sessions) > limit {
+		sessions = sessions[:limit]
+	}
+	return sessions, nil
+}
+
+func (m *MemoryStore) ListFinishedSessions(ctx context.Context, after SessionCursor, limit int) ([]models.GameSession, error) {
+	m.sessionsMux.RLock()
+	defer m.sessionsMux.RUnlock()
+	var sessions []models.GameSession
+	for _, session := range m.sessions {
+		if session.Status != models.SessionInProgress && session.EndedAt != nil && endedAfter(session, after) {
+			sessions = append(sessions, *cloneSession(session))
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return endedAfter(&sessions[j], CursorAt(&sessions[i]))
+	})
+	if len(sessions) > limit {
+		sessions = sessions[:limit]
+	}
+	return sessions, nil
+}
+
+// EvictFinishedSessions drops finished sessions idle since cutoff so memory
+// stays bounded. Tournament and challenge games are kept, as their tournaments
+// and challenges are scored from them.
+func (m *MemoryStore) EvictFinishedSessions(cutoff time.Time) int {
+	m.sessionsMux.Lock()
+	defer m.sessionsMux.Unlock()
+	evicted := 0
+	for id, session := range m.sessions {
+		if session.TournamentID != "" || session.ChallengeID != "" {
+			continue
+		}
+		if session.Status != models.SessionInProgress && session.LastActivityAt.Before(cutoff) {
+			delete(m.sessions, id)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// cloneSession copies a session deeply enough that rounds can be modified independently
+func cloneSession(session *models.GameSession) *models.GameSession {
+	clone := *session
+	clone.Rounds = make([]models.Round, len(session.Rounds))
+	copy(clone.Rounds, session.Rounds)
+	return &clone
+}
+
+// User methods
+
+func (m *MemoryStore) CreateUser(ctx context.Context, user *models.User) error {
+	m.usersMux.Lock()
+	defer m.usersMux.Unlock()
+	for _, existing := range m.users {
+		if existing.Username == user.Username {
+			return ErrDuplicate
+		}
+	}
+	user.ID = primitive.NewObjectID()
+	m.users[user.ID.Hex()] = cloneUser(user)
+	return nil
+}
+
+func (m *MemoryStore) GetUser(ctx context.Context, id string) (*models.User, error) {
+	m.usersMux.RLock()
+	defer m.usersMux.RUnlock()
+	user, ok := m.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneUser(user), nil
+}
+
+func (m *MemoryStore) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	m.usersMux.RLock()
+	defer m.usersMux.RUnlock()
+	for _, user := range m.users {
+		if user.Username == username {
+			return cloneUser(user), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) GetUserByIdentity(ctx context.Context, provider, subject string) (*models.User, error) {
+	m.usersMux.RLock()
+	defer m.usersMux.RUnlock()
+	for _, user := range m.users {
+		for _, identity := range user.Identities {
+			if identity.Provider == provider && identity.Subject == subject {
+				return cloneUser(user), nil
+			}
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) UpdateUser(ctx context.Context, user *models.User) error {
+	m.usersMux.Lock()
+	defer m.usersMux.Unlock()
+	id := user.ID.Hex()
+	existing, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	for otherID, other := range m.users {
+		if otherID != id && other.Username == user.Username {
+			return ErrDuplicate
+		}
+	}
+	stored := cloneUser(user)
+	stored.Identities = existing.Identities
+	stored.Stats = existing.Stats
+	stored.Progression = existing.Progression
+	m.users[id] = stored
+	return nil
+}
+
+func (m *MemoryStore) UpdateUserStats(ctx context.Context, userID string, stats models.UserStats, gamesPlayed int) error {
+	m.usersMux.Lock()
+	defer m.usersMux.Unlock()
+	user, ok := m.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	if user.Stats.GamesPlayed != gamesPlayed {
+		return ErrVersionConflict
+	}
+	// Copy on write so users handed out earlier keep their own stats
+	updated := *user
+	updated.Stats = stats.Clone()
+	m.users[userID] = &updated
+	return nil
+}
+
+func (m *MemoryStore) UpdateUserProgression(ctx context.Context, userID string, progression models.Progression, xp int) error {
+	m.usersMux.Lock()
+	defer m.usersMux.Unlock()
+	user, ok := m.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	if user.Progression.XP != xp {
+		return ErrVersionConflict
+	}
+	updated := *user
+	updated.Progression = progression
+	m.users[userID] = &updated
+	return nil
+}
+
+func (m *MemoryStore) LinkIdentity(ctx context.Context, userID string, identity models.UserIdentity) error {
+	m.usersMux.Lock()
+	defer m.usersMux.Unlock()
+	user, ok := m.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	for _, other := range m.users {
+		for _, linked := range other.Identities {
+			if linked.Provider == identity.Provider && linked.Subject == identity.Subject {
+				return ErrDuplicate
+			}
+		}
+	}
+	// Copy on write so users handed out earlier keep their own slice
+	identities := make([]models.UserIdentity, len(user.Identities), len(user.Identities)+1)
+	copy(identities, user.Identities)
+	user.Identities = append(identities, identity)
+	return nil
+}
+
+// cloneUser copies a user so that callers never share its identities or stats with the store
+func cloneUser(user *models.User) *models.User {
+	clone := *user
+	clone.Identities = append([]models.UserIdentity(nil), user.Identities...)
+	clone.Stats = user.Stats.Clone()
+	return &clone
+}
+
+// Leaderboard methods
+
+func (m *MemoryStore) SaveScore(ctx context.Context, session *models.GameSession) error {
+	country, airport := m.playerHome(session.Username)
+
+	m.scoresMux.Lock()
+	defer m.scoresMux.Unlock()
+
+	record := newScoreRecord(session, country, airport)
+	counted := newGame(m.records[session.SessionID], record)
+	m.records[session.SessionID] = record
+
+	key := session.Username + ":" + string(session.Difficulty)
+	entry, ok := m.scores[key]
+	if !ok {
+		entry = &models.LeaderboardEntry{
+			ID:         primitive.NewObjectID(),
+			Username:   session.Username,
+			Difficulty: session.Difficulty,
+		}
+		m.scores[key] = entry
+	}
+
+	entry.Country = country
+	entry.Airport = airport
+	if counted {
+		entry.GamesPlayed++
+	}
+	if session.TotalScore > entry.TotalScore {
+		entry.TotalScore = session.TotalScore
+	}
+	entry.UpdatedAt = time.Now()
+	return nil
+}
+
+// playerHome returns the home country and airport of the user with a username
+func (m *MemoryStore) playerHome(username string) (country, airport string) {
+	m.usersMux.RLock()
+	defer m.usersMux.RUnlock()
+	for _, user := range m.users {
+		if user.Username == username {
+			return user.HomeCountry, user.HomeAirport
+		}
+	}
+	return "", ""
+}
+
+func (m *MemoryStore) UpdatePlayerHome(ctx context.Context, username, country, airport string) error {
+	m.scoresMux.Lock()
+	defer m.scoresMux.Unlock()
+
+	for _, entry := range m.scores {
+		if entry.Username == username {
+			entry.Country = country
+			entry.Airport = airport
+		}
+	}
+	for _, record := range m.records {
+		if record.Username == username {
+			record.Country = country
+			record.Airport = airport
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetLeaderboard(ctx context.Context, query LeaderboardQuery) ([]models.LeaderboardEntry, error) {
+	m.scoresMux.RLock()
+	defer m.scoresMux.RUnlock()
+
+	board := m.board(query)
+	start := min(query.Offset, len(board))
+	if query.After != nil {
+		start = sort.Search(len(board), func(i int) bool {
+			return orderedAfter(&board[i].LeaderboardEntry, query.After)
+		})
+	}
+	end := min(start+query.Limit, len(board))
+	return rankedEntries(board[start:end], query.Ranking), nil
+}
+
+func (m *MemoryStore) GetScore(ctx context.Context, username string, difficulty models.Difficulty) (*models.LeaderboardEntry, error) {
+	m.scoresMux.RLock()
+	defer m.scoresMux.RUnlock()
+
+	entry, ok := m.scores[username+":"+string(difficulty)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *entry
+	return &found, nil
+}
+
+func (m *MemoryStore) GetScoresAround(ctx context.Context, query LeaderboardQuery, username string, radius int) ([]models.LeaderboardEntry, error) {
+	m.scoresMux.RLock()
+	defer m.scoresMux.RUnlock()
+
+	board := m.board(query)
+	index := findEntry(board, username)
+	if index < 0 {
+		return nil, ErrNotFound
+	}
+	start := max(index-radius, 0)
+	end := min(index+radius+1, len(board))
+	return rankedEntries(board[start:end], query.Ranking), nil
+}
+
+func (m *MemoryStore) GetUserRank(ctx context.Context, username string, difficulty models.Difficulty) (int, error) {
+	higher, _, _, err := m.GetScoreStanding(ctx, LeaderboardQuery{Difficulty: difficulty}, username)
+	if err != nil {
+		return 0, err
+	}
+	return int(higher) + 1, nil
+}
+
+func (m *MemoryStore) GetScoreStanding(ctx context.Context, query LeaderboardQuery, username string) (higher, equal, total int64, err error) {
+	m.scoresMux.RLock()
+	defer m.scoresMux.RUnlock()
+
+	board := m.board(query)
+	index := findEntry(board, username)
+	if index < 0 {
+		return 0, 0, 0, ErrNotFound
+	}
+	higher, equal, total = board[index].standing()
+	return higher, equal, total, nil
+}
+
+func (m *MemoryStore) GetCountryLeaderboard(ctx context.Context, query LeaderboardQuery, top int) ([]models.CountryEntry, error) {
+	m.scoresMux.RLock()
+	defer m.scoresMux.RUnlock()
+
+	// The board is in score order, so each country's first entries are its top players
+	totals := make(map[string]*models.CountryEntry)
+	for _, entry := range m.board(query) {
+		if entry.Country == "" {
+			continue
+		}
+		total, ok := totals[entry.Country]
+		if !ok {
+			total = &models.CountryEntry{Country: entry.Country}
+			totals[entry.Country] = total
+		}
+		if total.Players < top {
+			total.Players++
+			total.AverageScore += float64(entry.TotalScore)
+		}
+	}
+	countries := make([]models.CountryEntry, 0, len(totals))
+	for _, total := range totals {
+		total.AverageScore /= float64(total.Players)
+		countries = append(countries, *total)
+	}
+	sort.Slice(countries, func(i, j int) bool {
+		if countries[i].AverageScore != countries[j].AverageScore {
+			return countries[i].AverageScore > countries[j].AverageScore
+		}
+		return countries[i].Country < countries[j].Country
+	})
+	rankCountries(countries)
+	if len(countries) > query.Limit {
+		countries = countries[:query.Limit]
+	}
+	return countries, nil
+}
+
+// board builds the whole ranked board a query selects. The caller holds scoresMux.
+func (m *MemoryStore) board(query LeaderboardQuery) []rankedEntry {
+	var entries []models.LeaderboardEntry
+	if query.windowed() {
+		entries = m.windowEntries(query)
+	} else {
+		for _, entry := range m.scores {
+			if query.includes(entry) {
+				entries = append(entries, *entry)
+			}
+		}
+	}
+	sortEntries(entries)
+
+	ties := make(map[int]int64)
+	for _, entry := range entries {
+		ties[entry.TotalScore]++
+	}
+	board := make([]rankedEntry, len(entries))
+	for i, entry := range entries {
+		r := rankedEntry{
+			LeaderboardEntry: entry,
+			Position:         int64(i) + 1,
+			CompetitionRank:  int64(i) + 1,
+			DenseRank:        1,
+			Ties:             ties[entry.TotalScore],
+			Entries:          int64(len(entries)),
+		}
+		if i > 0 {
+			if prev := board[i-1]; prev.TotalScore == entry.TotalScore {
+				r.CompetitionRank = prev.CompetitionRank
+				r.DenseRank = prev.DenseRank
+			} else {
+				r.DenseRank = prev.DenseRank + 1
+			}
+		}
+		board[i] = r
+	}
+	return board
+}
+
+// windowEntries groups the score records played in a query's window by player
+func (m *MemoryStore) windowEntries(query LeaderboardQuery) []models.LeaderboardEntry {
+	best := make(map[string]*models.LeaderboardEntry)
+	for _, record := range m.records {
+		if query.Difficulty != "" && record.Difficulty != query.Difficulty {
+			continue
+		}
+		if (query.Country != "" && record.Country != query.Country) || (query.Airport != "" && record.Airport != query.Airport) {
+			continue
+		}
+		if record.PlayedAt.Before(query.Since) || !record.PlayedAt.Before(query.Until) {
+			continue
+		}
+		key := record.Username + ":" + string(record.Difficulty)
+		entry, ok := best[key]
+		if !ok {
+			entry = &models.LeaderboardEntry{
+				Username:   record.Username,
+				Difficulty: record.Difficulty,
+				TotalScore: record.Score,
+				Country:    record.Country,
+				Airport:    record.Airport,
+			}
+			best[key] = entry
+		}
+		entry.GamesPlayed++
+		entry.TotalScore = max(entry.TotalScore, record.Score)
+		if record.PlayedAt.After(entry.UpdatedAt) {
+			entry.UpdatedAt = record.PlayedAt
+		}
+	}
+
+	entries := make([]models.LeaderboardEntry, 0, len(best))
+	for _, entry := range best {
+		entries = append(entries, *entry)
+	}
+	return entries
+}
+
+// findEntry returns the index of a user's entry on a board, or -1
+func findEntry(board []rankedEntry, username string) int {
+	for i := range board {
+		if board[i].Username == username {
+			return i
+		}
+	}
+	return -1
+}
+
+// sortEntries orders entries by score descending, breaking ties by username
+func sortEntries(entries []models.LeaderboardEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].TotalScore != entries[j].TotalScore {
+			return entries[i].TotalScore > entries[j].TotalScore
+		}
+		if entries[i].Username != entries[j].Username {
+			return entries[i].Username < entries[j].Username
+		}
+		return entries[i].Difficulty < entries[j].Difficulty
+	})
+}
+
+// Leaderboard archive methods
+
+func (m *MemoryStore) SaveSnapshot(ctx context.Context, snapshot *models.LeaderboardSnapshot) error {
+	m.scoresMux.Lock()
+	defer m.scoresMux.Unlock()
+
+	for _, existing := range m.snapshots {
+		if existing.Window == snapshot.Window && existing.Difficulty == snapshot.Difficulty &&
+			existing.PeriodStart.Equal(snapshot.PeriodStart) {
+			return ErrDuplicate
+		}
+	}
+	m.snapshots = append(m.snapshots, *snapshot)
+	return nil
+}
+
+func (m *MemoryStore) GetSnapshots(ctx context.Context, window models.LeaderboardWindow, difficulty models.Difficulty, limit int) ([]models.LeaderboardSnapshot, error) {
+	m.scoresMux.RLock()
+	defer m.scoresMux.RUnlock()
+
+	var snapshots []models.LeaderboardSnapshot
+	for _, snapshot := range m.snapshots {
+		if snapshot.Window == window && snapshot.Difficulty == difficulty {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].PeriodStart.After(snapshots[j].PeriodStart)
+	})
+	if len(snapshots) > limit {
+		snapshots = snapshots[:limit]
+	}
+	return snapshots, nil
+}
+
+// Achievement methods
+
+func (m *MemoryStore) GetAchievements(ctx context.Context, userID string) (*models.PlayerAchievements, error) {
+	m.achievementsMux.RLock()
+	defer m.achievementsMux.RUnlock()
+	achievements, ok := m.achievements[userID]
+	if !ok {
+		return &models.PlayerAchievements{UserID: userID}, nil
+	}
+	return cloneAchievements(achievements), nil
+}
+
+func (m *MemoryStore) SaveAchievements(ctx context.Context, achievements *models.PlayerAchievements) error {
+	m.achievementsMux.Lock()
+	defer m.achievementsMux.Unlock()
+	stored, ok := m.achievements[achievements.UserID]
+	if (ok && stored.Version != achievements.Version) || (!ok && achievements.Version != 0) {
+		return ErrVersionConflict
+	}
+	achievements.Version++
+	m.achievements[achievements.UserID] = cloneAchievements(achievements)
+	return nil
+}
+
+// cloneAchievements copies a player's achievements so callers never share them with the store
+func cloneAchievements(achievements *models.PlayerAchievements) *models.PlayerAchievements {
+	clone := *achievements
+	clone.Unlocked = append([]models.UnlockedAchievement(nil), achievements.Unlocked...)
+	clone.Progress = make(map[string]*models.AchievementProgress, len(achievements.Progress))
+	for id, progress := range achievements.Progress {
+		copied := *progress
+		copied.Seen = append([]string(nil), progress.Seen...)
+		clone.Progress[id] = &copied
+	}
+	return &clone
+}
+
+// Rating methods
+
+func (m *MemoryStore) GetRatings(ctx context.Context, userID string) ([]models.PlayerRating, error) {
+	m.ratingsMux.RLock()
+	defer m.ratingsMux.RUnlock()
+	ratings := []models.PlayerRating{}
+	for _, rating := range m.ratings {
+		if rating.UserID == userID {
+			ratings = append(ratings, *rating)
+		}
+	}
+	sort.Slice(ratings, func(i, j int) bool {
+		return ratings[i].Difficulty < ratings[j].Difficulty
+	})
+	return ratings, nil
+}
+
+func (m *MemoryStore) SaveRating(ctx context.Context, rating *models.PlayerRating, games int) error {
+	m.ratingsMux.Lock()
+	defer m.ratingsMux.Unlock()
+	key := rating.UserID + ":" + string(rating.Difficulty)
+	stored, ok := m.ratings[key]
+	if (ok && stored.Games != games) || (!ok && games != 0) {
+		return ErrVersionConflict
+	}
+	saved := *rating
+	m.ratings[key] = &saved
+	return nil
+}
+
+func (m *MemoryStore) GetRatingBoard(ctx context.Context, difficulty models.Difficulty, offset, limit int) ([]models.PlayerRating, error) {
+	m.ratingsMux.RLock()
+	defer m.ratingsMux.RUnlock()
+	var board []models.PlayerRating
+	for _, rating := range m.ratings {
+		if rating.Difficulty == difficulty {
+			board = append(board, *rating)
+		}
+	}
+	sort.Slice(board, func(i, j int) bool {
+		if board[i].Rating != board[j].Rating {
+			return board[i].Rating > board[j].Rating
+		}
+		return board[i].Username < board[j].Username
+	})
+	if offset >= len(board) {
+		return []models.PlayerRating{}, nil
+	}
+	board = board[offset:]
+	if limit < len(board) {
+		board = board[:limit]
+	}
+	return board, nil
+}
+
+// Tournament methods
+
+func (m *MemoryStore) CreateTournament(ctx context.Context, tournament *models.Tournament) error {
+	m.tournamentsMux.Lock()
+	defer m.tournamentsMux.Unlock()
+	if _, ok := m.tournaments[tournament.ID]; ok {
+		return ErrDuplicate
+	}
+	m.tournaments[tournament.ID] = cloneTournament(tournament)
+	return nil
+}
+
+func (m *MemoryStore) GetTournament(ctx context.Context, id string) (*models.Tournament, error) {
+	m.tournamentsMux.RLock()
+	defer m.tournamentsMux.RUnlock()
+	tournament, ok := m.tournaments[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneTournament(tournament), nil
+}
+
+func (m *MemoryStore) UpdateTournament(ctx context.Context, tournament *models.Tournament) error {
+	m.tournamentsMux.Lock()
+	defer m.tournamentsMux.Unlock()
+	stored, ok := m.tournaments[tournament.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != tournament.Version {
+		return ErrVersionConflict
+	}
+	tournament.Version++
+	m.tournaments[tournament.ID] = cloneTournament(tournament)
+	return nil
+}
+
+func (m *MemoryStore) ListTournaments(ctx context.Context, offset, limit int) ([]models.Tournament, error) {
+	m.tournamentsMux.RLock()
+	tournaments := make([]models.Tournament, 0, len(m.tournaments))
+	for _, tournament := range m.tournaments {
+		tournaments = append(tournaments, *cloneTournament(tournament))
+	}
+	m.tournamentsMux.RUnlock()
+
+	sort.Slice(tournaments, func(i, j int) bool {
+		if !tournaments[i].CreatedAt.Equal(tournaments[j].CreatedAt) {
+			return tournaments[i].CreatedAt.After(tournaments[j].CreatedAt)
+		}
+		return tournaments[i].ID < tournaments[j].ID
+	})
+	if offset >= len(tournaments) {
+		return []models.Tournament{}, nil
+	}
+	tournaments = tournaments[offset:]
+	if limit < len(tournaments) {
+		tournaments = tournaments[:limit]
+	}
+	return tournaments, nil
+}
+
+// cloneTournament copies a tournament so callers never share it with the store
+func cloneTournament(tournament *models.Tournament) *models.Tournament {
+	clone := *tournament
+	clone.Eligible = append([]string(nil), tournament.Eligible...)
+	clone.Players = make([]models.TournamentPlayer, len(tournament.Players))
+	for i, player := range tournament.Players {
+		if player.CheckedInAt != nil {
+			checkedIn := *player.CheckedInAt
+			player.CheckedInAt = &checkedIn
+		}
+		clone.Players[i] = player
+	}
+	clone.Stages = make([]models.TournamentStage, len(tournament.Stages))
+	for i, stage := range tournament.Stages {
+		stage.Rounds = append([]models.PresetRound(nil), stage.Rounds...)
+		stage.Entries = append([]models.StageEntry(nil), stage.Entries...)
+		matches := make([]models.TournamentMatch, len(stage.Matches))
+		for j, match := range stage.Matches {
+			match.Players = append([]string(nil), match.Players...)
+			matches[j] = match
+		}
+		stage.Matches = matches
+		clone.Stages[i] = stage
+	}
+	return &clone
+}
+
+// Challenge methods
+
+func (m *MemoryStore) CreateChallenge(ctx context.Context, challenge *models.Challenge) error {
+	m.challengesMux.Lock()
+	defer m.challengesMux.Unlock()
+	if _, ok := m.challenges[challenge.ID]; ok {
+		return ErrDuplicate
+	}
+	m.challenges[challenge.ID] = cloneChallenge(challenge)
+	return nil
+}
+
+func (m *MemoryStore) GetChallenge(ctx context.Context, id string) (*models.Challenge, error) {
+	m.challengesMux.RLock()
+	defer m.challengesMux.RUnlock()
+	challenge, ok := m.challenges[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneChallenge(challenge), nil
+}
+
+func (m *MemoryStore) UpdateChallenge(ctx context.Context, challenge *models.Challenge) error {
+	m.challengesMux.Lock()
+	defer m.challengesMux.Unlock()
+	stored, ok := m.challenges[challenge.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != challenge.Version {
+		return ErrVersionConflict
+	}
+	challenge.Version++
+	m.challenges[challenge.ID] = cloneChallenge(challenge)
+	return nil
+}
+
+func (m *MemoryStore) ListChallenges(ctx context.Context, offset, limit int) ([]models.Challenge, error) {
+	m.challengesMux.RLock()
+	challenges := make([]models.Challenge, 0, len(m.challenges))
+	for _, challenge := range m.challenges {
+		challenges = append(challenges, *cloneChallenge(challenge))
+	}
+	m.challengesMux.RUnlock()
+
+	sort.Slice(challenges, func(i, j int) bool {
+		if !challenges[i].CreatedAt.Equal(challenges[j].CreatedAt) {
+			return challenges[i].CreatedAt.After(challenges[j].CreatedAt)
+		}
+		return challenges[i].ID < challenges[j].ID
+	})
+	if offset >= len(challenges) {
+		return []models.Challenge{}, nil
+	}
+	challenges = challenges[offset:]
+	if limit < len(challenges) {
+		challenges = challenges[:limit]
+	}
+	return challenges, nil
+}
+
+// cloneChallenge copies a challenge so callers never share it with the store
+func cloneChallenge(challenge *models.Challenge) *models.Challenge {
+	clone := *challenge
+	clone.Rounds = append([]models.PresetRound(nil), challenge.Rounds...)
+	clone.Attempts = make([]models.ChallengeAttempt, len(challenge.Attempts))
+	for i, attempt := range challenge.Attempts {
+		if attempt.FinishedAt != nil {
+			finished := *attempt.FinishedAt
+			attempt.FinishedAt = &finished
+		}
+		clone.Attempts[i] = attempt
+	}
+	return &clone
+}
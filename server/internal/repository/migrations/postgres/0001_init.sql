@@ -0,0 +1,49 @@
+-- Sessions, their rounds as rows, and the best score per player and difficulty
+
+CREATE TABLE IF NOT EXISTS game_sessions (
+	id               TEXT NOT NULL,
+	session_id       TEXT PRIMARY KEY,
+	user_id          TEXT NOT NULL DEFAULT '',
+	username         TEXT NOT NULL,
+	difficulty       TEXT NOT NULL,
+	status           TEXT NOT NULL,
+	total_score      INTEGER NOT NULL DEFAULT 0,
+	started_at       TIMESTAMPTZ NOT NULL,
+	ended_at         TIMESTAMPTZ,
+	last_activity_at TIMESTAMPTZ NOT NULL,
+	result           JSONB,
+	version          BIGINT NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_game_sessions_user ON game_sessions (user_id, started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_game_sessions_activity ON game_sessions (status, last_activity_at);
+
+CREATE TABLE IF NOT EXISTS game_rounds (
+	session_id     TEXT NOT NULL REFERENCES game_sessions (session_id) ON DELETE CASCADE,
+	round_number   INTEGER NOT NULL,
+	flight_id      TEXT NOT NULL,
+	token          TEXT NOT NULL,
+	flight         JSONB,
+	display        JSONB,
+	departure      TEXT NOT NULL,
+	actual_arrival TEXT NOT NULL,
+	player_guess   TEXT NOT NULL DEFAULT '',
+	points_earned  INTEGER NOT NULL DEFAULT 0,
+	guess_time     DOUBLE PRECISION NOT NULL DEFAULT 0,
+	confidence     INTEGER NOT NULL DEFAULT 0,
+	score          JSONB,
+	guess_key      TEXT NOT NULL DEFAULT '',
+	started_at     TIMESTAMPTZ NOT NULL,
+	completed_at   TIMESTAMPTZ,
+	PRIMARY KEY (session_id, round_number)
+);
+
+CREATE TABLE IF NOT EXISTS leaderboard (
+	id           TEXT NOT NULL,
+	username     TEXT NOT NULL,
+	difficulty   TEXT NOT NULL,
+	total_score  INTEGER NOT NULL,
+	games_played INTEGER NOT NULL,
+	updated_at   TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (username, difficulty)
+);
+CREATE INDEX IF NOT EXISTS idx_leaderboard_score ON leaderboard (difficulty, total_score DESC);
@@ -0,0 +1,15 @@
+-- Players' home country and airport, copied onto their scores for filtered leaderboards
+
+ALTER TABLE users ADD COLUMN home_country TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN home_airport TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE leaderboard ADD COLUMN country TEXT NOT NULL DEFAULT '';
+ALTER TABLE leaderboard ADD COLUMN airport TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_leaderboard_country ON leaderboard (difficulty, country, total_score DESC);
+CREATE INDEX IF NOT EXISTS idx_leaderboard_airport ON leaderboard (difficulty, airport, total_score DESC);
+
+ALTER TABLE score_records ADD COLUMN country TEXT NOT NULL DEFAULT '';
+ALTER TABLE score_records ADD COLUMN airport TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_score_records_username ON score_records (username);
+CREATE INDEX IF NOT EXISTS idx_score_records_country ON score_records (difficulty, country, played_at);
+CREATE INDEX IF NOT EXISTS idx_score_records_airport ON score_records (difficulty, airport, played_at);
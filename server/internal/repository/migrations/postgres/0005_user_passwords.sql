@@ -0,0 +1,3 @@
+-- Password hashes of registered players; guest profiles have none
+
+ALTER TABLE users ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+-- Accounts at external identity providers that players log in with
+
+CREATE TABLE IF NOT EXISTS user_identities (
+	provider  TEXT NOT NULL,
+	subject   TEXT NOT NULL,
+	user_id   TEXT NOT NULL,
+	email     TEXT NOT NULL DEFAULT '',
+	linked_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (provider, subject)
+);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities (user_id);
@@ -0,0 +1,5 @@
+-- Players' experience and level, and their experience when each game started
+
+ALTER TABLE users ADD COLUMN xp INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN level INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE game_sessions ADD COLUMN start_xp INTEGER;
@@ -0,0 +1,14 @@
+-- Each player's Glicko-2 skill rating per difficulty
+
+CREATE TABLE IF NOT EXISTS ratings (
+	user_id    TEXT NOT NULL,
+	username   TEXT NOT NULL,
+	difficulty TEXT NOT NULL,
+	rating     DOUBLE PRECISION NOT NULL,
+	rd         DOUBLE PRECISION NOT NULL,
+	volatility DOUBLE PRECISION NOT NULL,
+	games      INTEGER NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (user_id, difficulty)
+);
+CREATE INDEX IF NOT EXISTS idx_ratings_board ON ratings (difficulty, rating DESC, username);
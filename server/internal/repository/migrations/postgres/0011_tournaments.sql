@@ -0,0 +1,11 @@
+-- Tournaments as JSON documents, and the tournament each game was played in
+
+CREATE TABLE IF NOT EXISTS tournaments (
+	id         TEXT PRIMARY KEY,
+	data       JSONB NOT NULL,
+	version    INTEGER NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_tournaments_created ON tournaments (created_at DESC);
+
+ALTER TABLE game_sessions ADD COLUMN tournament_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Challenges are listed newest first when their flights are held back on start
+
+CREATE INDEX IF NOT EXISTS idx_challenges_created ON challenges (created_at DESC);
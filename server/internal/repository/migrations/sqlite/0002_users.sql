@@ -0,0 +1,11 @@
+-- Registered players
+CREATE TABLE IF NOT EXISTS users (
+	id           TEXT PRIMARY KEY,
+	username     TEXT NOT NULL UNIQUE,
+	email        TEXT NOT NULL DEFAULT '',
+	created_at   TIMESTAMP NOT NULL,
+	games_played INTEGER NOT NULL DEFAULT 0,
+	total_score  INTEGER NOT NULL DEFAULT 0,
+	avg_score    INTEGER NOT NULL DEFAULT 0,
+	best_score   INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,23 @@
+-- The score of every finished game, for leaderboards over time windows,
+-- and archived winners of past windows
+
+CREATE TABLE IF NOT EXISTS score_records (
+	session_id TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL DEFAULT '',
+	username   TEXT NOT NULL,
+	difficulty TEXT NOT NULL,
+	score      INTEGER NOT NULL,
+	played_at  TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_score_records_window ON score_records (difficulty, played_at);
+CREATE INDEX IF NOT EXISTS idx_score_records_played ON score_records (played_at);
+
+CREATE TABLE IF NOT EXISTS leaderboard_snapshots (
+	window_name  TEXT NOT NULL,
+	difficulty   TEXT NOT NULL,
+	period_start TIMESTAMP NOT NULL,
+	period_end   TIMESTAMP NOT NULL,
+	entries      TEXT NOT NULL,
+	created_at   TIMESTAMP NOT NULL,
+	PRIMARY KEY (window_name, difficulty, period_start)
+);
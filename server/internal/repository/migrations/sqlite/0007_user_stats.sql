@@ -0,0 +1,3 @@
+-- Lifetime stats beyond the totals in their own columns, as JSON
+
+ALTER TABLE users ADD COLUMN stats TEXT NOT NULL DEFAULT '{}';
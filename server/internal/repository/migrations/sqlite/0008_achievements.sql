@@ -0,0 +1,7 @@
+-- Each player's unlocked achievements and progress towards the others, as JSON
+
+CREATE TABLE IF NOT EXISTS achievements (
+	user_id TEXT PRIMARY KEY,
+	data    TEXT NOT NULL,
+	version INTEGER NOT NULL
+);
@@ -0,0 +1,14 @@
+-- Each player's Glicko-2 skill rating per difficulty
+
+CREATE TABLE IF NOT EXISTS ratings (
+	user_id    TEXT NOT NULL,
+	username   TEXT NOT NULL,
+	difficulty TEXT NOT NULL,
+	rating     REAL NOT NULL,
+	rd         REAL NOT NULL,
+	volatility REAL NOT NULL,
+	games      INTEGER NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (user_id, difficulty)
+);
+CREATE INDEX IF NOT EXISTS idx_ratings_board ON ratings (difficulty, rating DESC, username);
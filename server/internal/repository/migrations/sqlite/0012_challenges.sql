@@ -0,0 +1,10 @@
+-- Challenges as JSON documents, and the challenge each game took up
+
+CREATE TABLE IF NOT EXISTS challenges (
+	id         TEXT PRIMARY KEY,
+	data       TEXT NOT NULL,
+	version    INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE game_sessions ADD COLUMN challenge_id TEXT NOT NULL DEFAULT '';
@@ -18,6 +18,17 @@ type MongoRepository struct {
 	sessions *mongo.Collection
 	users    *mongo.Collection
 	scores   *mongo.Collection
+	// records holds each finished game's score; snapshots archives past leaderboard periods
+	records   *mongo.Collection
+	snapshots *mongo.Collection
+	// achievements holds each player's unlocked achievements and progress
+	achievements *mongo.Collection
+	// ratings holds each player's skill rating per difficulty
+	ratings *mongo.Collection
+	// tournaments holds each tournament with its stages and players
+	tournaments *mongo.Collection
+	// challenges holds each challenge with its pinned flights and attempts
+	challenges *mongo.Collection
 }
 
 func NewMongoRepository(uri, dbName string) (*MongoRepository, error) {
@@ -38,11 +49,18 @@ func NewMongoRepository(uri, dbName string) (*MongoRepository, error) {
 	db := client.Database(dbName)
 
 	repo := &MongoRepository{
-		client:   client,
-		db:       db,
-		sessions: db.Collection("game_sessions"),
-		users:    db.Collection("users"),
-		scores:   db.Collection("leaderboard"),
+		client:    client,
+		db:        db,
+		sessions:  db.Collection("game_sessions"),
+		users:     db.Collection("users"),
+		scores:    db.Collection("leaderboard"),
+		records:   db.Collection("score_records"),
+		snapshots: db.Collection("leaderboard_snapshots"),
+
+		achievements: db.Collection("achievements"),
+		ratings:      db.Collection("ratings"),
+		tournaments:  db.Collection("tournaments"),
+		challenges:   db.Collection("challenges"),
 	}
 
 	// Create indexes
@@ -60,6 +78,20 @@ func (r *MongoRepository) createIndexes(ctx context.Context) error {
 		{Keys: bson.D{{Key: "userId", Value: 1}}},
 		{Keys: bson.D{{Key: "difficulty", Value: 1}}},
 		{Keys: bson.D{{Key: "startedAt", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "lastActivityAt", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Users collection indexes
+	_, err = r.users.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "username", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{
+			Keys: bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"identities.subject": bson.M{"$exists": true}}),
+		},
 	})
 	if err != nil {
 		return err
@@ -67,8 +99,72 @@ func (r *MongoRepository) createIndexes(ctx context.Context) error {
 
 	// Leaderboard collection indexes
 	_, err = r.scores.Indexes().CreateMany(ctx, []mongo.IndexModel{
-		{Keys: bson.D{{Key: "difficulty", Value: 1}, {Key: "totalScore", Value: -1}}},
+		{Keys: bson.D{{Key: "difficulty", Value: 1}, {Key: "totalScore", Value: -1}, {Key: "username", Value: 1}}},
 		{Keys: bson.D{{Key: "username", Value: 1}, {Key: "difficulty", Value: 1}}},
+		{Keys: bson.D{{Key: "difficulty", Value: 1}, {Key: "country", Value: 1}, {Key: "totalScore", Value: -1}}},
+		{Keys: bson.D{{Key: "difficulty", Value: 1}, {Key: "airport", Value: 1}, {Key: "totalScore", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Score record indexes
+	_, err = r.records.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "sessionId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "difficulty", Value: 1}, {Key: "playedAt", Value: -1}}},
+		{Keys: bson.D{{Key: "playedAt", Value: -1}}},
+		{Keys: bson.D{{Key: "username", Value: 1}}},
+		{Keys: bson.D{{Key: "difficulty", Value: 1}, {Key: "country", Value: 1}, {Key: "playedAt", Value: -1}}},
+		{Keys: bson.D{{Key: "difficulty", Value: 1}, {Key: "airport", Value: 1}, {Key: "playedAt", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Leaderboard snapshot indexes
+	_, err = r.snapshots.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "window", Value: 1}, {Key: "difficulty", Value: 1}, {Key: "periodStart", Value: -1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Achievements collection indexes
+	_, err = r.achievements.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}}, Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Ratings collection indexes
+	_, err = r.ratings.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "difficulty", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "difficulty", Value: 1}, {Key: "rating", Value: -1}, {Key: "username", Value: 1}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Tournaments collection indexes
+	_, err = r.tournaments.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "createdAt", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Challenges collection indexes
+	_, err = r.challenges.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "createdAt", Value: -1}},
 	})
 	if err != nil {
 		return err
@@ -94,23 +190,65 @@ func (r *MongoRepository) CreateSession(ctx context.Context, session *models.Gam
 func (r *MongoRepository) GetSession(ctx context.Context, sessionID string) (*models.GameSession, error) {
 	var session models.GameSession
 	err := r.sessions.FindOne(ctx, bson.M{"sessionId": sessionID}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 	return &session, nil
 }
 
+// UpdateSession replaces a session only if its stored version matches the one
+// that was read, then bumps the version. It returns ErrVersionConflict otherwise.
 func (r *MongoRepository) UpdateSession(ctx context.Context, session *models.GameSession) error {
-	_, err := r.sessions.ReplaceOne(
-		ctx,
-		bson.M{"sessionId": session.SessionID},
-		session,
-	)
-	return err
+	filter := bson.M{"sessionId": session.SessionID, "version": session.Version}
+	if session.Version == 0 {
+		// Sessions created before versioning have no version field
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	session.Version++
+	result, err := r.sessions.ReplaceOne(ctx, filter, session)
+	if err != nil {
+		session.Version--
+		return err
+	}
+	if result.MatchedCount == 0 {
+		session.Version--
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// FindIdleSessions returns in-progress sessions with no activity since cutoff
+func (r *MongoRepository) FindIdleSessions(ctx context.Context, cutoff time.Time) ([]models.GameSession, error) {
+	filter := bson.M{
+		"status": models.SessionInProgress,
+		"$or": bson.A{
+			bson.M{"lastActivityAt": bson.M{"$lt": cutoff}},
+			// Sessions created before activity tracking
+			bson.M{"lastActivityAt": bson.M{"$exists": false}, "startedAt": bson.M{"$lt": cutoff}},
+		},
+	}
+	cursor, err := r.sessions.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []models.GameSession
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
 }
 
-func (r *MongoRepository) GetUserSessions(ctx context.Context, userID string, limit int) ([]models.GameSession, error) {
-	opts := options.Find().SetSort(bson.D{{Key: "startedAt", Value: -1}}).SetLimit(int64(limit))
+func (r *MongoRepository) GetUserSessions(ctx context.Context, userID string, offset, limit int) ([]models.GameSession, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "startedAt", Value: -1}, {Key: "sessionId", Value: 1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
 	cursor, err := r.sessions.Find(ctx, bson.M{"userId": userID}, opts)
 	if err != nil {
 		return nil, err
@@ -124,74 +262,432 @@ func (r *MongoRepository) GetUserSessions(ctx context.Context, userID string, li
 	return sessions, nil
 }
 
+func (r *MongoRepository) ListFinishedSessions(ctx context.Context, after SessionCursor, limit int) ([]models.GameSession, error) {
+	filter := bson.M{
+		"status":  bson.M{"$ne": models.SessionInProgress},
+		"endedAt": bson.M{"$ne": nil},
+		"$or": bson.A{
+			bson.M{"endedAt": bson.M{"$gt": after.EndedAt}},
+			bson.M{"endedAt": after.EndedAt, "sessionId": bson.M{"$gt": after.SessionID}},
+		},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "endedAt", Value: 1}, {Key: "sessionId", Value: 1}}).
+		SetLimit(int64(limit))
+	cursor, err := r.sessions.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []models.GameSession
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// User methods
+
+func (r *MongoRepository) CreateUser(ctx context.Context, user *models.User) error {
+	user.ID = primitive.NewObjectID()
+	_, err := r.users.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *MongoRepository) GetUser(ctx context.Context, id string) (*models.User, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return r.findUser(ctx, bson.M{"_id": objectID})
+}
+
+func (r *MongoRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.findUser(ctx, bson.M{"username": username})
+}
+
+func (r *MongoRepository) GetUserByIdentity(ctx context.Context, provider, subject string) (*models.User, error) {
+	return r.findUser(ctx, bson.M{"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}}})
+}
+
+func (r *MongoRepository) UpdateUser(ctx context.Context, user *models.User) error {
+	data, err := bson.Marshal(user)
+	if err != nil {
+		return err
+	}
+	var fields bson.M
+	if err := bson.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	// Identities, stats and progression have their own updates
+	delete(fields, "_id")
+	delete(fields, "identities")
+	delete(fields, "stats")
+	delete(fields, "progression")
+	unset := bson.M{}
+	for _, optional := range []string{"email", "homeCountry", "homeAirport", "passwordHash"} {
+		if _, ok := fields[optional]; !ok {
+			unset[optional] = ""
+		}
+	}
+	update := bson.M{"$set": fields}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	result, err := r.users.UpdateOne(ctx, bson.M{"_id": user.ID}, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoRepository) UpdateUserStats(ctx context.Context, userID string, stats models.UserStats, gamesPlayed int) error {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrNotFound
+	}
+	result, err := r.users.UpdateOne(ctx,
+		bson.M{"_id": objectID, "stats.gamesPlayed": gamesPlayed},
+		bson.M{"$set": bson.M{"stats": stats}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		count, err := r.users.CountDocuments(ctx, bson.M{"_id": objectID})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+func (r *MongoRepository) UpdateUserProgression(ctx context.Context, userID string, progression models.Progression, xp int) error {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrNotFound
+	}
+	filter := bson.M{"_id": objectID, "progression.xp": xp}
+	if xp == 0 {
+		// Users from before progression have none
+		filter["progression.xp"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	result, err := r.users.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"progression": progression}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		count, err := r.users.CountDocuments(ctx, bson.M{"_id": objectID})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+func (r *MongoRepository) LinkIdentity(ctx context.Context, userID string, identity models.UserIdentity) error {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrNotFound
+	}
+	// The unique index only stops other users linking the identity
+	if _, err := r.GetUserByIdentity(ctx, identity.Provider, identity.Subject); err == nil {
+		return ErrDuplicate
+	} else if err != ErrNotFound {
+		return err
+	}
+
+	result, err := r.users.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$push": bson.M{"identities": identity}})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoRepository) findUser(ctx context.Context, filter bson.M) (*models.User, error) {
+	var user models.User
+	err := r.users.FindOne(ctx, filter).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 // Leaderboard methods
 
+// SaveScore stores a finished game's score record, then updates the leaderboard in
+// a single atomic upsert keeping the best score per username and difficulty
 func (r *MongoRepository) SaveScore(ctx context.Context, session *models.GameSession) error {
+	var home models.User
+	err := r.users.FindOne(ctx, bson.M{"username": session.Username},
+		options.FindOne().SetProjection(bson.M{"homeCountry": 1, "homeAirport": 1})).Decode(&home)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	record := newScoreRecord(session, home.HomeCountry, home.HomeAirport)
+	var previous models.ScoreRecord
+	err = r.records.FindOneAndReplace(ctx, bson.M{"sessionId": record.SessionID}, record,
+		options.FindOneAndReplace().SetUpsert(true).SetReturnDocument(options.Before)).Decode(&previous)
+	gamesPlayed := 1
+	switch {
+	case err == mongo.ErrNoDocuments:
+	case err != nil:
+		return err
+	case !newGame(&previous, record):
+		gamesPlayed = 0
+	}
+
 	filter := bson.M{
 		"username":   session.Username,
 		"difficulty": session.Difficulty,
 	}
+	update := bson.M{
+		"$inc": bson.M{"gamesPlayed": gamesPlayed},
+		"$max": bson.M{"totalScore": session.TotalScore},
+		"$set": bson.M{"updatedAt": time.Now(), "country": home.HomeCountry, "airport": home.HomeAirport},
+	}
 
-	// Check if user already has a score for this difficulty
-	var existing models.LeaderboardEntry
-	err := r.scores.FindOne(ctx, filter).Decode(&existing)
+	_, err = r.scores.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
 
-	if err == mongo.ErrNoDocuments {
-		// Create new entry
-		entry := models.LeaderboardEntry{
-			ID:          primitive.NewObjectID(),
-			Username:    session.Username,
-			Difficulty:  session.Difficulty,
-			TotalScore:  session.TotalScore,
-			GamesPlayed: 1,
-			UpdatedAt:   time.Now(),
-		}
-		_, err = r.scores.InsertOne(ctx, entry)
+func (r *MongoRepository) UpdatePlayerHome(ctx context.Context, username, country, airport string) error {
+	update := bson.M{"$set": bson.M{"country": country, "airport": airport}}
+	if _, err := r.scores.UpdateMany(ctx, bson.M{"username": username}, update); err != nil {
 		return err
 	}
+	_, err := r.records.UpdateMany(ctx, bson.M{"username": username}, update)
+	return err
+}
+
+func (r *MongoRepository) GetLeaderboard(ctx context.Context, query LeaderboardQuery) ([]models.LeaderboardEntry, error) {
+	collection, pipeline := r.rankedPipeline(query)
+	if query.After != nil {
+		cursor := query.After
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"totalScore": bson.M{"$lt": cursor.TotalScore}},
+			bson.M{"totalScore": cursor.TotalScore, "username": bson.M{"$gt": cursor.Username}},
+			bson.M{"totalScore": cursor.TotalScore, "username": cursor.Username, "difficulty": bson.M{"$gt": cursor.Difficulty}},
+		}}}})
+	} else if query.Offset > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: query.Offset}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$limit", Value: query.Limit}})
 
+	ranked, err := r.aggregateRanked(ctx, collection, pipeline)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return rankedEntries(ranked, query.Ranking), nil
+}
 
-	// Update if new score is higher
-	update := bson.M{
-		"$inc": bson.M{"gamesPlayed": 1},
-		"$set": bson.M{"updatedAt": time.Now()},
+func (r *MongoRepository) GetScore(ctx context.Context, username string, difficulty models.Difficulty) (*models.LeaderboardEntry, error) {
+	var entry models.LeaderboardEntry
+	err := r.scores.FindOne(ctx, bson.M{
+		"username":   username,
+		"difficulty": difficulty,
+	}).Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
 	}
-	if session.TotalScore > existing.TotalScore {
-		update["$set"].(bson.M)["totalScore"] = session.TotalScore
+	if err != nil {
+		return nil, err
 	}
+	return &entry, nil
+}
 
-	_, err = r.scores.UpdateOne(ctx, filter, update)
-	return err
+func (r *MongoRepository) GetScoresAround(ctx context.Context, query LeaderboardQuery, username string, radius int) ([]models.LeaderboardEntry, error) {
+	user, err := r.rankedEntry(ctx, query, username)
+	if err != nil {
+		return nil, err
+	}
+
+	collection, pipeline := r.rankedPipeline(query)
+	pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{
+		"position": bson.M{"$gte": user.Position - int64(radius), "$lte": user.Position + int64(radius)},
+	}}})
+	ranked, err := r.aggregateRanked(ctx, collection, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	return rankedEntries(ranked, query.Ranking), nil
+}
+
+func (r *MongoRepository) GetScoreStanding(ctx context.Context, query LeaderboardQuery, username string) (higher, equal, total int64, err error) {
+	user, err := r.rankedEntry(ctx, query, username)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	higher, equal, total = user.standing()
+	return higher, equal, total, nil
 }
 
-func (r *MongoRepository) GetLeaderboard(ctx context.Context, difficulty models.Difficulty, limit int) ([]models.LeaderboardEntry, error) {
-	opts := options.Find().SetSort(bson.D{{Key: "totalScore", Value: -1}}).SetLimit(int64(limit))
+// rankedPipeline builds the aggregation that ranks the whole board a query
+// selects, in board order. All-time boards read the leaderboard collection;
+// windowed boards group the score records played in the window by player.
+func (r *MongoRepository) rankedPipeline(query LeaderboardQuery) (*mongo.Collection, mongo.Pipeline) {
+	collection := r.scores
+	var pipeline mongo.Pipeline
+
+	if query.windowed() {
+		collection = r.records
+		match := homeFilter(query)
+		match["playedAt"] = bson.M{"$gte": query.Since, "$lt": query.Until}
+		pipeline = append(pipeline,
+			bson.D{{Key: "$match", Value: match}},
+			bson.D{{Key: "$group", Value: bson.M{
+				"_id":         bson.M{"username": "$username", "difficulty": "$difficulty"},
+				"totalScore":  bson.M{"$max": "$score"},
+				"gamesPlayed": bson.M{"$sum": 1},
+				"updatedAt":   bson.M{"$max": "$playedAt"},
+				// A player's records all carry their current home
+				"country": bson.M{"$max": "$country"},
+				"airport": bson.M{"$max": "$airport"},
+			}}},
+			bson.D{{Key: "$project", Value: bson.M{
+				"_id":         0,
+				"username":    "$_id.username",
+				"difficulty":  "$_id.difficulty",
+				"totalScore":  1,
+				"gamesPlayed": 1,
+				"updatedAt":   1,
+				"country":     1,
+				"airport":     1,
+			}}},
+		)
+	} else if match := homeFilter(query); len(match) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: match}})
+	}
+
+	pipeline = append(pipeline,
+		bson.D{{Key: "$setWindowFields", Value: bson.M{
+			"partitionBy": "$totalScore",
+			"output":      bson.M{"ties": bson.M{"$count": bson.M{}}},
+		}}},
+		bson.D{{Key: "$setWindowFields", Value: bson.M{
+			"sortBy": bson.M{"totalScore": -1},
+			"output": bson.M{
+				"competitionRank": bson.M{"$rank": bson.M{}},
+				"denseRank":       bson.M{"$denseRank": bson.M{}},
+				"entries": bson.M{
+					"$count": bson.M{},
+					"window": bson.M{"documents": bson.A{"unbounded", "unbounded"}},
+				},
+			},
+		}}},
+		bson.D{{Key: "$setWindowFields", Value: bson.M{
+			"sortBy": bson.D{{Key: "totalScore", Value: -1}, {Key: "username", Value: 1}, {Key: "difficulty", Value: 1}},
+			"output": bson.M{"position": bson.M{"$documentNumber": bson.M{}}},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "position", Value: 1}}}},
+	)
+	return collection, pipeline
+}
 
-	filter := bson.M{}
-	if difficulty != "" {
-		filter["difficulty"] = difficulty
+// homeFilter matches the difficulty, country and airport a query selects
+func homeFilter(query LeaderboardQuery) bson.M {
+	match := bson.M{}
+	if query.Difficulty != "" {
+		match["difficulty"] = query.Difficulty
+	}
+	if query.Country != "" {
+		match["country"] = query.Country
 	}
+	if query.Airport != "" {
+		match["airport"] = query.Airport
+	}
+	return match
+}
 
-	cursor, err := r.scores.Find(ctx, filter, opts)
+func (r *MongoRepository) GetCountryLeaderboard(ctx context.Context, query LeaderboardQuery, top int) ([]models.CountryEntry, error) {
+	collection, pipeline := r.rankedPipeline(query)
+	pipeline = append(pipeline,
+		bson.D{{Key: "$match", Value: bson.M{"country": bson.M{"$nin": bson.A{"", nil}}}}},
+		bson.D{{Key: "$setWindowFields", Value: bson.M{
+			"partitionBy": "$country",
+			"sortBy":      bson.M{"position": 1},
+			"output":      bson.M{"countryPosition": bson.M{"$documentNumber": bson.M{}}},
+		}}},
+		bson.D{{Key: "$match", Value: bson.M{"countryPosition": bson.M{"$lte": top}}}},
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":          "$country",
+			"players":      bson.M{"$sum": 1},
+			"averageScore": bson.M{"$avg": "$totalScore"},
+		}}},
+		bson.D{{Key: "$project", Value: bson.M{"_id": 0, "country": "$_id", "players": 1, "averageScore": 1}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "averageScore", Value: -1}, {Key: "country", Value: 1}}}},
+		bson.D{{Key: "$limit", Value: query.Limit}},
+	)
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
 	defer cursor.Close(ctx)
 
-	var entries []models.LeaderboardEntry
-	if err := cursor.All(ctx, &entries); err != nil {
+	countries := []models.CountryEntry{}
+	if err := cursor.All(ctx, &countries); err != nil {
+		return nil, err
+	}
+	rankCountries(countries)
+	return countries, nil
+}
+
+// rankedEntry returns a user's entry on the board a query selects
+func (r *MongoRepository) rankedEntry(ctx context.Context, query LeaderboardQuery, username string) (*rankedEntry, error) {
+	collection, pipeline := r.rankedPipeline(query)
+	pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"username": username}}}, bson.D{{Key: "$limit", Value: 1}})
+	ranked, err := r.aggregateRanked(ctx, collection, pipeline)
+	if err != nil {
 		return nil, err
 	}
+	if len(ranked) == 0 {
+		return nil, ErrNotFound
+	}
+	return &ranked[0], nil
+}
 
-	// Assign ranks
-	for i := range entries {
-		entries[i].Rank = i + 1
+func (r *MongoRepository) aggregateRanked(ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline) ([]rankedEntry, error) {
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
 	}
+	defer cursor.Close(ctx)
 
-	return entries, nil
+	var ranked []rankedEntry
+	if err := cursor.All(ctx, &ranked); err != nil {
+		return nil, err
+	}
+	return ranked, nil
 }
 
 func (r *MongoRepository) GetUserRank(ctx context.Context, username string, difficulty models.Difficulty) (int, error) {
@@ -201,6 +697,9 @@ func (r *MongoRepository) GetUserRank(ctx context.Context, username string, diff
 		"username":   username,
 		"difficulty": difficulty,
 	}).Decode(&userEntry)
+	if err == mongo.ErrNoDocuments {
+		return 0, ErrNotFound
+	}
 	if err != nil {
 		return 0, err
 	}
@@ -216,3 +715,220 @@ func (r *MongoRepository) GetUserRank(ctx context.Context, username string, diff
 
 	return int(count) + 1, nil
 }
+
+// Leaderboard archive methods
+
+func (r *MongoRepository) SaveSnapshot(ctx context.Context, snapshot *models.LeaderboardSnapshot) error {
+	_, err := r.snapshots.InsertOne(ctx, snapshot)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *MongoRepository) GetSnapshots(ctx context.Context, window models.LeaderboardWindow, difficulty models.Difficulty, limit int) ([]models.LeaderboardSnapshot, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "periodStart", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := r.snapshots.Find(ctx, bson.M{"window": window, "difficulty": difficulty}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var snapshots []models.LeaderboardSnapshot
+	if err := cursor.All(ctx, &snapshots); err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// Achievement methods
+
+func (r *MongoRepository) GetAchievements(ctx context.Context, userID string) (*models.PlayerAchievements, error) {
+	var achievements models.PlayerAchievements
+	err := r.achievements.FindOne(ctx, bson.M{"userId": userID}).Decode(&achievements)
+	if err == mongo.ErrNoDocuments {
+		return &models.PlayerAchievements{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &achievements, nil
+}
+
+func (r *MongoRepository) SaveAchievements(ctx context.Context, achievements *models.PlayerAchievements) error {
+	achievements.Version++
+	var err error
+	if achievements.Version == 1 {
+		// The unique index on userId stops a concurrent first save
+		_, err = r.achievements.InsertOne(ctx, achievements)
+		if mongo.IsDuplicateKeyError(err) {
+			err = ErrVersionConflict
+		}
+	} else {
+		var result *mongo.UpdateResult
+		result, err = r.achievements.ReplaceOne(ctx,
+			bson.M{"userId": achievements.UserID, "version": achievements.Version - 1}, achievements)
+		if err == nil && result.MatchedCount == 0 {
+			err = ErrVersionConflict
+		}
+	}
+	if err != nil {
+		achievements.Version--
+	}
+	return err
+}
+
+// Rating methods
+
+func (r *MongoRepository) GetRatings(ctx context.Context, userID string) ([]models.PlayerRating, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "difficulty", Value: 1}})
+	return r.findRatings(ctx, bson.M{"userId": userID}, opts)
+}
+
+func (r *MongoRepository) SaveRating(ctx context.Context, rating *models.PlayerRating, games int) error {
+	if games == 0 {
+		// The unique index on userId and difficulty stops a concurrent first save
+		_, err := r.ratings.InsertOne(ctx, rating)
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrVersionConflict
+		}
+		return err
+	}
+	result, err := r.ratings.ReplaceOne(ctx,
+		bson.M{"userId": rating.UserID, "difficulty": rating.Difficulty, "games": games}, rating)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+func (r *MongoRepository) GetRatingBoard(ctx context.Context, difficulty models.Difficulty, offset, limit int) ([]models.PlayerRating, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "rating", Value: -1}, {Key: "username", Value: 1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	return r.findRatings(ctx, bson.M{"difficulty": difficulty}, opts)
+}
+
+func (r *MongoRepository) findRatings(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.PlayerRating, error) {
+	cursor, err := r.ratings.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	ratings := []models.PlayerRating{}
+	if err := cursor.All(ctx, &ratings); err != nil {
+		return nil, err
+	}
+	return ratings, nil
+}
+
+// Tournament methods
+
+func (r *MongoRepository) CreateTournament(ctx context.Context, tournament *models.Tournament) error {
+	_, err := r.tournaments.InsertOne(ctx, tournament)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *MongoRepository) GetTournament(ctx context.Context, id string) (*models.Tournament, error) {
+	var tournament models.Tournament
+	err := r.tournaments.FindOne(ctx, bson.M{"_id": id}).Decode(&tournament)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tournament, nil
+}
+
+func (r *MongoRepository) UpdateTournament(ctx context.Context, tournament *models.Tournament) error {
+	tournament.Version++
+	result, err := r.tournaments.ReplaceOne(ctx,
+		bson.M{"_id": tournament.ID, "version": tournament.Version - 1}, tournament)
+	if err == nil && result.MatchedCount == 0 {
+		err = ErrVersionConflict
+	}
+	if err != nil {
+		tournament.Version--
+	}
+	return err
+}
+
+func (r *MongoRepository) ListTournaments(ctx context.Context, offset, limit int) ([]models.Tournament, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cursor, err := r.tournaments.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tournaments := []models.Tournament{}
+	if err := cursor.All(ctx, &tournaments); err != nil {
+		return nil, err
+	}
+	return tournaments, nil
+}
+
+// Challenge methods
+
+func (r *MongoRepository) CreateChallenge(ctx context.Context, challenge *models.Challenge) error {
+	_, err := r.challenges.InsertOne(ctx, challenge)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *MongoRepository) GetChallenge(ctx context.Context, id string) (*models.Challenge, error) {
+	var challenge models.Challenge
+	err := r.challenges.FindOne(ctx, bson.M{"_id": id}).Decode(&challenge)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func (r *MongoRepository) UpdateChallenge(ctx context.Context, challenge *models.Challenge) error {
+	challenge.Version++
+	result, err := r.challenges.ReplaceOne(ctx,
+		bson.M{"_id": challenge.ID, "version": challenge.Version - 1}, challenge)
+	if err == nil && result.MatchedCount == 0 {
+		err = ErrVersionConflict
+	}
+	if err != nil {
+		challenge.Version--
+	}
+	return err
+}
+
+func (r *MongoRepository) ListChallenges(ctx context.Context, offset, limit int) ([]models.Challenge, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cursor, err := r.challenges.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	challenges := []models.Challenge{}
+	if err := cursor.All(ctx, &challenges); err != nil {
+		return nil, err
+	}
+	return challenges, nil
+}
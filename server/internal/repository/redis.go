@@ -8,6 +8,7 @@ import (
 
 	"github.com/redis/go-redis/v9"
 	"github.com/skyquest/server/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 const (
@@ -85,9 +86,12 @@ func (r *RedisClient) InvalidateFlightsCache(ctx context.Context) error {
 }
 
 // Session caching for active games
+//
+// Sessions are encoded as BSON rather than JSON so that fields hidden from
+// API responses (version, guess keys) survive the round trip.
 
 func (r *RedisClient) CacheSession(ctx context.Context, sessionID string, session *models.GameSession, ttl time.Duration) error {
-	data, err := json.Marshal(session)
+	data, err := bson.Marshal(session)
 	if err != nil {
 		return err
 	}
@@ -104,7 +108,7 @@ func (r *RedisClient) GetCachedSession(ctx context.Context, sessionID string) (*
 	}
 
 	var session models.GameSession
-	if err := json.Unmarshal(data, &session); err != nil {
+	if err := bson.Unmarshal(data, &session); err != nil {
 		return nil, err
 	}
 	return &session, nil
@@ -0,0 +1,440 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/skyquest/server/internal/models"
+)
+
+// Leaderboard index metrics, published on /debug/vars
+var (
+	leaderboardIndexErrors = expvar.NewInt("leaderboard_index_errors_total")
+	leaderboardRebuilds    = expvar.NewInt("leaderboard_rebuilds_total")
+)
+
+const (
+	leaderboardEntriesKey = "leaderboard:entries"
+	// Every board currently uses the standard game preset over all time
+	defaultPreset = "standard"
+	allTimeWindow = "all"
+	// leaderboardRebuildBackoff is the minimum time between attempts to rebuild a stale index
+	leaderboardRebuildBackoff = 30 * time.Second
+)
+
+// RedisLeaderboardStore ranks the leaderboard with Redis sorted sets, keyed by
+// difficulty, preset and time window, with further sets for the players of
+// each home country and airport. The durable store stays the source of
+// truth: scores are saved there first and then indexed, and the index is
+// rebuilt from it on start.
+//
+// Scores are stored negated so that ascending order is score descending, then
+// member ascending - the same order the durable stores use. The index serves
+// all-time boards with competition ranking read by offset, filtered by country
+// or airport but not both; other queries, and
+// every read while the index is stale (not yet built, or a write to it
+// failed), go to the durable store.
+type RedisLeaderboardStore struct {
+	LeaderboardStore
+	redis       *RedisClient
+	stale       atomic.Bool
+	lastRebuild atomic.Int64 // UnixNano of the last rebuild attempt
+}
+
+func NewRedisLeaderboardStore(store LeaderboardStore, redisClient *RedisClient) *RedisLeaderboardStore {
+	r := &RedisLeaderboardStore{
+		LeaderboardStore: store,
+		redis:            redisClient,
+	}
+	r.stale.Store(true)
+	return r
+}
+
+// leaderboardKey names the sorted set for a board; an empty difficulty is the
+// board across all difficulties
+func leaderboardKey(difficulty models.Difficulty, preset, window string) string {
+	d := string(difficulty)
+	if d == "" {
+		d = "all"
+	}
+	return fmt.Sprintf("leaderboard:%s:%s:%s", d, preset, window)
+}
+
+// boardKey names the sorted set for a query's board
+func boardKey(query LeaderboardQuery) string {
+	key := leaderboardKey(query.Difficulty, defaultPreset, allTimeWindow)
+	switch {
+	case query.Country != "":
+		return key + ":country:" + query.Country
+	case query.Airport != "":
+		return key + ":airport:" + query.Airport
+	}
+	return key
+}
+
+// entryKeys names every sorted set an entry belongs in
+func entryKeys(entry *models.LeaderboardEntry) []string {
+	var keys []string
+	for _, difficulty := range []models.Difficulty{entry.Difficulty, ""} {
+		keys = append(keys, boardKey(LeaderboardQuery{Difficulty: difficulty}))
+		if entry.Country != "" {
+			keys = append(keys, boardKey(LeaderboardQuery{Difficulty: difficulty, Country: entry.Country}))
+		}
+		if entry.Airport != "" {
+			keys = append(keys, boardKey(LeaderboardQuery{Difficulty: difficulty, Airport: entry.Airport}))
+		}
+	}
+	return keys
+}
+
+// leaderboardMember names an entry in the sorted sets. Members sort by
+// username, then difficulty, to break ties as the durable stores do; the NUL
+// separator sorts before any character of a username, so "ann" still comes
+// before "anna".
+func leaderboardMember(username string, difficulty models.Difficulty) string {
+	return username + "\x00" + string(difficulty)
+}
+
+// Rebuild replaces the index with the durable store's entries
+func (r *RedisLeaderboardStore) Rebuild(ctx context.Context) error {
+	r.lastRebuild.Store(time.Now().UnixNano())
+	leaderboardRebuilds.Add(1)
+
+	entries, err := r.LeaderboardStore.GetLeaderboard(ctx, LeaderboardQuery{Limit: math.MaxInt32})
+	if err != nil {
+		return err
+	}
+
+	// Build under temporary keys and swap them in so readers never see a partial index
+	boards := map[string]string{
+		leaderboardKey("", defaultPreset, allTimeWindow): "",
+		leaderboardEntriesKey:                            "",
+	}
+	for _, d := range []models.Difficulty{models.DifficultyEasy, models.DifficultyMedium, models.DifficultyHard} {
+		boards[leaderboardKey(d, defaultPreset, allTimeWindow)] = ""
+	}
+	// Replace filtered boards too, so countries and airports nobody calls home any more are emptied
+	filtered := r.redis.client.Scan(ctx, 0, "leaderboard:*:"+defaultPreset+":"+allTimeWindow+":*", 1000).Iterator()
+	for filtered.Next(ctx) {
+		if key := filtered.Val(); !strings.HasSuffix(key, ":rebuild") {
+			boards[key] = ""
+		}
+	}
+	if err := filtered.Err(); err != nil {
+		return err
+	}
+	for key := range boards {
+		boards[key] = key + ":rebuild"
+	}
+
+	pipe := r.redis.client.Pipeline()
+	for _, tmp := range boards {
+		pipe.Del(ctx, tmp)
+	}
+	for i := range entries {
+		entry := entries[i]
+		member := leaderboardMember(entry.Username, entry.Difficulty)
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		z := redis.Z{Score: -float64(entry.TotalScore), Member: member}
+		for _, key := range entryKeys(&entry) {
+			if _, ok := boards[key]; !ok {
+				boards[key] = key + ":rebuild"
+			}
+			pipe.ZAdd(ctx, boards[key], z)
+		}
+		pipe.HSet(ctx, boards[leaderboardEntriesKey], member, data)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	swap := r.redis.client.TxPipeline()
+	for key, tmp := range boards {
+		swap.Del(ctx, key)
+		swap.Copy(ctx, tmp, key, 0, true)
+		swap.Del(ctx, tmp)
+	}
+	if _, err := swap.Exec(ctx); err != nil {
+		return err
+	}
+
+	r.stale.Store(false)
+	log.Printf("Leaderboard index rebuilt with %d entries", len(entries))
+	return nil
+}
+
+// ready reports whether reads can use the index, retrying a rebuild of a stale
+// index at most once per backoff period
+func (r *RedisLeaderboardStore) ready(ctx context.Context) bool {
+	if !r.stale.Load() {
+		return true
+	}
+	if time.Since(time.Unix(0, r.lastRebuild.Load())) < leaderboardRebuildBackoff {
+		return false
+	}
+	if err := r.Rebuild(ctx); err != nil {
+		log.Printf("Warning: failed to rebuild leaderboard index: %v", err)
+		return false
+	}
+	return true
+}
+
+// failed marks the index stale after a Redis error so reads use the durable store
+func (r *RedisLeaderboardStore) failed(op string, err error) {
+	leaderboardIndexErrors.Add(1)
+	if !r.stale.Swap(true) {
+		log.Printf("Warning: leaderboard index %s failed, using durable storage until it is rebuilt: %v", op, err)
+	}
+}
+
+func (r *RedisLeaderboardStore) SaveScore(ctx context.Context, session *models.GameSession) error {
+	if err := r.LeaderboardStore.SaveScore(ctx, session); err != nil {
+		return err
+	}
+
+	// Index the durable entry so games played and the best score match it
+	entry, err := r.LeaderboardStore.GetScore(ctx, session.Username, session.Difficulty)
+	if err != nil {
+		r.failed("read", err)
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	member := leaderboardMember(entry.Username, entry.Difficulty)
+	z := redis.Z{Score: -float64(entry.TotalScore), Member: member}
+
+	pipe := r.redis.client.TxPipeline()
+	for _, key := range entryKeys(entry) {
+		// LT keeps the lowest negated score, i.e. the best one, if writes race
+		pipe.ZAddLT(ctx, key, z)
+	}
+	pipe.HSet(ctx, leaderboardEntriesKey, member, data)
+	if _, err := pipe.Exec(ctx); err != nil {
+		r.failed("write", err)
+	}
+	return nil
+}
+
+// UpdatePlayerHome moves the player's indexed entries from their old home's boards to the new one's
+func (r *RedisLeaderboardStore) UpdatePlayerHome(ctx context.Context, username, country, airport string) error {
+	if err := r.LeaderboardStore.UpdatePlayerHome(ctx, username, country, airport); err != nil {
+		return err
+	}
+
+	difficulties := []models.Difficulty{models.DifficultyEasy, models.DifficultyMedium, models.DifficultyHard}
+	members := make([]string, len(difficulties))
+	for i, difficulty := range difficulties {
+		members[i] = leaderboardMember(username, difficulty)
+	}
+	values, err := r.redis.client.HMGet(ctx, leaderboardEntriesKey, members...).Result()
+	if err != nil {
+		r.failed("read", err)
+		return nil
+	}
+
+	pipe := r.redis.client.TxPipeline()
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue // no score at this difficulty
+		}
+		var entry models.LeaderboardEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			return err
+		}
+		for _, key := range entryKeys(&entry) {
+			pipe.ZRem(ctx, key, members[i])
+		}
+		entry.Country = country
+		entry.Airport = airport
+		updated, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		z := redis.Z{Score: -float64(entry.TotalScore), Member: members[i]}
+		for _, key := range entryKeys(&entry) {
+			pipe.ZAdd(ctx, key, z)
+		}
+		pipe.HSet(ctx, leaderboardEntriesKey, members[i], updated)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		r.failed("write", err)
+	}
+	return nil
+}
+
+// indexed reports whether the index can answer a query
+func (r *RedisLeaderboardStore) indexed(ctx context.Context, query LeaderboardQuery) bool {
+	return !query.windowed() && query.Ranking != RankDense && !(query.Country != "" && query.Airport != "") && r.ready(ctx)
+}
+
+func (r *RedisLeaderboardStore) GetLeaderboard(ctx context.Context, query LeaderboardQuery) ([]models.LeaderboardEntry, error) {
+	if query.After != nil || !r.indexed(ctx, query) {
+		return r.LeaderboardStore.GetLeaderboard(ctx, query)
+	}
+
+	key := boardKey(query)
+	start := int64(query.Offset)
+	window, err := r.redis.client.ZRangeWithScores(ctx, key, start, start+int64(query.Limit)-1).Result()
+	if err != nil {
+		r.failed("read", err)
+		return r.LeaderboardStore.GetLeaderboard(ctx, query)
+	}
+	entries, err := r.rankWindow(ctx, key, window, start)
+	if err != nil {
+		r.failed("read", err)
+		return r.LeaderboardStore.GetLeaderboard(ctx, query)
+	}
+	return entries, nil
+}
+
+func (r *RedisLeaderboardStore) GetUserRank(ctx context.Context, username string, difficulty models.Difficulty) (int, error) {
+	higher, _, _, err := r.GetScoreStanding(ctx, LeaderboardQuery{Difficulty: difficulty}, username)
+	if err != nil {
+		return 0, err
+	}
+	return int(higher) + 1, nil
+}
+
+func (r *RedisLeaderboardStore) GetScoreStanding(ctx context.Context, query LeaderboardQuery, username string) (higher, equal, total int64, err error) {
+	// Standings don't depend on the ranking
+	query.Ranking = RankCompetition
+	if !r.indexed(ctx, query) {
+		return r.LeaderboardStore.GetScoreStanding(ctx, query, username)
+	}
+
+	key := boardKey(query)
+	score, err := r.redis.client.ZScore(ctx, key, leaderboardMember(username, query.Difficulty)).Result()
+	if err == redis.Nil {
+		return 0, 0, 0, ErrNotFound
+	}
+	if err != nil {
+		r.failed("read", err)
+		return r.LeaderboardStore.GetScoreStanding(ctx, query, username)
+	}
+
+	s := formatScore(score)
+	pipe := r.redis.client.Pipeline()
+	higherCmd := pipe.ZCount(ctx, key, "-inf", "("+s)
+	equalCmd := pipe.ZCount(ctx, key, s, s)
+	totalCmd := pipe.ZCard(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		r.failed("read", err)
+		return r.LeaderboardStore.GetScoreStanding(ctx, query, username)
+	}
+	return higherCmd.Val(), equalCmd.Val(), totalCmd.Val(), nil
+}
+
+// GetScoresAround reads the window around the user's index in the sorted set
+func (r *RedisLeaderboardStore) GetScoresAround(ctx context.Context, query LeaderboardQuery, username string, radius int) ([]models.LeaderboardEntry, error) {
+	if !r.indexed(ctx, query) {
+		return r.LeaderboardStore.GetScoresAround(ctx, query, username, radius)
+	}
+
+	key := boardKey(query)
+	index, err := r.redis.client.ZRank(ctx, key, leaderboardMember(username, query.Difficulty)).Result()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		r.failed("read", err)
+		return r.LeaderboardStore.GetScoresAround(ctx, query, username, radius)
+	}
+
+	start := max(index-int64(radius), 0)
+	window, err := r.redis.client.ZRangeWithScores(ctx, key, start, index+int64(radius)).Result()
+	if err == nil && len(window) == 0 {
+		err = errors.New("sorted set changed while reading")
+	}
+	var entries []models.LeaderboardEntry
+	if err == nil {
+		entries, err = r.rankWindow(ctx, key, window, start)
+	}
+	if err != nil {
+		r.failed("read", err)
+		return r.LeaderboardStore.GetScoresAround(ctx, query, username, radius)
+	}
+	return entries, nil
+}
+
+// rankWindow loads the entries of a range of the sorted set starting at index
+// start, and gives them competition ranks
+func (r *RedisLeaderboardStore) rankWindow(ctx context.Context, key string, window []redis.Z, start int64) ([]models.LeaderboardEntry, error) {
+	if len(window) == 0 {
+		return nil, nil
+	}
+	higher, err := r.redis.client.ZCount(ctx, key, "-inf", "("+formatScore(window[0].Score)).Result()
+	if err != nil {
+		return nil, err
+	}
+	members := make([]string, len(window))
+	for i, z := range window {
+		members[i] = z.Member.(string)
+	}
+	entries, err := r.loadEntries(ctx, members)
+	if err != nil {
+		return nil, err
+	}
+	rankAround(entries, start, higher)
+	return entries, nil
+}
+
+// loadEntries fetches the stored entries of sorted set members, in order
+func (r *RedisLeaderboardStore) loadEntries(ctx context.Context, members []string) ([]models.LeaderboardEntry, error) {
+	if len(members) == 0 {
+		return nil, nil
+	}
+	values, err := r.redis.client.HMGet(ctx, leaderboardEntriesKey, members...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]models.LeaderboardEntry, len(values))
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("leaderboard entry %q missing from index", members[i])
+		}
+		if err := json.Unmarshal([]byte(data), &entries[i]); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// formatScore formats a sorted set score for use in a range bound
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+// rankAround assigns ranks to a window of entries ordered by score then username.
+// firstPosition is the number of entries ordered before the first one, and
+// firstHigher the number scoring strictly higher. Tied entries share a rank.
+func rankAround(entries []models.LeaderboardEntry, firstPosition, firstHigher int64) {
+	for i := range entries {
+		switch {
+		case i == 0:
+			entries[i].Rank = int(firstHigher) + 1
+		case entries[i].TotalScore == entries[i-1].TotalScore:
+			entries[i].Rank = entries[i-1].Rank
+		default:
+			// Everything ordered before a new score group scores higher
+			entries[i].Rank = int(firstPosition) + i + 1
+		}
+	}
+}
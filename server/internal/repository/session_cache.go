@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/skyquest/server/internal/models"
+)
+
+// Session cache metrics, published on /debug/vars
+var (
+	sessionCacheHits   = expvar.NewInt("session_cache_hits_total")
+	sessionCacheMisses = expvar.NewInt("session_cache_misses_total")
+	sessionCacheErrors = expvar.NewInt("session_cache_errors_total")
+)
+
+const (
+	// sessionCacheTimeout bounds each Redis call so a slow cache never holds up a guess
+	sessionCacheTimeout = 250 * time.Millisecond
+	// sessionCacheBackoff is how long the cache is bypassed after a Redis error
+	sessionCacheBackoff = 30 * time.Second
+)
+
+// CachedSessionStore is a write-through Redis cache in front of a durable
+// SessionStore. In-progress sessions are read from Redis; every write goes to
+// the durable store first, which stays the authority for version checks, and
+// then refreshes the cache. Finished sessions are flushed from the cache.
+// A cached copy that is briefly stale fails its next versioned write, which
+// drops it so the retry reads the durable session.
+//
+// Cached entries expire at the session's idle deadline, when the lifecycle
+// manager would abandon the game anyway. If Redis fails, the cache is bypassed
+// for a while and every call goes straight to the durable store.
+type CachedSessionStore struct {
+	SessionStore
+	cache      *RedisClient
+	sessionTTL time.Duration
+	// unavailableUntil holds the UnixNano time until which Redis is bypassed
+	unavailableUntil atomic.Int64
+}
+
+func NewCachedSessionStore(store SessionStore, cache *RedisClient, sessionTTL time.Duration) *CachedSessionStore {
+	return &CachedSessionStore{
+		SessionStore: store,
+		cache:        cache,
+		sessionTTL:   sessionTTL,
+	}
+}
+
+func (c *CachedSessionStore) CreateSession(ctx context.Context, session *models.GameSession) error {
+	if err := c.SessionStore.CreateSession(ctx, session); err != nil {
+		return err
+	}
+	c.store(ctx, session)
+	return nil
+}
+
+func (c *CachedSessionStore) GetSession(ctx context.Context, sessionID string) (*models.GameSession, error) {
+	if c.available() {
+		cacheCtx, cancel := context.WithTimeout(ctx, sessionCacheTimeout)
+		session, err := c.cache.GetCachedSession(cacheCtx, sessionID)
+		cancel()
+		switch {
+		case err != nil:
+			c.failed("read", sessionID, err)
+		case session != nil:
+			sessionCacheHits.Add(1)
+			return session, nil
+		default:
+			sessionCacheMisses.Add(1)
+		}
+	}
+
+	session, err := c.SessionStore.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	c.store(ctx, session)
+	return session, nil
+}
+
+func (c *CachedSessionStore) UpdateSession(ctx context.Context, session *models.GameSession) error {
+	err := c.SessionStore.UpdateSession(ctx, session)
+	if errors.Is(err, ErrVersionConflict) {
+		// The cached copy is stale; drop it so the caller's retry reads the durable one
+		c.flush(ctx, session.SessionID)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	c.store(ctx, session)
+	return nil
+}
+
+// EvictFinishedSessions forwards to the durable store when it holds sessions in memory
+func (c *CachedSessionStore) EvictFinishedSessions(cutoff time.Time) int {
+	if evicter, ok := c.SessionStore.(SessionEvicter); ok {
+		return evicter.EvictFinishedSessions(cutoff)
+	}
+	return 0
+}
+
+// store caches an in-progress session until its idle deadline, or flushes a finished one
+func (c *CachedSessionStore) store(ctx context.Context, session *models.GameSession) {
+	if session.Status != models.SessionInProgress {
+		c.flush(ctx, session.SessionID)
+		return
+	}
+	ttl := time.Until(session.LastActivityAt.Add(c.sessionTTL))
+	if ttl <= 0 || !c.available() {
+		return
+	}
+
+	cacheCtx, cancel := context.WithTimeout(ctx, sessionCacheTimeout)
+	defer cancel()
+	if err := c.cache.CacheSession(cacheCtx, session.SessionID, session, ttl); err != nil {
+		c.failed("write", session.SessionID, err)
+	}
+}
+
+// flush removes a session from the cache
+func (c *CachedSessionStore) flush(ctx context.Context, sessionID string) {
+	if !c.available() {
+		return
+	}
+	cacheCtx, cancel := context.WithTimeout(ctx, sessionCacheTimeout)
+	defer cancel()
+	if err := c.cache.DeleteSession(cacheCtx, sessionID); err != nil {
+		c.failed("flush", sessionID, err)
+	}
+}
+
+func (c *CachedSessionStore) available() bool {
+	return time.Now().UnixNano() >= c.unavailableUntil.Load()
+}
+
+// failed bypasses the cache for a while after a Redis error
+func (c *CachedSessionStore) failed(op, sessionID string, err error) {
+	sessionCacheErrors.Add(1)
+	if c.available() {
+		log.Printf("Warning: session cache %s failed for %s, using durable storage for %s: %v", op, sessionID, sessionCacheBackoff, err)
+	}
+	c.unavailableUntil.Store(time.Now().Add(sessionCacheBackoff).UnixNano())
+}
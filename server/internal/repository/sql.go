@@ -0,0 +1,1189 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skyquest/server/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sqlDialect captures the differences between the SQL databases we support
+type sqlDialect struct {
+	name           string // migrations directory
+	numberedParams bool   // $1, $2... instead of ?
+	greatest       string // scalar function returning the larger of two values
+}
+
+var (
+	sqliteDialect   = sqlDialect{name: "sqlite", greatest: "MAX"}
+	postgresDialect = sqlDialect{name: "postgres", numberedParams: true, greatest: "GREATEST"}
+)
+
+// SQLStore keeps sessions, users and the leaderboard in a SQL database.
+// Rounds are stored as rows of their own; nested documents (flight data,
+// scores) are stored as JSON.
+type SQLStore struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+func (r *SQLStore) Close() error {
+	return r.db.Close()
+}
+
+// Migrate applies any pending schema migrations
+func (r *SQLStore) Migrate(ctx context.Context) error {
+	applied, err := runMigrations(ctx, r.db, r.dialect)
+	if err != nil {
+		return err
+	}
+	if applied > 0 {
+		log.Printf("Applied %d %s migration(s)", applied, r.dialect.name)
+	}
+	return nil
+}
+
+// q rewrites ? placeholders for the dialect
+func (r *SQLStore) q(query string) string {
+	if !r.dialect.numberedParams {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// Game Session methods
+
+const sessionColumns = `id, session_id, user_id, username, difficulty, status, total_score,
+	started_at, ended_at, last_activity_at, result, version, start_xp, tournament_id, challenge_id`
+
+const roundColumns = `round_number, flight_id, token, flight, display, departure, actual_arrival,
+	player_guess, points_earned, guess_time, confidence, score, guess_key, started_at, completed_at`
+
+func (r *SQLStore) CreateSession(ctx context.Context, session *models.GameSession) error {
+	session.ID = primitive.NewObjectID()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := marshalNullable(session.Result)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, r.q(`INSERT INTO game_sessions (`+sessionColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		session.ID.Hex(), session.SessionID, session.UserID, session.Username, session.Difficulty,
+		session.Status, session.TotalScore, utc(session.StartedAt), utcPtr(session.EndedAt),
+		utc(session.LastActivityAt), result, session.Version, session.StartXP, session.TournamentID,
+		session.ChallengeID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := r.insertRounds(ctx, tx, session); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SQLStore) GetSession(ctx context.Context, sessionID string) (*models.GameSession, error) {
+	row := r.db.QueryRowContext(ctx, r.q(`SELECT `+sessionColumns+` FROM game_sessions WHERE session_id = ?`), sessionID)
+	session, err := scanSession(row)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.loadRounds(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (r *SQLStore) UpdateSession(ctx context.Context, session *models.GameSession) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := marshalNullable(session.Result)
+	if err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, r.q(`UPDATE game_sessions SET
+			user_id = ?, username = ?, difficulty = ?, status = ?, total_score = ?,
+			started_at = ?, ended_at = ?, last_activity_at = ?, result = ?, version = version + 1
+		WHERE session_id = ? AND version = ?`),
+		session.UserID, session.Username, session.Difficulty, session.Status, session.TotalScore,
+		utc(session.StartedAt), utcPtr(session.EndedAt), utc(session.LastActivityAt), result,
+		session.SessionID, session.Version,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		var exists int
+		err := tx.QueryRowContext(ctx, r.q(`SELECT 1 FROM game_sessions WHERE session_id = ?`), session.SessionID).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return ErrVersionConflict
+	}
+
+	// Rounds are rewritten as a whole; a game has few of them
+	if _, err := tx.ExecContext(ctx, r.q(`DELETE FROM game_rounds WHERE session_id = ?`), session.SessionID); err != nil {
+		return err
+	}
+	if err := r.insertRounds(ctx, tx, session); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	session.Version++
+	return nil
+}
+
+func (r *SQLStore) FindIdleSessions(ctx context.Context, cutoff time.Time) ([]models.GameSession, error) {
+	return r.querySessions(ctx, `SELECT `+sessionColumns+` FROM game_sessions
+		WHERE status = ? AND last_activity_at < ?`, models.SessionInProgress, utc(cutoff))
+}
+
+func (r *SQLStore) GetUserSessions(ctx context.Context, userID string, offset, limit int) ([]models.GameSession, error) {
+	return r.querySessions(ctx, `SELECT `+sessionColumns+` FROM game_sessions
+		WHERE user_id = ? ORDER BY started_at DESC, session_id LIMIT ? OFFSET ?`, userID, limit, offset)
+}
+
+func (r *SQLStore) ListFinishedSessions(ctx context.Context, after SessionCursor, limit int) ([]models.GameSession, error) {
+	return r.querySessions(ctx, `SELECT `+sessionColumns+` FROM game_sessions
+		WHERE status <> ? AND ended_at IS NOT NULL
+			AND (ended_at > ? OR (ended_at = ? AND session_id > ?))
+		ORDER BY ended_at, session_id LIMIT ?`,
+		models.SessionInProgress, utc(after.EndedAt), utc(after.EndedAt), after.SessionID, limit)
+}
+
+func (r *SQLStore) querySessions(ctx context.Context, query string, args ...interface{}) ([]models.GameSession, error) {
+	rows, err := r.db.QueryContext(ctx, r.q(query), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []models.GameSession
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Load rounds once the session cursor is closed - SQLite has a single connection
+	for i := range sessions {
+		if err := r.loadRounds(ctx, &sessions[i]); err != nil {
+			return nil, err
+		}
+	}
+	return sessions, nil
+}
+
+func (r *SQLStore) loadRounds(ctx context.Context, session *models.GameSession) error {
+	rows, err := r.db.QueryContext(ctx, r.q(`SELECT `+roundColumns+` FROM game_rounds
+		WHERE session_id = ? ORDER BY round_number`), session.SessionID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	session.Rounds = session.Rounds[:0]
+	for rows.Next() {
+		var round models.Round
+		var flight, display, score sql.NullString
+		var completedAt sql.NullTime
+		err := rows.Scan(
+			&round.RoundNumber, &round.FlightID, &round.Token, &flight, &display,
+			&round.Departure, &round.ActualArrival, &round.PlayerGuess, &round.PointsEarned,
+			&round.GuessTime, &round.Confidence, &score, &round.GuessKey,
+			&round.StartedAt, &completedAt,
+		)
+		if err != nil {
+			return err
+		}
+		if err := unmarshalNullable(flight, &round.Flight); err != nil {
+			return err
+		}
+		if err := unmarshalNullable(display, &round.Display); err != nil {
+			return err
+		}
+		if err := unmarshalNullable(score, &round.Score); err != nil {
+			return err
+		}
+		if completedAt.Valid {
+			round.CompletedAt = &completedAt.Time
+		}
+		session.Rounds = append(session.Rounds, round)
+	}
+	return rows.Err()
+}
+
+func (r *SQLStore) insertRounds(ctx context.Context, tx *sql.Tx, session *models.GameSession) error {
+	stmt, err := tx.PrepareContext(ctx, r.q(`INSERT INTO game_rounds (session_id, `+roundColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, round := range session.Rounds {
+		flight, err := marshalNullable(round.Flight)
+		if err != nil {
+			return err
+		}
+		display, err := marshalNullable(round.Display)
+		if err != nil {
+			return err
+		}
+		score, err := marshalNullable(round.Score)
+		if err != nil {
+			return err
+		}
+		_, err = stmt.ExecContext(ctx,
+			session.SessionID, round.RoundNumber, round.FlightID, round.Token, flight, display,
+			round.Departure, round.ActualArrival, round.PlayerGuess, round.PointsEarned,
+			round.GuessTime, round.Confidence, score, round.GuessKey,
+			utc(round.StartedAt), utcPtr(round.CompletedAt),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row rowScanner) (*models.GameSession, error) {
+	var session models.GameSession
+	var id string
+	var endedAt sql.NullTime
+	var result sql.NullString
+	var startXP sql.NullInt64
+	err := row.Scan(
+		&id, &session.SessionID, &session.UserID, &session.Username, &session.Difficulty,
+		&session.Status, &session.TotalScore, &session.StartedAt, &endedAt,
+		&session.LastActivityAt, &result, &session.Version, &startXP, &session.TournamentID,
+		&session.ChallengeID,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	session.ID, _ = primitive.ObjectIDFromHex(id)
+	if endedAt.Valid {
+		session.EndedAt = &endedAt.Time
+	}
+	if startXP.Valid {
+		xp := int(startXP.Int64)
+		session.StartXP = &xp
+	}
+	if err := unmarshalNullable(result, &session.Result); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// User methods
+
+const userColumns = `id, username, email, created_at, games_played, total_score, avg_score, best_score,
+	home_country, home_airport, password_hash, stats, xp, level`
+
+func (r *SQLStore) CreateUser(ctx context.Context, user *models.User) error {
+	stats, err := json.Marshal(user.Stats)
+	if err != nil {
+		return err
+	}
+	user.ID = primitive.NewObjectID()
+	_, err = r.db.ExecContext(ctx, r.q(`INSERT INTO users (`+userColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		user.ID.Hex(), user.Username, user.Email, utc(user.CreatedAt),
+		user.Stats.GamesPlayed, user.Stats.TotalScore, user.Stats.AvgScore, user.Stats.BestScore,
+		user.HomeCountry, user.HomeAirport, user.PasswordHash, string(stats),
+		user.Progression.XP, user.Progression.Level,
+	)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *SQLStore) GetUser(ctx context.Context, id string) (*models.User, error) {
+	return r.queryUser(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+}
+
+func (r *SQLStore) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.queryUser(ctx, `SELECT `+userColumns+` FROM users WHERE username = ?`, username)
+}
+
+func (r *SQLStore) GetUserByIdentity(ctx context.Context, provider, subject string) (*models.User, error) {
+	return r.queryUser(ctx, `SELECT `+userColumns+` FROM users
+		WHERE id = (SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?)`, provider, subject)
+}
+
+func (r *SQLStore) UpdateUser(ctx context.Context, user *models.User) error {
+	res, err := r.db.ExecContext(ctx, r.q(`UPDATE users SET
+			username = ?, email = ?, home_country = ?, home_airport = ?, password_hash = ?
+		WHERE id = ?`),
+		user.Username, user.Email, user.HomeCountry, user.HomeAirport, user.PasswordHash,
+		user.ID.Hex(),
+	)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLStore) UpdateUserStats(ctx context.Context, userID string, stats models.UserStats, gamesPlayed int) error {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, r.q(`UPDATE users SET
+			games_played = ?, total_score = ?, avg_score = ?, best_score = ?, stats = ?
+		WHERE id = ? AND games_played = ?`),
+		stats.GamesPlayed, stats.TotalScore, stats.AvgScore, stats.BestScore, string(data),
+		userID, gamesPlayed,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		var exists int
+		err := r.db.QueryRowContext(ctx, r.q(`SELECT 1 FROM users WHERE id = ?`), userID).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+func (r *SQLStore) UpdateUserProgression(ctx context.Context, userID string, progression models.Progression, xp int) error {
+	res, err := r.db.ExecContext(ctx, r.q(`UPDATE users SET xp = ?, level = ? WHERE id = ? AND xp = ?`),
+		progression.XP, progression.Level, userID, xp)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		var exists int
+		err := r.db.QueryRowContext(ctx, r.q(`SELECT 1 FROM users WHERE id = ?`), userID).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+func (r *SQLStore) queryUser(ctx context.Context, query string, args ...interface{}) (*models.User, error) {
+	var user models.User
+	var id, stats string
+	var totals models.UserStats
+	err := r.db.QueryRowContext(ctx, r.q(query), args...).Scan(
+		&id, &user.Username, &user.Email, &user.CreatedAt,
+		&totals.GamesPlayed, &totals.TotalScore, &totals.AvgScore, &totals.BestScore,
+		&user.HomeCountry, &user.HomeAirport, &user.PasswordHash, &stats,
+		&user.Progression.XP, &user.Progression.Level,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	user.ID, _ = primitive.ObjectIDFromHex(id)
+	if err := json.Unmarshal([]byte(stats), &user.Stats); err != nil {
+		return nil, err
+	}
+	// The columns hold the totals of users from before the stats column
+	user.Stats.GamesPlayed = totals.GamesPlayed
+	user.Stats.TotalScore = totals.TotalScore
+	user.Stats.AvgScore = totals.AvgScore
+	user.Stats.BestScore = totals.BestScore
+
+	rows, err := r.db.QueryContext(ctx, r.q(`SELECT provider, subject, email, linked_at
+		FROM user_identities WHERE user_id = ? ORDER BY linked_at`), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var identity models.UserIdentity
+		if err := rows.Scan(&identity.Provider, &identity.Subject, &identity.Email, &identity.LinkedAt); err != nil {
+			return nil, err
+		}
+		user.Identities = append(user.Identities, identity)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *SQLStore) LinkIdentity(ctx context.Context, userID string, identity models.UserIdentity) error {
+	var exists int
+	err := r.db.QueryRowContext(ctx, r.q(`SELECT 1 FROM users WHERE id = ?`), userID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, r.q(`INSERT INTO user_identities (provider, subject, user_id, email, linked_at)
+		VALUES (?, ?, ?, ?, ?)`),
+		identity.Provider, identity.Subject, userID, identity.Email, utc(identity.LinkedAt),
+	)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// isUniqueViolation reports whether err is a unique constraint failure in either dialect
+func isUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "UNIQUE constraint failed") || // SQLite
+		strings.Contains(msg, "SQLSTATE 23505") // Postgres unique_violation
+}
+
+// Leaderboard methods
+
+func (r *SQLStore) SaveScore(ctx context.Context, session *models.GameSession) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var country, airport string
+	err = tx.QueryRowContext(ctx, r.q(`SELECT home_country, home_airport FROM users WHERE username = ?`), session.Username).
+		Scan(&country, &airport)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	record := newScoreRecord(session, country, airport)
+	counted, err := r.saveScoreRecord(ctx, tx, record)
+	if err != nil {
+		return err
+	}
+	gamesPlayed := 0
+	if counted {
+		gamesPlayed = 1
+	}
+
+	_, err = tx.ExecContext(ctx, r.q(`INSERT INTO leaderboard
+			(id, username, difficulty, total_score, games_played, updated_at, country, airport)
+		VALUES (?, ?, ?, ?, 1, ?, ?, ?)
+		ON CONFLICT (username, difficulty) DO UPDATE SET
+			total_score = `+r.dialect.greatest+`(leaderboard.total_score, excluded.total_score),
+			games_played = leaderboard.games_played + ?,
+			updated_at = excluded.updated_at,
+			country = excluded.country, airport = excluded.airport`),
+		primitive.NewObjectID().Hex(), session.Username, session.Difficulty, session.TotalScore, utc(time.Now()),
+		country, airport, gamesPlayed,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// saveScoreRecord stores a session's score record, replacing any earlier one,
+// and reports whether it counts a game: the record is new, or it moved to
+// another player or difficulty. Updating the earlier record locks it, so
+// concurrent saves of a session count it once.
+func (r *SQLStore) saveScoreRecord(ctx context.Context, tx *sql.Tx, record *models.ScoreRecord) (bool, error) {
+	args := []interface{}{record.UserID, record.Username, record.Difficulty, record.Score, utc(record.PlayedAt),
+		record.Country, record.Airport, record.SessionID}
+	res, err := tx.ExecContext(ctx, r.q(`INSERT INTO score_records
+			(user_id, username, difficulty, score, played_at, country, airport, session_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (session_id) DO NOTHING`), args...)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 1 {
+		return n == 1, err
+	}
+
+	const update = `UPDATE score_records SET
+			user_id = ?, username = ?, difficulty = ?, score = ?, played_at = ?, country = ?, airport = ?
+		WHERE session_id = ?`
+	res, err = tx.ExecContext(ctx, r.q(update+` AND (username <> ? OR difficulty <> ?)`),
+		append(args, record.Username, record.Difficulty)...)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 1 {
+		return n == 1, err
+	}
+	_, err = tx.ExecContext(ctx, r.q(update), args...)
+	return false, err
+}
+
+func (r *SQLStore) UpdatePlayerHome(ctx context.Context, username, country, airport string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"leaderboard", "score_records"} {
+		_, err := tx.ExecContext(ctx, r.q(`UPDATE `+table+` SET country = ?, airport = ? WHERE username = ?`),
+			country, airport, username)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *SQLStore) GetLeaderboard(ctx context.Context, query LeaderboardQuery) ([]models.LeaderboardEntry, error) {
+	ranked, args := r.rankedBoard(query)
+	stmt := ranked + ` SELECT ` + rankedColumns + ` FROM ranked`
+	if cursor := query.After; cursor != nil {
+		stmt += ` WHERE total_score < ?
+			OR (total_score = ? AND username > ?)
+			OR (total_score = ? AND username = ? AND difficulty > ?)`
+		args = append(args, cursor.TotalScore,
+			cursor.TotalScore, cursor.Username,
+			cursor.TotalScore, cursor.Username, cursor.Difficulty)
+	}
+	stmt += ` ORDER BY row_position LIMIT ? OFFSET ?`
+	offset := query.Offset
+	if query.After != nil {
+		offset = 0
+	}
+	args = append(args, query.Limit, offset)
+
+	entries, err := r.queryRanked(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	return rankedEntries(entries, query.Ranking), nil
+}
+
+func (r *SQLStore) GetScore(ctx context.Context, username string, difficulty models.Difficulty) (*models.LeaderboardEntry, error) {
+	entries, err := r.queryScores(ctx, `SELECT `+scoreColumns+` FROM leaderboard
+		WHERE username = ? AND difficulty = ?`, username, difficulty)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrNotFound
+	}
+	return &entries[0], nil
+}
+
+func (r *SQLStore) GetScoresAround(ctx context.Context, query LeaderboardQuery, username string, radius int) ([]models.LeaderboardEntry, error) {
+	ranked, args := r.rankedBoard(query)
+	stmt := ranked + ` SELECT ` + rankedColumns + ` FROM ranked
+		WHERE row_position BETWEEN
+			(SELECT row_position FROM ranked WHERE username = ?) - ? AND
+			(SELECT row_position FROM ranked WHERE username = ?) + ?
+		ORDER BY row_position`
+	args = append(args, username, radius, username, radius)
+
+	entries, err := r.queryRanked(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrNotFound
+	}
+	return rankedEntries(entries, query.Ranking), nil
+}
+
+func (r *SQLStore) GetUserRank(ctx context.Context, username string, difficulty models.Difficulty) (int, error) {
+	higher, _, _, err := r.GetScoreStanding(ctx, LeaderboardQuery{Difficulty: difficulty}, username)
+	if err != nil {
+		return 0, err
+	}
+	return int(higher) + 1, nil
+}
+
+func (r *SQLStore) GetScoreStanding(ctx context.Context, query LeaderboardQuery, username string) (higher, equal, total int64, err error) {
+	ranked, args := r.rankedBoard(query)
+	entries, err := r.queryRanked(ctx, ranked+` SELECT `+rankedColumns+` FROM ranked WHERE username = ?`,
+		append(args, username)...)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if len(entries) == 0 {
+		return 0, 0, 0, ErrNotFound
+	}
+	higher, equal, total = entries[0].standing()
+	return higher, equal, total, nil
+}
+
+func (r *SQLStore) GetCountryLeaderboard(ctx context.Context, query LeaderboardQuery, top int) ([]models.CountryEntry, error) {
+	ranked, args := r.rankedBoard(query)
+	stmt := ranked + `,
+		country_players AS (
+			SELECT country, total_score,
+				ROW_NUMBER() OVER (PARTITION BY country ORDER BY row_position) AS country_position
+			FROM ranked
+			WHERE country <> ''
+		)
+		SELECT country, COUNT(*) AS players, AVG(total_score) AS average_score
+		FROM country_players
+		WHERE country_position <= ?
+		GROUP BY country
+		ORDER BY average_score DESC, country
+		LIMIT ?`
+	args = append(args, top, query.Limit)
+
+	rows, err := r.db.QueryContext(ctx, r.q(stmt), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	countries := []models.CountryEntry{}
+	for rows.Next() {
+		var country models.CountryEntry
+		if err := rows.Scan(&country.Country, &country.Players, &country.AverageScore); err != nil {
+			return nil, err
+		}
+		countries = append(countries, country)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rankCountries(countries)
+	return countries, nil
+}
+
+const rankedColumns = scoreColumns + `, row_position, competition_rank, score_dense_rank, score_ties, entries`
+
+// rankedBoard returns a WITH clause defining "ranked": the whole board a query
+// selects, numbered and ranked with window functions. All-time boards read the
+// leaderboard table; windowed boards group the score records played in the window.
+func (r *SQLStore) rankedBoard(query LeaderboardQuery) (string, []interface{}) {
+	var board string
+	var args []interface{}
+	if query.windowed() {
+		// A player's records all carry their current home, so MAX just picks it
+		board = `SELECT '' AS id, username, difficulty, MAX(score) AS total_score,
+				COUNT(*) AS games_played, MAX(played_at) AS updated_at,
+				MAX(country) AS country, MAX(airport) AS airport
+			FROM score_records
+			WHERE played_at >= ? AND played_at < ?`
+		args = append(args, utc(query.Since), utc(query.Until))
+	} else {
+		board = `SELECT ` + scoreColumns + ` FROM leaderboard WHERE 1 = 1`
+	}
+	if query.Difficulty != "" {
+		board += ` AND difficulty = ?`
+		args = append(args, query.Difficulty)
+	}
+	if query.Country != "" {
+		board += ` AND country = ?`
+		args = append(args, query.Country)
+	}
+	if query.Airport != "" {
+		board += ` AND airport = ?`
+		args = append(args, query.Airport)
+	}
+	if query.windowed() {
+		board += ` GROUP BY username, difficulty`
+	}
+
+	return `WITH board AS (` + board + `),
+		ranked AS (
+			SELECT ` + scoreColumns + `,
+				ROW_NUMBER() OVER (ORDER BY total_score DESC, username, difficulty) AS row_position,
+				RANK() OVER (ORDER BY total_score DESC) AS competition_rank,
+				DENSE_RANK() OVER (ORDER BY total_score DESC) AS score_dense_rank,
+				COUNT(*) OVER (PARTITION BY total_score) AS score_ties,
+				COUNT(*) OVER () AS entries
+			FROM board
+		)`, args
+}
+
+func (r *SQLStore) queryRanked(ctx context.Context, query string, args ...interface{}) ([]rankedEntry, error) {
+	rows, err := r.db.QueryContext(ctx, r.q(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []rankedEntry
+	for rows.Next() {
+		var entry rankedEntry
+		var id string
+		var updatedAt sqlTime
+		err := rows.Scan(&id, &entry.Username, &entry.Difficulty, &entry.TotalScore, &entry.GamesPlayed, &updatedAt,
+			&entry.Country, &entry.Airport,
+			&entry.Position, &entry.CompetitionRank, &entry.DenseRank, &entry.Ties, &entry.Entries)
+		if err != nil {
+			return nil, err
+		}
+		entry.ID, _ = primitive.ObjectIDFromHex(id)
+		entry.UpdatedAt = time.Time(updatedAt)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+const scoreColumns = `id, username, difficulty, total_score, games_played, updated_at, country, airport`
+
+func (r *SQLStore) queryScores(ctx context.Context, query string, args ...interface{}) ([]models.LeaderboardEntry, error) {
+	rows, err := r.db.QueryContext(ctx, r.q(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.LeaderboardEntry
+	for rows.Next() {
+		var entry models.LeaderboardEntry
+		var id string
+		err := rows.Scan(&id, &entry.Username, &entry.Difficulty, &entry.TotalScore, &entry.GamesPlayed, &entry.UpdatedAt,
+			&entry.Country, &entry.Airport)
+		if err != nil {
+			return nil, err
+		}
+		entry.ID, _ = primitive.ObjectIDFromHex(id)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Leaderboard archive methods
+
+func (r *SQLStore) SaveSnapshot(ctx context.Context, snapshot *models.LeaderboardSnapshot) error {
+	entries, err := json.Marshal(snapshot.Entries)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, r.q(`INSERT INTO leaderboard_snapshots
+			(window_name, difficulty, period_start, period_end, entries, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`),
+		snapshot.Window, snapshot.Difficulty, utc(snapshot.PeriodStart), utc(snapshot.PeriodEnd),
+		string(entries), utc(snapshot.CreatedAt),
+	)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *SQLStore) GetSnapshots(ctx context.Context, window models.LeaderboardWindow, difficulty models.Difficulty, limit int) ([]models.LeaderboardSnapshot, error) {
+	rows, err := r.db.QueryContext(ctx, r.q(`SELECT window_name, difficulty, period_start, period_end, entries, created_at
+		FROM leaderboard_snapshots
+		WHERE window_name = ? AND difficulty = ?
+		ORDER BY period_start DESC LIMIT ?`),
+		window, difficulty, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []models.LeaderboardSnapshot
+	for rows.Next() {
+		var snapshot models.LeaderboardSnapshot
+		var entries string
+		err := rows.Scan(&snapshot.Window, &snapshot.Difficulty, &snapshot.PeriodStart, &snapshot.PeriodEnd,
+			&entries, &snapshot.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(entries), &snapshot.Entries); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+// Achievement methods
+
+func (r *SQLStore) GetAchievements(ctx context.Context, userID string) (*models.PlayerAchievements, error) {
+	var data string
+	achievements := &models.PlayerAchievements{UserID: userID}
+	err := r.db.QueryRowContext(ctx, r.q(`SELECT data, version FROM achievements WHERE user_id = ?`), userID).
+		Scan(&data, &achievements.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return achievements, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(data), achievements); err != nil {
+		return nil, err
+	}
+	return achievements, nil
+}
+
+func (r *SQLStore) SaveAchievements(ctx context.Context, achievements *models.PlayerAchievements) error {
+	data, err := json.Marshal(achievements)
+	if err != nil {
+		return err
+	}
+	if achievements.Version == 0 {
+		_, err = r.db.ExecContext(ctx, r.q(`INSERT INTO achievements (user_id, data, version) VALUES (?, ?, 1)`),
+			achievements.UserID, string(data))
+		if isUniqueViolation(err) {
+			// Saved first by a concurrent update
+			return ErrVersionConflict
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		res, err := r.db.ExecContext(ctx, r.q(`UPDATE achievements SET data = ?, version = version + 1
+			WHERE user_id = ? AND version = ?`),
+			string(data), achievements.UserID, achievements.Version)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrVersionConflict
+		}
+	}
+	achievements.Version++
+	return nil
+}
+
+// Tournament methods
+
+func (r *SQLStore) CreateTournament(ctx context.Context, tournament *models.Tournament) error {
+	data, err := json.Marshal(tournament)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, r.q(`INSERT INTO tournaments (id, data, version, created_at) VALUES (?, ?, ?, ?)`),
+		tournament.ID, string(data), tournament.Version, utc(tournament.CreatedAt))
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *SQLStore) GetTournament(ctx context.Context, id string) (*models.Tournament, error) {
+	tournaments, err := r.queryTournaments(ctx, `SELECT data, version FROM tournaments WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(tournaments) == 0 {
+		return nil, ErrNotFound
+	}
+	return &tournaments[0], nil
+}
+
+func (r *SQLStore) UpdateTournament(ctx context.Context, tournament *models.Tournament) error {
+	data, err := json.Marshal(tournament)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, r.q(`UPDATE tournaments SET data = ?, version = version + 1
+		WHERE id = ? AND version = ?`),
+		string(data), tournament.ID, tournament.Version)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrVersionConflict
+	}
+	tournament.Version++
+	return nil
+}
+
+func (r *SQLStore) ListTournaments(ctx context.Context, offset, limit int) ([]models.Tournament, error) {
+	return r.queryTournaments(ctx, `SELECT data, version FROM tournaments
+		ORDER BY created_at DESC, id LIMIT ? OFFSET ?`, limit, offset)
+}
+
+func (r *SQLStore) queryTournaments(ctx context.Context, query string, args ...interface{}) ([]models.Tournament, error) {
+	rows, err := r.db.QueryContext(ctx, r.q(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tournaments := []models.Tournament{}
+	for rows.Next() {
+		var data string
+		var tournament models.Tournament
+		if err := rows.Scan(&data, &tournament.Version); err != nil {
+			return nil, err
+		}
+		version := tournament.Version
+		if err := json.Unmarshal([]byte(data), &tournament); err != nil {
+			return nil, err
+		}
+		tournament.Version = version
+		tournaments = append(tournaments, tournament)
+	}
+	return tournaments, rows.Err()
+}
+
+// Challenge methods
+
+func (r *SQLStore) CreateChallenge(ctx context.Context, challenge *models.Challenge) error {
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, r.q(`INSERT INTO challenges (id, data, version, created_at) VALUES (?, ?, ?, ?)`),
+		challenge.ID, string(data), challenge.Version, utc(challenge.CreatedAt))
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *SQLStore) GetChallenge(ctx context.Context, id string) (*models.Challenge, error) {
+	var data string
+	var version int
+	err := r.db.QueryRowContext(ctx, r.q(`SELECT data, version FROM challenges WHERE id = ?`), id).
+		Scan(&data, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var challenge models.Challenge
+	if err := json.Unmarshal([]byte(data), &challenge); err != nil {
+		return nil, err
+	}
+	challenge.Version = version
+	return &challenge, nil
+}
+
+func (r *SQLStore) UpdateChallenge(ctx context.Context, challenge *models.Challenge) error {
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, r.q(`UPDATE challenges SET data = ?, version = version + 1
+		WHERE id = ? AND version = ?`),
+		string(data), challenge.ID, challenge.Version)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrVersionConflict
+	}
+	challenge.Version++
+	return nil
+}
+
+func (r *SQLStore) ListChallenges(ctx context.Context, offset, limit int) ([]models.Challenge, error) {
+	rows, err := r.db.QueryContext(ctx, r.q(`SELECT data, version FROM challenges
+		ORDER BY created_at DESC, id LIMIT ? OFFSET ?`), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	challenges := []models.Challenge{}
+	for rows.Next() {
+		var data string
+		var version int
+		if err := rows.Scan(&data, &version); err != nil {
+			return nil, err
+		}
+		var challenge models.Challenge
+		if err := json.Unmarshal([]byte(data), &challenge); err != nil {
+			return nil, err
+		}
+		challenge.Version = version
+		challenges = append(challenges, challenge)
+	}
+	return challenges, rows.Err()
+}
+
+// Rating methods
+
+const ratingColumns = `user_id, username, difficulty, rating, rd, volatility, games, updated_at`
+
+func (r *SQLStore) GetRatings(ctx context.Context, userID string) ([]models.PlayerRating, error) {
+	return r.queryRatings(ctx, `SELECT `+ratingColumns+` FROM ratings WHERE user_id = ? ORDER BY difficulty`, userID)
+}
+
+func (r *SQLStore) SaveRating(ctx context.Context, rating *models.PlayerRating, games int) error {
+	if games == 0 {
+		_, err := r.db.ExecContext(ctx, r.q(`INSERT INTO ratings (`+ratingColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+			rating.UserID, rating.Username, rating.Difficulty, rating.Rating, rating.RD, rating.Volatility,
+			rating.Games, utc(rating.UpdatedAt))
+		if isUniqueViolation(err) {
+			// Rated first by a concurrent update
+			return ErrVersionConflict
+		}
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, r.q(`UPDATE ratings SET
+			username = ?, rating = ?, rd = ?, volatility = ?, games = ?, updated_at = ?
+		WHERE user_id = ? AND difficulty = ? AND games = ?`),
+		rating.Username, rating.Rating, rating.RD, rating.Volatility, rating.Games, utc(rating.UpdatedAt),
+		rating.UserID, rating.Difficulty, games)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+func (r *SQLStore) GetRatingBoard(ctx context.Context, difficulty models.Difficulty, offset, limit int) ([]models.PlayerRating, error) {
+	return r.queryRatings(ctx, `SELECT `+ratingColumns+` FROM ratings WHERE difficulty = ?
+		ORDER BY rating DESC, username LIMIT ? OFFSET ?`, difficulty, limit, offset)
+}
+
+func (r *SQLStore) queryRatings(ctx context.Context, query string, args ...interface{}) ([]models.PlayerRating, error) {
+	rows, err := r.db.QueryContext(ctx, r.q(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ratings := []models.PlayerRating{}
+	for rows.Next() {
+		var rating models.PlayerRating
+		if err := rows.Scan(&rating.UserID, &rating.Username, &rating.Difficulty, &rating.Rating, &rating.RD,
+			&rating.Volatility, &rating.Games, &rating.UpdatedAt); err != nil {
+			return nil, err
+		}
+		ratings = append(ratings, rating)
+	}
+	return ratings, rows.Err()
+}
+
+// sqlTime scans timestamps from aggregates and CTEs, which SQLite returns as text
+type sqlTime time.Time
+
+var sqlTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	time.RFC3339Nano,
+}
+
+func (t *sqlTime) Scan(src interface{}) error {
+	var text string
+	switch v := src.(type) {
+	case time.Time:
+		*t = sqlTime(v)
+		return nil
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	case nil:
+		*t = sqlTime(time.Time{})
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into a timestamp", src)
+	}
+	for _, layout := range sqlTimeLayouts {
+		if parsed, err := time.Parse(layout, text); err == nil {
+			*t = sqlTime(parsed)
+			return nil
+		}
+	}
+	return fmt.Errorf("unrecognised timestamp %q", text)
+}
+
+// utc normalises timestamps so they compare correctly when stored as text
+func utc(t time.Time) time.Time {
+	return t.UTC()
+}
+
+func utcPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// marshalNullable encodes a nested document as JSON, or NULL when it's a nil pointer
+func marshalNullable(v interface{}) (sql.NullString, error) {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// unmarshalNullable decodes a JSON column into dest, leaving it untouched when NULL
+func unmarshalNullable(data sql.NullString, dest interface{}) error {
+	if !data.Valid {
+		return nil
+	}
+	return json.Unmarshal([]byte(data.String), dest)
+}
@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"database/sql"
+	"log"
+
+	_ "modernc.org/sqlite"
+)
+
+// NewSQLiteStore opens (or creates) an embedded SQLite database at path.
+// It suits small deployments and local development without Docker.
+// Call Migrate before use to create the schema.
+func NewSQLiteStore(path string) (*SQLStore, error) {
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer; serialising connections avoids SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	log.Printf("SQLite database opened at %s", path)
+
+	return &SQLStore{db: db, dialect: sqliteDialect}, nil
+}
@@ -0,0 +1,311 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/skyquest/server/internal/models"
+)
+
+var (
+	// ErrNotFound is returned when a requested record doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrVersionConflict is returned when a session or user's stats were modified after they were read
+	ErrVersionConflict = errors.New("record was modified concurrently")
+	// ErrDuplicate is returned when a record violates a uniqueness constraint
+	ErrDuplicate = errors.New("already exists")
+)
+
+// SessionStore persists game sessions
+type SessionStore interface {
+	CreateSession(ctx context.Context, session *models.GameSession) error
+	GetSession(ctx context.Context, sessionID string) (*models.GameSession, error)
+	// UpdateSession saves a session only if its stored version matches the one
+	// that was read, then bumps the version. It returns ErrVersionConflict otherwise.
+	UpdateSession(ctx context.Context, session *models.GameSession) error
+	// FindIdleSessions returns in-progress sessions with no activity since cutoff
+	FindIdleSessions(ctx context.Context, cutoff time.Time) ([]models.GameSession, error)
+	// GetUserSessions returns a page of a user's sessions, most recently started first
+	GetUserSessions(ctx context.Context, userID string, offset, limit int) ([]models.GameSession, error)
+	// ListFinishedSessions returns a page of completed and abandoned sessions in
+	// the order they ended, continuing after the cursor; the zero cursor starts
+	// from the first
+	ListFinishedSessions(ctx context.Context, after SessionCursor, limit int) ([]models.GameSession, error)
+}
+
+// SessionCursor identifies the finished session a listing continues after
+type SessionCursor struct {
+	EndedAt   time.Time
+	SessionID string
+}
+
+// CursorAt returns the cursor continuing after a finished session. A session
+// without an end time, which listings leave out, sorts first.
+func CursorAt(session *models.GameSession) SessionCursor {
+	cursor := SessionCursor{SessionID: session.SessionID}
+	if session.EndedAt != nil {
+		cursor.EndedAt = *session.EndedAt
+	}
+	return cursor
+}
+
+// endedAfter reports whether a finished session comes after the cursor
+func endedAfter(session *models.GameSession, cursor SessionCursor) bool {
+	at := CursorAt(session)
+	if !at.EndedAt.Equal(cursor.EndedAt) {
+		return at.EndedAt.After(cursor.EndedAt)
+	}
+	return at.SessionID > cursor.SessionID
+}
+
+// LeaderboardStore persists the best score per username and difficulty, and
+// the score of every game for leaderboards over time windows
+type LeaderboardStore interface {
+	// SaveScore records a finished game: it stores the game's score record,
+	// replacing any earlier one for the session, and atomically keeps the best score.
+	// The game counts towards games played once per player and difficulty, so
+	// saving a session again only counts it if it moved to another player.
+	// Both are tagged with the home country and airport of the user with the
+	// session's username, if there is one.
+	SaveScore(ctx context.Context, session *models.GameSession) error
+	// UpdatePlayerHome re-tags a player's entries and score records after their home changes
+	UpdatePlayerHome(ctx context.Context, username, country, airport string) error
+	// GetLeaderboard returns a ranked page of the board selected by query
+	GetLeaderboard(ctx context.Context, query LeaderboardQuery) ([]models.LeaderboardEntry, error)
+	// GetScore returns a user's all-time entry for a difficulty
+	GetScore(ctx context.Context, username string, difficulty models.Difficulty) (*models.LeaderboardEntry, error)
+	// GetScoresAround returns a user's ranked entry with up to radius entries either
+	// side of it. The query must name a difficulty; its page fields are ignored.
+	GetScoresAround(ctx context.Context, query LeaderboardQuery, username string, radius int) ([]models.LeaderboardEntry, error)
+	GetUserRank(ctx context.Context, username string, difficulty models.Difficulty) (int, error)
+	// GetScoreStanding counts the entries scoring above and equal to a user's score
+	// on the board selected by query, along with the total number of entries.
+	// The query must name a difficulty; its page fields are ignored.
+	GetScoreStanding(ctx context.Context, query LeaderboardQuery, username string) (higher, equal, total int64, err error)
+	// GetCountryLeaderboard ranks countries by the average score of their top
+	// players on the board selected by query, counting players with no home
+	// country towards none. The query must name a difficulty; its Offset and
+	// After are ignored.
+	GetCountryLeaderboard(ctx context.Context, query LeaderboardQuery, top int) ([]models.CountryEntry, error)
+}
+
+// Ranking decides how tied scores are ranked
+type Ranking string
+
+const (
+	// RankCompetition gives tied entries the same rank and skips the ranks they fill (1, 2, 2, 4)
+	RankCompetition Ranking = "competition"
+	// RankDense gives tied entries the same rank without gaps (1, 2, 2, 3)
+	RankDense Ranking = "dense"
+)
+
+// LeaderboardCursor identifies the entry a page of a leaderboard continues after
+type LeaderboardCursor struct {
+	TotalScore int               `json:"s"`
+	Username   string            `json:"u"`
+	Difficulty models.Difficulty `json:"d"`
+}
+
+// LeaderboardQuery selects a leaderboard and a page of it. Boards are ordered by
+// score descending, then username and difficulty.
+type LeaderboardQuery struct {
+	Difficulty models.Difficulty // empty for every difficulty
+	// Since and Until restrict the board to the best score of games played in
+	// [Since, Until). When zero, the board holds the all-time best scores.
+	Since time.Time
+	Until time.Time
+	// Country and Airport restrict the board to players from a home country or airport
+	Country string
+	Airport string
+	Ranking Ranking // competition when empty
+	Limit   int
+	Offset  int
+	// After continues the board after the given entry, in place of Offset
+	After *LeaderboardCursor
+}
+
+func (q LeaderboardQuery) windowed() bool {
+	return !q.Since.IsZero()
+}
+
+// includes reports whether an entry's player belongs on the query's filtered board
+func (q LeaderboardQuery) includes(entry *models.LeaderboardEntry) bool {
+	return (q.Difficulty == "" || entry.Difficulty == q.Difficulty) &&
+		(q.Country == "" || entry.Country == q.Country) &&
+		(q.Airport == "" || entry.Airport == q.Airport)
+}
+
+// rankedEntry is a leaderboard entry with its place on the whole board
+type rankedEntry struct {
+	models.LeaderboardEntry `bson:",inline"`
+	Position                int64 `bson:"position"` // 1-based, in board order
+	CompetitionRank         int64 `bson:"competitionRank"`
+	DenseRank               int64 `bson:"denseRank"`
+	Ties                    int64 `bson:"ties"`    // entries with the same score, itself included
+	Entries                 int64 `bson:"entries"` // entries on the board
+}
+
+// rankedEntries returns entries with the rank the ranking gives them
+func rankedEntries(ranked []rankedEntry, ranking Ranking) []models.LeaderboardEntry {
+	entries := make([]models.LeaderboardEntry, len(ranked))
+	for i, r := range ranked {
+		entries[i] = r.LeaderboardEntry
+		entries[i].Rank = int(r.CompetitionRank)
+		if ranking == RankDense {
+			entries[i].Rank = int(r.DenseRank)
+		}
+	}
+	return entries
+}
+
+// standing returns the counts GetScoreStanding reports for an entry
+func (r rankedEntry) standing() (higher, equal, total int64) {
+	return r.CompetitionRank - 1, r.Ties, r.Entries
+}
+
+// rankCountries gives countries ordered by average score descending competition
+// ranks, tied averages sharing a rank
+func rankCountries(countries []models.CountryEntry) {
+	for i := range countries {
+		if i > 0 && countries[i].AverageScore == countries[i-1].AverageScore {
+			countries[i].Rank = countries[i-1].Rank
+		} else {
+			countries[i].Rank = i + 1
+		}
+	}
+}
+
+// orderedAfter reports whether entry comes after the cursor in board order
+func orderedAfter(entry *models.LeaderboardEntry, cursor *LeaderboardCursor) bool {
+	if entry.TotalScore != cursor.TotalScore {
+		return entry.TotalScore < cursor.TotalScore
+	}
+	if entry.Username != cursor.Username {
+		return entry.Username > cursor.Username
+	}
+	return entry.Difficulty > cursor.Difficulty
+}
+
+// UserStore persists registered players. Usernames are unique.
+type UserStore interface {
+	// CreateUser assigns the user an ID; it returns ErrDuplicate if the username is taken
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUser(ctx context.Context, id string) (*models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+	// GetUserByIdentity finds the user linked to an identity provider's account
+	GetUserByIdentity(ctx context.Context, provider, subject string) (*models.User, error)
+	// UpdateUser saves a user's profile; identities are only changed by
+	// LinkIdentity, stats by UpdateUserStats and progression by UpdateUserProgression
+	UpdateUser(ctx context.Context, user *models.User) error
+	// UpdateUserStats replaces a user's stats if they still count gamesPlayed
+	// games, and returns ErrVersionConflict otherwise
+	UpdateUserStats(ctx context.Context, userID string, stats models.UserStats, gamesPlayed int) error
+	// UpdateUserProgression replaces a user's progression if they still have xp
+	// experience, and returns ErrVersionConflict otherwise
+	UpdateUserProgression(ctx context.Context, userID string, progression models.Progression, xp int) error
+	// LinkIdentity links an identity provider's account to a user. It returns
+	// ErrDuplicate if the account is already linked to a user.
+	LinkIdentity(ctx context.Context, userID string, identity models.UserIdentity) error
+}
+
+// LeaderboardArchive persists snapshots of past leaderboard periods
+type LeaderboardArchive interface {
+	// SaveSnapshot returns ErrDuplicate if the period was already archived
+	SaveSnapshot(ctx context.Context, snapshot *models.LeaderboardSnapshot) error
+	// GetSnapshots returns the most recent snapshots first
+	GetSnapshots(ctx context.Context, window models.LeaderboardWindow, difficulty models.Difficulty, limit int) ([]models.LeaderboardSnapshot, error)
+}
+
+// AchievementStore persists the achievements players have unlocked and their
+// progress towards the others
+type AchievementStore interface {
+	// GetAchievements returns a user's achievements, which are empty at
+	// version 0 for users who have none yet
+	GetAchievements(ctx context.Context, userID string) (*models.PlayerAchievements, error)
+	// SaveAchievements saves a user's achievements only if their stored version
+	// matches the one that was read, then bumps the version. It returns
+	// ErrVersionConflict otherwise.
+	SaveAchievements(ctx context.Context, achievements *models.PlayerAchievements) error
+}
+
+// RatingStore persists players' skill ratings per difficulty
+type RatingStore interface {
+	// GetRatings returns a user's ratings on the difficulties they've played
+	GetRatings(ctx context.Context, userID string) ([]models.PlayerRating, error)
+	// SaveRating replaces a user's rating on a difficulty if it still counts
+	// games rated games, and returns ErrVersionConflict otherwise
+	SaveRating(ctx context.Context, rating *models.PlayerRating, games int) error
+	// GetRatingBoard returns a page of a difficulty's ratings, highest first,
+	// then by username
+	GetRatingBoard(ctx context.Context, difficulty models.Difficulty, offset, limit int) ([]models.PlayerRating, error)
+}
+
+// TournamentStore persists tournaments
+type TournamentStore interface {
+	CreateTournament(ctx context.Context, tournament *models.Tournament) error
+	GetTournament(ctx context.Context, id string) (*models.Tournament, error)
+	// UpdateTournament saves a tournament only if its stored version matches
+	// the one that was read, then bumps the version. It returns
+	// ErrVersionConflict otherwise.
+	UpdateTournament(ctx context.Context, tournament *models.Tournament) error
+	// ListTournaments returns a page of tournaments, most recently created first
+	ListTournaments(ctx context.Context, offset, limit int) ([]models.Tournament, error)
+}
+
+// ChallengeStore persists challenges
+type ChallengeStore interface {
+	CreateChallenge(ctx context.Context, challenge *models.Challenge) error
+	GetChallenge(ctx context.Context, id string) (*models.Challenge, error)
+	// UpdateChallenge saves a challenge only if its stored version matches
+	// the one that was read, then bumps the version. It returns
+	// ErrVersionConflict otherwise.
+	UpdateChallenge(ctx context.Context, challenge *models.Challenge) error
+	// ListChallenges returns a page of challenges, most recently created first
+	ListChallenges(ctx context.Context, offset, limit int) ([]models.Challenge, error)
+}
+
+// Store is a storage backend providing every store
+type Store interface {
+	SessionStore
+	LeaderboardStore
+	LeaderboardArchive
+	UserStore
+	AchievementStore
+	RatingStore
+	TournamentStore
+	ChallengeStore
+	Close() error
+}
+
+// SessionEvicter is implemented by stores that hold sessions in process memory
+// and can drop finished ones to stay bounded
+type SessionEvicter interface {
+	// EvictFinishedSessions drops finished sessions with no activity since cutoff
+	EvictFinishedSessions(cutoff time.Time) int
+}
+
+// newGame reports whether saving a score record over the session's previous
+// one, if any, counts a game for the record's player and difficulty
+func newGame(previous *models.ScoreRecord, record *models.ScoreRecord) bool {
+	return previous == nil || previous.Username != record.Username || previous.Difficulty != record.Difficulty
+}
+
+// newScoreRecord builds the score record of a finished session, tagged with
+// the player's home
+func newScoreRecord(session *models.GameSession, country, airport string) *models.ScoreRecord {
+	playedAt := time.Now()
+	if session.EndedAt != nil {
+		playedAt = *session.EndedAt
+	}
+	return &models.ScoreRecord{
+		SessionID:  session.SessionID,
+		UserID:     session.UserID,
+		Username:   session.Username,
+		Difficulty: session.Difficulty,
+		Score:      session.TotalScore,
+		PlayedAt:   playedAt,
+		Country:    country,
+		Airport:    airport,
+	}
+}
@@ -0,0 +1,451 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skyquest/server/internal/models"
+)
+
+// The store contract runs against every backend that needs no server, and
+// against PostgreSQL and MongoDB when TEST_POSTGRES_URL and TEST_MONGO_URL
+// name a server to use. Records are given unique names so runs can share a
+// database.
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestSQLiteStore(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "skyquest.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	testStore(t, migrated(t, store))
+}
+
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+	store, err := NewPostgresStore(dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	testStore(t, migrated(t, store))
+}
+
+func TestMongoStore(t *testing.T) {
+	uri := os.Getenv("TEST_MONGO_URL")
+	if uri == "" {
+		t.Skip("TEST_MONGO_URL is not set")
+	}
+	store, err := NewMongoRepository(uri, "skyquest_test")
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	testStore(t, store)
+}
+
+func migrated(t *testing.T, store *SQLStore) *SQLStore {
+	t.Helper()
+	t.Cleanup(func() { store.Close() })
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return store
+}
+
+func testStore(t *testing.T, store Store) {
+	t.Run("Sessions", func(t *testing.T) { testSessions(t, store) })
+	t.Run("FinishedSessions", func(t *testing.T) { testFinishedSessions(t, store) })
+	t.Run("Users", func(t *testing.T) { testUsers(t, store) })
+	t.Run("Scores", func(t *testing.T) { testScores(t, store) })
+	t.Run("Tournaments", func(t *testing.T) { testTournaments(t, store) })
+	t.Run("Challenges", func(t *testing.T) { testChallenges(t, store) })
+}
+
+// unique returns a name no earlier run has used
+func unique(prefix string) string {
+	return prefix + "-" + uuid.New().String()[:8]
+}
+
+// now is the current time at the precision every backend keeps
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+func newSession(userID string, startedAt time.Time) *models.GameSession {
+	return &models.GameSession{
+		SessionID:      uuid.New().String(),
+		UserID:         userID,
+		Username:       unique("player"),
+		StartedAt:      startedAt,
+		LastActivityAt: startedAt,
+		Difficulty:     models.DifficultyMedium,
+		Status:         models.SessionInProgress,
+		Rounds: []models.Round{
+			{RoundNumber: 1, FlightID: "f1", Token: "t1", Departure: "FRA", ActualArrival: "JFK", StartedAt: startedAt},
+			{RoundNumber: 2, FlightID: "f2", Token: "t2", Departure: "LHR", ActualArrival: "CDG"},
+		},
+	}
+}
+
+func testSessions(t *testing.T, store Store) {
+	ctx := context.Background()
+	userID := unique("user")
+	start := now().Add(-time.Hour)
+
+	session := newSession(userID, start)
+	session.TournamentID = unique("tournament")
+	if err := store.CreateSession(ctx, session); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := store.GetSession(ctx, uuid.New().String()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get unknown session: got %v, want ErrNotFound", err)
+	}
+
+	stale, err := store.GetSession(ctx, session.SessionID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if stale.TournamentID != session.TournamentID || len(stale.Rounds) != 2 || stale.Rounds[1].ActualArrival != "CDG" {
+		t.Errorf("get: session didn't round-trip: %+v", stale)
+	}
+
+	read, _ := store.GetSession(ctx, session.SessionID)
+	read.Rounds[0].PlayerGuess = "JFK"
+	read.Rounds[0].PointsEarned = 900
+	read.TotalScore = 900
+	if err := store.UpdateSession(ctx, read); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := store.UpdateSession(ctx, stale); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("update from a stale read: got %v, want ErrVersionConflict", err)
+	}
+	updated, _ := store.GetSession(ctx, session.SessionID)
+	if updated.TotalScore != 900 || updated.Rounds[0].PlayerGuess != "JFK" || updated.Rounds[0].PointsEarned != 900 {
+		t.Errorf("update wasn't saved: %+v", updated)
+	}
+
+	// A newer game of the same player, and an idle one
+	newer := newSession(userID, start.Add(time.Minute))
+	if err := store.CreateSession(ctx, newer); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	page, err := store.GetUserSessions(ctx, userID, 0, 10)
+	if err != nil {
+		t.Fatalf("user sessions: %v", err)
+	}
+	if len(page) != 2 || page[0].SessionID != newer.SessionID || page[1].SessionID != session.SessionID {
+		t.Errorf("user sessions aren't newest first: %v", sessionIDs(page))
+	}
+	if page, _ := store.GetUserSessions(ctx, userID, 1, 10); len(page) != 1 || page[0].SessionID != session.SessionID {
+		t.Errorf("user sessions from offset 1: %v", sessionIDs(page))
+	}
+
+	idle, err := store.FindIdleSessions(ctx, start.Add(30*time.Second))
+	if err != nil {
+		t.Fatalf("idle sessions: %v", err)
+	}
+	ids := sessionIDs(idle)
+	if !contains(ids, session.SessionID) || contains(ids, newer.SessionID) {
+		t.Errorf("idle sessions: got %v, want %s and not %s", ids, session.SessionID, newer.SessionID)
+	}
+}
+
+func testFinishedSessions(t *testing.T, store Store) {
+	ctx := context.Background()
+	start := now()
+
+	// Two games ending together are ordered by session ID
+	var finished []string
+	for i, offset := range []time.Duration{time.Second, 2 * time.Second, 2 * time.Second} {
+		session := newSession("", start)
+		session.SessionID = start.Format("20060102150405.000") + "-" + string(rune('a'+i))
+		endedAt := start.Add(offset)
+		session.Status = models.SessionCompleted
+		session.EndedAt = &endedAt
+		if err := store.CreateSession(ctx, session); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		finished = append(finished, session.SessionID)
+	}
+	if err := store.CreateSession(ctx, newSession("", start)); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	// Page through everything that ended since the test started, one at a time
+	cursor := SessionCursor{EndedAt: start}
+	var listed []string
+	for {
+		page, err := store.ListFinishedSessions(ctx, cursor, 1)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		listed = append(listed, page[0].SessionID)
+		cursor = CursorAt(&page[0])
+	}
+	var ours []string
+	for _, id := range listed {
+		if contains(finished, id) {
+			ours = append(ours, id)
+		}
+	}
+	if len(ours) != len(finished) {
+		t.Fatalf("listed %v, want %v", ours, finished)
+	}
+	for i := range finished {
+		if ours[i] != finished[i] {
+			t.Errorf("listed %v, want %v", ours, finished)
+			break
+		}
+	}
+}
+
+func testUsers(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := &models.User{Username: unique("ann"), PasswordHash: "hash", CreatedAt: now()}
+	if err := store.CreateUser(ctx, user); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := store.CreateUser(ctx, &models.User{Username: user.Username, CreatedAt: now()}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("create with a taken username: got %v, want ErrDuplicate", err)
+	}
+
+	byID, err := store.GetUser(ctx, user.ID.Hex())
+	if err != nil || byID.Username != user.Username || !byID.Registered() {
+		t.Errorf("get by ID: got %+v, %v", byID, err)
+	}
+	byName, err := store.GetUserByUsername(ctx, user.Username)
+	if err != nil || byName.ID != user.ID {
+		t.Errorf("get by username: got %+v, %v", byName, err)
+	}
+	if _, err := store.GetUserByUsername(ctx, unique("nobody")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get unknown username: got %v, want ErrNotFound", err)
+	}
+
+	stats := models.UserStats{GamesPlayed: 1, TotalScore: 700, BestScore: 700}
+	if err := store.UpdateUserStats(ctx, user.ID.Hex(), stats, 0); err != nil {
+		t.Fatalf("update stats: %v", err)
+	}
+	if err := store.UpdateUserStats(ctx, user.ID.Hex(), stats, 0); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("update stats from a stale count: got %v, want ErrVersionConflict", err)
+	}
+	if read, _ := store.GetUser(ctx, user.ID.Hex()); read.Stats.GamesPlayed != 1 || read.Stats.BestScore != 700 {
+		t.Errorf("stats weren't saved: %+v", read.Stats)
+	}
+}
+
+func testScores(t *testing.T, store Store) {
+	ctx := context.Background()
+	username := unique("bob")
+	var session *models.GameSession
+	for _, score := range []int{500, 300, 800} {
+		endedAt := now()
+		session = &models.GameSession{
+			SessionID:  uuid.New().String(),
+			Username:   username,
+			Difficulty: models.DifficultyHard,
+			TotalScore: score,
+			Status:     models.SessionCompleted,
+			StartedAt:  endedAt,
+			EndedAt:    &endedAt,
+		}
+		if err := store.SaveScore(ctx, session); err != nil {
+			t.Fatalf("save %d: %v", score, err)
+		}
+		entry, err := store.GetScore(ctx, username, models.DifficultyHard)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		best := score
+		if score < 500 {
+			best = 500
+		}
+		if entry.TotalScore != best {
+			t.Errorf("after scoring %d: best is %d, want %d", score, entry.TotalScore, best)
+		}
+	}
+	if _, err := store.GetScore(ctx, username, models.DifficultyEasy); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get a difficulty never played: got %v, want ErrNotFound", err)
+	}
+
+	// Saving a game again, e.g. on a retry, doesn't count it again
+	session.TotalScore = 900
+	for i := 0; i < 2; i++ {
+		if err := store.SaveScore(ctx, session); err != nil {
+			t.Fatalf("save again: %v", err)
+		}
+	}
+	entry, err := store.GetScore(ctx, username, models.DifficultyHard)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if entry.GamesPlayed != 3 || entry.TotalScore != 900 {
+		t.Errorf("after saving a game again: %d games, best %d; want 3 games, best 900", entry.GamesPlayed, entry.TotalScore)
+	}
+
+	// A game moved to another player, as when claimed, counts for them
+	claimer := unique("carol")
+	session.Username = claimer
+	if err := store.SaveScore(ctx, session); err != nil {
+		t.Fatalf("save under another player: %v", err)
+	}
+	if err := store.SaveScore(ctx, session); err != nil {
+		t.Fatalf("save under another player again: %v", err)
+	}
+	if entry, err := store.GetScore(ctx, claimer, models.DifficultyHard); err != nil || entry.GamesPlayed != 1 {
+		t.Errorf("moved game: got %+v, %v; want 1 game", entry, err)
+	}
+}
+
+func testTournaments(t *testing.T, store Store) {
+	ctx := context.Background()
+	created := now()
+	var ids []string
+	for i := 0; i < 2; i++ {
+		tournament := &models.Tournament{
+			ID:         uuid.New().String(),
+			Name:       unique("cup"),
+			Difficulty: models.DifficultyEasy,
+			Players:    []models.TournamentPlayer{},
+			Stages:     []models.TournamentStage{},
+			CreatedAt:  created.Add(time.Duration(i) * time.Second),
+		}
+		if err := store.CreateTournament(ctx, tournament); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		ids = append(ids, tournament.ID)
+	}
+
+	stale, err := store.GetTournament(ctx, ids[0])
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	read, _ := store.GetTournament(ctx, ids[0])
+	read.Players = append(read.Players, models.TournamentPlayer{UserID: "u1", Username: "ann"})
+	if err := store.UpdateTournament(ctx, read); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := store.UpdateTournament(ctx, stale); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("update from a stale read: got %v, want ErrVersionConflict", err)
+	}
+	if updated, _ := store.GetTournament(ctx, ids[0]); len(updated.Players) != 1 {
+		t.Errorf("update wasn't saved: %+v", updated.Players)
+	}
+	if _, err := store.GetTournament(ctx, uuid.New().String()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get unknown tournament: got %v, want ErrNotFound", err)
+	}
+
+	var listed []string
+	for offset := 0; ; offset += 10 {
+		page, err := store.ListTournaments(ctx, offset, 10)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		for _, tournament := range page {
+			if contains(ids, tournament.ID) {
+				listed = append(listed, tournament.ID)
+			}
+		}
+		if len(page) < 10 {
+			break
+		}
+	}
+	if len(listed) != 2 || listed[0] != ids[1] || listed[1] != ids[0] {
+		t.Errorf("tournaments aren't newest first: got %v", listed)
+	}
+}
+
+func testChallenges(t *testing.T, store Store) {
+	ctx := context.Background()
+	created := now()
+	var ids []string
+	for i := 0; i < 2; i++ {
+		challenge := &models.Challenge{
+			ID:              uuid.New().String(),
+			ChallengerID:    unique("user"),
+			Challenger:      unique("ann"),
+			SourceSessionID: uuid.New().String(),
+			Difficulty:      models.DifficultyHard,
+			Score:           4200,
+			Rounds:          []models.PresetRound{{Flight: models.Flight{ID: "f1"}}},
+			Attempts:        []models.ChallengeAttempt{},
+			CreatedAt:       created.Add(time.Duration(i) * time.Second),
+			ExpiresAt:       created.Add(time.Hour),
+		}
+		if err := store.CreateChallenge(ctx, challenge); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		ids = append(ids, challenge.ID)
+	}
+
+	stale, err := store.GetChallenge(ctx, ids[0])
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if stale.SourceSessionID == "" || len(stale.Rounds) != 1 || stale.Rounds[0].Flight.ID != "f1" {
+		t.Errorf("get: challenge didn't round-trip: %+v", stale)
+	}
+	read, _ := store.GetChallenge(ctx, ids[0])
+	read.Attempts = append(read.Attempts, models.ChallengeAttempt{Username: "bob", SessionID: uuid.New().String()})
+	if err := store.UpdateChallenge(ctx, read); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := store.UpdateChallenge(ctx, stale); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("update from a stale read: got %v, want ErrVersionConflict", err)
+	}
+	if updated, _ := store.GetChallenge(ctx, ids[0]); len(updated.Attempts) != 1 {
+		t.Errorf("update wasn't saved: %+v", updated.Attempts)
+	}
+	if _, err := store.GetChallenge(ctx, uuid.New().String()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get unknown challenge: got %v, want ErrNotFound", err)
+	}
+
+	var listed []string
+	for offset := 0; ; offset += 10 {
+		page, err := store.ListChallenges(ctx, offset, 10)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		for _, challenge := range page {
+			if contains(ids, challenge.ID) {
+				listed = append(listed, challenge.ID)
+			}
+		}
+		if len(page) < 10 {
+			break
+		}
+	}
+	if len(listed) != 2 || listed[0] != ids[1] || listed[1] != ids[0] {
+		t.Errorf("challenges aren't newest first: got %v", listed)
+	}
+}
+
+func sessionIDs(sessions []models.GameSession) []string {
+	ids := make([]string, len(sessions))
+	for i := range sessions {
+		ids[i] = sessions[i].SessionID
+	}
+	return ids
+}
+
+func contains(ids []string, id string) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,457 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/repository"
+	"github.com/skyquest/server/internal/websocket"
+)
+
+// Game events that achievements are earned by
+const (
+	EventRoundScored   = "round:scored"
+	EventGameCompleted = "game:completed"
+	EventStreakReached = "streak:reached"
+)
+
+// achievementQueueSize bounds the events waiting to be evaluated
+const achievementQueueSize = 1024
+
+// Achievement metrics, published on /debug/vars
+var (
+	achievementsUnlocked     = expvar.NewInt("achievements_unlocked_total")
+	achievementEventsDropped = expvar.NewInt("achievement_events_dropped_total")
+	achievementErrors        = expvar.NewInt("achievement_errors_total")
+)
+
+// builtinAchievements are the rules shipped with the server, one badge per file
+//
+//go:embed achievements/*.json
+var builtinAchievements embed.FS
+
+var achievementIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// GameEvent is something that happened in a game
+type GameEvent struct {
+	Type string
+	// Session is a copy of the game as of the event
+	Session models.GameSession
+	// Round is the scored round, for round and streak events
+	Round models.Round
+	// Streak counts the right guesses in a row ending with Round, for streak events
+	Streak int
+}
+
+// newGameEvent copies a session into an event, so that it can be evaluated
+// after the caller has moved on
+func newGameEvent(eventType string, session *models.GameSession) GameEvent {
+	event := GameEvent{Type: eventType, Session: *session}
+	event.Session.Rounds = append([]models.Round(nil), session.Rounds...)
+	return event
+}
+
+// LoadAchievements reads the built-in achievement rules, then the rule files in
+// dir, if set. A rule in dir replaces the built-in rule with the same ID.
+func LoadAchievements(dir string) ([]models.Achievement, error) {
+	builtin, err := fs.Sub(builtinAchievements, "achievements")
+	if err != nil {
+		return nil, err
+	}
+	rules, err := readAchievements(builtin)
+	if err != nil {
+		return nil, fmt.Errorf("built-in achievements: %w", err)
+	}
+	if dir == "" {
+		return rules, nil
+	}
+
+	custom, err := readAchievements(os.DirFS(dir))
+	if err != nil {
+		return nil, fmt.Errorf("achievements in %s: %w", dir, err)
+	}
+	for _, rule := range custom {
+		replaced := false
+		for i := range rules {
+			if rules[i].ID == rule.ID {
+				rules[i] = rule
+				replaced = true
+			}
+		}
+		if !replaced {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// readAchievements reads and checks every .json rule file in a directory
+func readAchievements(fsys fs.FS) ([]models.Achievement, error) {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var rules []models.Achievement
+	seen := make(map[string]string)
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var rule models.Achievement
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&rule); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if err := checkAchievement(&rule); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if other, ok := seen[rule.ID]; ok {
+			return nil, fmt.Errorf("%s: id %q is already used by %s", file, rule.ID, other)
+		}
+		seen[rule.ID] = file
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// checkAchievement rejects rules that could never be unlocked as written, and
+// defaults their count
+func checkAchievement(rule *models.Achievement) error {
+	if !achievementIDPattern.MatchString(rule.ID) {
+		return errors.New("id must be lowercase letters, digits and dashes")
+	}
+	if rule.Name == "" {
+		return errors.New("name is required")
+	}
+	if rule.Count < 0 {
+		return errors.New("count can't be negative")
+	}
+	if rule.Count == 0 {
+		rule.Count = 1
+	}
+
+	when := rule.When
+	switch when.Difficulty {
+	case "", models.DifficultyEasy, models.DifficultyMedium, models.DifficultyHard:
+	default:
+		return fmt.Errorf("unknown difficulty %q", when.Difficulty)
+	}
+	for _, matchType := range when.MatchTypes {
+		switch matchType {
+		case "exact", "family", "country", "distance", "wrong":
+		default:
+			return fmt.Errorf("unknown match type %q", matchType)
+		}
+	}
+	switch rule.Distinct {
+	case "", "airport", "country", "continent":
+	default:
+		return fmt.Errorf("unknown distinct value %q", rule.Distinct)
+	}
+
+	switch rule.Event {
+	case EventRoundScored:
+		if when.MinStreak > 0 || when.Perfect {
+			return errors.New("minStreak and perfect don't apply to scored rounds")
+		}
+	case EventGameCompleted:
+		if len(when.MatchTypes) > 0 || when.MaxGuessTime > 0 || when.MinStreak > 0 || rule.Distinct != "" {
+			return errors.New("matchTypes, maxGuessTime, minStreak and distinct don't apply to completed games")
+		}
+	case EventStreakReached:
+		if len(when.MatchTypes) > 0 || when.MaxGuessTime > 0 || when.MinPoints > 0 || when.Perfect || rule.Distinct != "" {
+			return errors.New("only difficulty and minStreak apply to streaks")
+		}
+	default:
+		return fmt.Errorf("unknown event %q", rule.Event)
+	}
+	return nil
+}
+
+// AchievementService evaluates achievement rules against game events, keeps
+// each player's progress and unlocks, and announces unlocks to the game's client.
+// Events are evaluated in the background so games never wait on them.
+type AchievementService struct {
+	rules         []models.Achievement
+	store         repository.AchievementStore
+	users         repository.UserStore
+	flightService *FlightService
+	hub           *websocket.Hub
+	events        chan GameEvent
+}
+
+func NewAchievementService(rules []models.Achievement, store repository.AchievementStore, users repository.UserStore, flightService *FlightService, hub *websocket.Hub) *AchievementService {
+	return &AchievementService{
+		rules:         rules,
+		store:         store,
+		users:         users,
+		flightService: flightService,
+		hub:           hub,
+		events:        make(chan GameEvent, achievementQueueSize),
+	}
+}
+
+// Achievements returns the achievement rules
+func (s *AchievementService) Achievements() []models.Achievement {
+	return s.rules
+}
+
+// Publish queues a game event for evaluation. Events are dropped while the
+// queue is full, so a slow store never holds up games.
+func (s *AchievementService) Publish(event GameEvent) {
+	select {
+	case s.events <- event:
+	default:
+		achievementEventsDropped.Add(1)
+	}
+}
+
+// Start evaluates queued events, one at a time
+func (s *AchievementService) Start() {
+	for event := range s.events {
+		if err := s.Evaluate(context.Background(), event); err != nil {
+			achievementErrors.Add(1)
+			log.Printf("Error evaluating achievements for session %s: %v", event.Session.SessionID, err)
+		}
+	}
+}
+
+// Evaluate counts an event towards the player's achievements and announces
+// the ones it unlocks
+func (s *AchievementService) Evaluate(ctx context.Context, event GameEvent) error {
+	var rules []models.Achievement
+	for _, rule := range s.rules {
+		if rule.Event == event.Type && s.matches(rule.When, event) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	user, err := playerOf(ctx, s.users, &event.Session)
+	if err != nil {
+		return fmt.Errorf("failed to load player: %w", err)
+	}
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		achievements, err := s.store.GetAchievements(ctx, user.ID.Hex())
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		unlocked, changed := s.advance(achievements, rules, event, now)
+		if !changed {
+			return nil
+		}
+		err = s.store.SaveAchievements(ctx, achievements)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			// Another event for the player was counted first
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		achievementsUnlocked.Add(int64(len(unlocked)))
+		if s.hub != nil {
+			for _, rule := range unlocked {
+				s.hub.SendAchievementUnlocked(event.Session.SessionID, rule, now)
+			}
+		}
+		return nil
+	}
+	return ErrConcurrentUpdate
+}
+
+// advance counts an event towards the player's locked achievements among
+// rules, returning the ones it unlocks and whether anything changed
+func (s *AchievementService) advance(achievements *models.PlayerAchievements, rules []models.Achievement, event GameEvent, now time.Time) ([]models.Achievement, bool) {
+	if achievements.Progress == nil {
+		achievements.Progress = make(map[string]*models.AchievementProgress)
+	}
+	isUnlocked := make(map[string]bool, len(achievements.Unlocked))
+	for _, unlocked := range achievements.Unlocked {
+		isUnlocked[unlocked.ID] = true
+	}
+
+	var unlocked []models.Achievement
+	changed := false
+	for _, rule := range rules {
+		if isUnlocked[rule.ID] {
+			continue
+		}
+		progress, ok := achievements.Progress[rule.ID]
+		if !ok {
+			progress = &models.AchievementProgress{}
+			achievements.Progress[rule.ID] = progress
+		}
+
+		if rule.Distinct != "" {
+			value := s.destination(event.Round, rule.Distinct)
+			if value == "" || containsString(progress.Seen, value) {
+				continue
+			}
+			progress.Seen = append(progress.Seen, value)
+		}
+		progress.Count++
+		changed = true
+
+		if progress.Count >= rule.Count {
+			delete(achievements.Progress, rule.ID)
+			achievements.Unlocked = append(achievements.Unlocked, models.UnlockedAchievement{
+				ID:         rule.ID,
+				SessionID:  event.Session.SessionID,
+				UnlockedAt: now,
+			})
+			unlocked = append(unlocked, rule)
+		}
+	}
+	return unlocked, changed
+}
+
+// matches reports whether an event meets a rule's condition
+func (s *AchievementService) matches(when models.AchievementCondition, event GameEvent) bool {
+	session := &event.Session
+	if when.Difficulty != "" && session.Difficulty != when.Difficulty {
+		return false
+	}
+
+	switch event.Type {
+	case EventRoundScored:
+		round := event.Round
+		if round.Score == nil {
+			return false
+		}
+		if len(when.MatchTypes) > 0 && !containsString(when.MatchTypes, round.Score.MatchType) {
+			return false
+		}
+		if when.MaxGuessTime > 0 && round.GuessTime > when.MaxGuessTime {
+			return false
+		}
+		return round.PointsEarned >= when.MinPoints
+
+	case EventGameCompleted:
+		if session.TotalScore < when.MinPoints {
+			return false
+		}
+		if when.Perfect {
+			for _, round := range session.Rounds {
+				if round.Score == nil || round.Score.MatchType != "exact" {
+					return false
+				}
+			}
+		}
+		return true
+
+	case EventStreakReached:
+		return event.Streak >= when.MinStreak
+	}
+	return false
+}
+
+// destination returns the airport, country or continent a round's flight was
+// headed to, or "" when it isn't known
+func (s *AchievementService) destination(round models.Round, distinct string) string {
+	airport := models.Airport{IATA: round.ActualArrival}
+	if round.Flight != nil && round.Flight.Arrival.IATA == round.ActualArrival {
+		airport = round.Flight.Arrival
+	}
+	if airport.Country == "" {
+		if known, ok := s.flightService.GetAirport(round.ActualArrival); ok {
+			airport = known
+		}
+	}
+
+	switch distinct {
+	case "airport":
+		if airport.IATA == "???" {
+			return ""
+		}
+		return airport.IATA
+	case "country":
+		return airport.Country
+	case "continent":
+		return continentOf(airport.Country)
+	}
+	return ""
+}
+
+// GetPlayerAchievements returns a player's standing on every achievement
+func (s *AchievementService) GetPlayerAchievements(ctx context.Context, username string) ([]models.AchievementStatus, error) {
+	user, err := s.users.GetUserByUsername(ctx, username)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrPlayerNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	achievements, err := s.store.GetAchievements(ctx, user.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	unlocked := make(map[string]models.UnlockedAchievement, len(achievements.Unlocked))
+	for _, u := range achievements.Unlocked {
+		unlocked[u.ID] = u
+	}
+	statuses := make([]models.AchievementStatus, 0, len(s.rules))
+	for _, rule := range s.rules {
+		status := models.AchievementStatus{
+			ID:          rule.ID,
+			Name:        rule.Name,
+			Description: rule.Description,
+			Goal:        rule.Count,
+		}
+		if u, ok := unlocked[rule.ID]; ok {
+			unlockedAt := u.UnlockedAt
+			status.Unlocked = true
+			status.UnlockedAt = &unlockedAt
+			status.SessionID = u.SessionID
+			status.Progress = rule.Count
+		} else if progress, ok := achievements.Progress[rule.ID]; ok {
+			status.Progress = min(progress.Count, rule.Count)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// roundStreak counts the right guesses in a row, to the city, ending with a
+// session's round
+func roundStreak(session *models.GameSession, roundIndex int) int {
+	streak := 0
+	for i := roundIndex; i >= 0; i-- {
+		score := session.Rounds[i].Score
+		if score == nil || (score.MatchType != "exact" && score.MatchType != "family") {
+			break
+		}
+		streak++
+	}
+	return streak
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/repository"
+)
+
+// Archive metrics, published on /debug/vars
+var leaderboardSnapshotsSaved = expvar.NewInt("leaderboard_snapshots_saved_total")
+
+// archiveGracePeriod delays archiving a period so that games finishing just
+// before it ended have had their scores saved
+const archiveGracePeriod = time.Minute
+
+// LeaderboardArchiver rolls calendar leaderboards over: once a day, week or
+// month has ended, it snapshots the period's winners for each difficulty.
+// Several servers may run it at once; each period is archived only once.
+type LeaderboardArchiver struct {
+	scoreService *ScoreService
+	winners      int
+	// archived remembers periods known to be archived to avoid recomputing them
+	archived    map[string]bool
+	archivedMux sync.Mutex
+}
+
+func NewLeaderboardArchiver(scoreService *ScoreService, winners int) *LeaderboardArchiver {
+	if winners <= 0 {
+		winners = 3
+	}
+	return &LeaderboardArchiver{
+		scoreService: scoreService,
+		winners:      winners,
+		archived:     make(map[string]bool),
+	}
+}
+
+// Start archives finished periods now and then every interval
+func (a *LeaderboardArchiver) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := a.Archive(context.Background(), time.Now()); err != nil {
+			log.Printf("Error archiving leaderboards: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// Archive snapshots the most recently ended period of every calendar window,
+// as of now, that hasn't been archived yet. It returns the number of snapshots saved.
+func (a *LeaderboardArchiver) Archive(ctx context.Context, now time.Time) (int, error) {
+	saved := 0
+	var errs []error
+	for _, window := range CalendarWindows {
+		start, end := previousPeriod(window, now.Add(-archiveGracePeriod))
+		for _, difficulty := range []models.Difficulty{models.DifficultyEasy, models.DifficultyMedium, models.DifficultyHard} {
+			ok, err := a.archivePeriod(ctx, window, difficulty, start, end, now)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s %s leaderboard from %s: %w", difficulty, window, start.Format(time.DateOnly), err))
+				continue
+			}
+			if ok {
+				saved++
+			}
+		}
+	}
+	return saved, errors.Join(errs...)
+}
+
+func (a *LeaderboardArchiver) archivePeriod(ctx context.Context, window models.LeaderboardWindow, difficulty models.Difficulty, start, end, now time.Time) (bool, error) {
+	key := fmt.Sprintf("%s:%s:%d", window, difficulty, start.Unix())
+	a.archivedMux.Lock()
+	done := a.archived[key]
+	a.archivedMux.Unlock()
+	if done {
+		return false, nil
+	}
+
+	entries, err := a.scoreService.scores.GetLeaderboard(ctx, repository.LeaderboardQuery{
+		Difficulty: difficulty,
+		Since:      start,
+		Until:      end,
+		Limit:      a.winners,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	saved := false
+	// Periods nobody played aren't worth a snapshot
+	if len(entries) > 0 {
+		err = a.scoreService.archive.SaveSnapshot(ctx, &models.LeaderboardSnapshot{
+			Window:      window,
+			Difficulty:  difficulty,
+			PeriodStart: start,
+			PeriodEnd:   end,
+			Entries:     entries,
+			CreatedAt:   now,
+		})
+		switch {
+		case errors.Is(err, repository.ErrDuplicate):
+			// Another server archived it first
+		case err != nil:
+			return false, err
+		default:
+			saved = true
+			leaderboardSnapshotsSaved.Add(1)
+		}
+	}
+
+	a.archivedMux.Lock()
+	a.archived[key] = true
+	a.archivedMux.Unlock()
+	return saved, nil
+}
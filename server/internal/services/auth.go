@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	tokenIssuer       = "skyquest"
+	minPasswordLength = 8
+	maxPasswordLength = 72 // bcrypt ignores anything longer
+)
+
+var (
+	ErrInvalidUsername    = errors.New("username must be 3-24 letters, digits, '.', '_' or '-'")
+	ErrInvalidPassword    = fmt.Errorf("password must be %d-%d characters", minPasswordLength, maxPasswordLength)
+	ErrUsernameTaken      = errors.New("username is already registered")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+)
+
+// dummyPasswordHash is compared against when a login names no registered user,
+// so that unknown usernames take as long to reject as wrong passwords
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+
+// AuthClaims are the claims of a login token. The subject is the user ID.
+type AuthClaims struct {
+	Username string `json:"username"`
+	jwt.RegisteredClaims
+}
+
+// AuthService registers and logs in players, issuing signed JWTs
+type AuthService struct {
+	users    repository.UserStore
+	secret   []byte
+	tokenTTL time.Duration
+}
+
+func NewAuthService(users repository.UserStore, secret []byte, tokenTTL time.Duration) *AuthService {
+	return &AuthService{
+		users:    users,
+		secret:   secret,
+		tokenTTL: tokenTTL,
+	}
+}
+
+// Register creates an account and logs it in. A guest profile with the same
+// username is upgraded to the account.
+func (s *AuthService) Register(ctx context.Context, req models.RegisterRequest) (*models.AuthResponse, error) {
+	username := strings.TrimSpace(req.Username)
+	if !validUsername(username) {
+		return nil, ErrInvalidUsername
+	}
+	if len(req.Password) < minPasswordLength || len(req.Password) > maxPasswordLength {
+		return nil, ErrInvalidPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.GetUserByUsername(ctx, username)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		user = &models.User{
+			Username:     username,
+			Email:        req.Email,
+			CreatedAt:    time.Now(),
+			PasswordHash: string(hash),
+			Progression:  models.Progression{Level: 1},
+		}
+		err = s.users.CreateUser(ctx, user)
+		if errors.Is(err, repository.ErrDuplicate) {
+			return nil, ErrUsernameTaken
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+	case err != nil:
+		return nil, err
+	case user.Registered():
+		return nil, ErrUsernameTaken
+	default:
+		user.PasswordHash = string(hash)
+		if req.Email != "" {
+			user.Email = req.Email
+		}
+		if err := s.users.UpdateUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to update user: %w", err)
+		}
+	}
+
+	return s.issueToken(user)
+}
+
+// Login checks a player's password and issues a token
+func (s *AuthService) Login(ctx context.Context, req models.LoginRequest) (*models.AuthResponse, error) {
+	user, err := s.users.GetUserByUsername(ctx, strings.TrimSpace(req.Username))
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if user == nil || user.PasswordHash == "" {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		return nil, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return s.issueToken(user)
+}
+
+// ParseToken verifies a token's signature and expiry and returns its claims
+func (s *AuthService) ParseToken(token string) (*AuthClaims, error) {
+	var claims AuthClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(tokenIssuer), jwt.WithExpirationRequired())
+	if err != nil || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+// GetUser returns a logged-in player's account
+func (s *AuthService) GetUser(ctx context.Context, userID string) (*models.User, error) {
+	return s.users.GetUser(ctx, userID)
+}
+
+func (s *AuthService) issueToken(user *models.User) (*models.AuthResponse, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.tokenTTL)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, AuthClaims{
+		Username: user.Username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   user.ID.Hex(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}).SignedString(s.secret)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AuthResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		User:      user,
+	}, nil
+}
+
+// validUsername reports whether a username can be registered
+func validUsername(username string) bool {
+	if len(username) < 3 || len(username) > 24 {
+		return false
+	}
+	for _, c := range username {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
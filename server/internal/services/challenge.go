@@ -0,0 +1,430 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/repository"
+)
+
+// maxChallengeAttempts bounds the players who can take up one challenge
+const maxChallengeAttempts = 50
+
+var (
+	ErrChallengeNotFound    = errors.New("challenge not found")
+	ErrChallengeExpired     = errors.New("challenge has expired")
+	ErrNotYourGame          = errors.New("only the game's player can send it as a challenge")
+	ErrGameNotChallengeable = errors.New("only completed solo games can be sent as challenges")
+	ErrOwnChallenge         = errors.New("can't take up your own challenge")
+	ErrChallengeTaken       = errors.New("challenge already played")
+	ErrChallengeFull        = fmt.Errorf("challenge has been taken up by %d players, the most it can be", maxChallengeAttempts)
+	ErrAttemptNotFound      = errors.New("no such game in the challenge")
+	ErrNotYourDiff          = errors.New("only the challenger and the game's player can compare it")
+)
+
+var challengesCreated = expvar.NewInt("challenges_created_total")
+
+// ChallengeService lets players send the flights of a finished game to
+// friends, who play them at their own pace. Each friend's game is compared
+// with the challenger's once it's finished.
+type ChallengeService struct {
+	challenges    repository.ChallengeStore
+	sessions      repository.SessionStore
+	gameService   *GameService
+	flightService *FlightService
+	ttl           time.Duration
+
+	mu sync.Mutex
+	// held are the flights each open challenge keeps out of the public feed
+	held map[string]heldFlights
+}
+
+// heldFlights are flights held out of the public feed until a time
+type heldFlights struct {
+	ids   []string
+	until time.Time
+}
+
+func NewChallengeService(challenges repository.ChallengeStore, sessions repository.SessionStore, gameService *GameService, flightService *FlightService, ttl time.Duration) *ChallengeService {
+	return &ChallengeService{
+		challenges:    challenges,
+		sessions:      sessions,
+		gameService:   gameService,
+		flightService: flightService,
+		ttl:           ttl,
+		held:          make(map[string]heldFlights),
+	}
+}
+
+// Load keeps the flights of every open challenge in storage out of the public
+// feed
+func (s *ChallengeService) Load(ctx context.Context) error {
+	now := time.Now()
+	for offset := 0; ; offset += historyPageSize {
+		page, err := s.challenges.ListChallenges(ctx, offset, historyPageSize)
+		if err != nil {
+			return fmt.Errorf("failed to list challenges: %w", err)
+		}
+		open := false
+		for i := range page {
+			if now.Before(page[i].ExpiresAt) {
+				s.hold(&page[i], now)
+				open = true
+			}
+		}
+		// Challenges are listed newest first, so older pages have expired too
+		if !open || len(page) < historyPageSize {
+			return nil
+		}
+	}
+}
+
+// CreateChallenge pins the flights of a player's completed game, and the
+// positions they were shown at, in a challenge. Games from rooms and
+// tournaments can't be sent, nor older games whose rounds didn't keep their
+// flights.
+func (s *ChallengeService) CreateChallenge(ctx context.Context, userID, sessionID string) (*models.ChallengeView, error) {
+	session, err := s.sessions.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+	if session.UserID != userID {
+		return nil, ErrNotYourGame
+	}
+	if session.Status == models.SessionInProgress {
+		return nil, ErrGameInProgress
+	}
+	if session.Status != models.SessionCompleted || session.TournamentID != "" || len(session.Rounds) != TotalRounds {
+		return nil, ErrGameNotChallengeable
+	}
+
+	rounds := make([]models.PresetRound, len(session.Rounds))
+	for i, round := range session.Rounds {
+		if round.Flight == nil || round.Display == nil {
+			return nil, ErrGameNotChallengeable
+		}
+		rounds[i] = models.PresetRound{Flight: *round.Flight, Display: *round.Display}
+	}
+
+	now := time.Now()
+	challenge := &models.Challenge{
+		ID:              uuid.New().String(),
+		ChallengerID:    userID,
+		Challenger:      session.Username,
+		SourceSessionID: session.SessionID,
+		Difficulty:      session.Difficulty,
+		Score:           session.TotalScore,
+		Rounds:          rounds,
+		Attempts:        []models.ChallengeAttempt{},
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(s.ttl),
+	}
+	if err := s.challenges.CreateChallenge(ctx, challenge); err != nil {
+		return nil, err
+	}
+	s.hold(challenge, now)
+	challengesCreated.Add(1)
+	return challengeView(challenge, now), nil
+}
+
+// GetChallenge returns a challenge with the games played taking it up
+func (s *ChallengeService) GetChallenge(ctx context.Context, id string) (*models.ChallengeView, error) {
+	challenge, err := s.modify(ctx, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	return challengeView(challenge, time.Now()), nil
+}
+
+// AcceptChallenge starts a player's game on a challenge's flights. Each
+// player takes a challenge up once; if starting the game failed they may try
+// again.
+func (s *ChallengeService) AcceptChallenge(ctx context.Context, id string, req models.StartGameRequest) (*models.StartGameResponse, error) {
+	username, _, err := s.gameService.resolvePlayer(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var preset GamePreset
+	challenge, err := s.modify(ctx, id, func(c *models.Challenge, now time.Time) error {
+		if !now.Before(c.ExpiresAt) {
+			return ErrChallengeExpired
+		}
+		// A challenger could still take theirs up under another guest name,
+		// but such games count towards nothing, so it gains them nothing
+		if req.UserID == c.ChallengerID || strings.EqualFold(username, c.Challenger) {
+			return ErrOwnChallenge
+		}
+
+		i := -1
+		for j, attempt := range c.Attempts {
+			if (req.UserID != "" && attempt.UserID == req.UserID) ||
+				(req.UserID == "" && attempt.UserID == "" && attempt.Username == username) {
+				i = j
+				break
+			}
+		}
+		switch {
+		case i >= 0:
+			if c.Attempts[i].FinishedAt != nil {
+				return ErrChallengeTaken
+			}
+			_, err := s.sessions.GetSession(ctx, c.Attempts[i].SessionID)
+			if err == nil {
+				return ErrChallengeTaken
+			}
+			if !errors.Is(err, repository.ErrNotFound) {
+				return err
+			}
+		case len(c.Attempts) >= maxChallengeAttempts:
+			return ErrChallengeFull
+		default:
+			c.Attempts = append(c.Attempts, models.ChallengeAttempt{
+				UserID:    req.UserID,
+				Username:  username,
+				SessionID: uuid.New().String(),
+				StartedAt: now,
+			})
+			i = len(c.Attempts) - 1
+		}
+		preset = GamePreset{
+			SessionID:   c.Attempts[i].SessionID,
+			ChallengeID: c.ID,
+			Rounds:      c.Rounds,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req.Difficulty = challenge.Difficulty
+	return s.gameService.StartPresetGame(ctx, req, preset)
+}
+
+// GetDiff compares a finished game taking up a challenge, by its number in
+// the challenge, with the challenger's, round by round. Only the challenger
+// and the game's player can see it: userID is the caller's login, and a guest
+// proves the game is theirs with its session ID. The challenge's flights are
+// held out of the feed while it's open, so their arrivals are withheld until
+// it expires.
+func (s *ChallengeService) GetDiff(ctx context.Context, id string, number int, userID, sessionID string) (*models.ChallengeDiff, error) {
+	challenge, err := s.modify(ctx, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	if number < 1 || number > len(challenge.Attempts) {
+		return nil, ErrAttemptNotFound
+	}
+	attempt := &challenge.Attempts[number-1]
+	switch {
+	case userID != "" && userID == challenge.ChallengerID:
+	case attempt.UserID != "" && userID == attempt.UserID:
+	case attempt.UserID == "" && sessionID != "" && sessionID == attempt.SessionID:
+	default:
+		return nil, ErrNotYourDiff
+	}
+	if attempt.FinishedAt == nil {
+		return nil, ErrGameInProgress
+	}
+
+	source, err := s.sessions.GetSession(ctx, challenge.SourceSessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the challenger's game: %w", err)
+	}
+	opponent, err := s.sessions.GetSession(ctx, attempt.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the opponent's game: %w", err)
+	}
+
+	diff := &models.ChallengeDiff{
+		ChallengeID: challenge.ID,
+		Difficulty:  challenge.Difficulty,
+		Challenger: models.ChallengeSide{
+			Username:   challenge.Challenger,
+			TotalScore: source.TotalScore,
+		},
+		Opponent: models.ChallengeSide{
+			Username:   attempt.Username,
+			TotalScore: opponent.TotalScore,
+		},
+		Outcome: attempt.Outcome,
+		Rounds:  make([]models.ChallengeRoundDiff, len(opponent.Rounds)),
+	}
+	for i, round := range opponent.Rounds {
+		shown := s.gameService.replayRound(round, challenge.Difficulty)
+		diff.Rounds[i] = models.ChallengeRoundDiff{
+			RoundNumber: round.RoundNumber,
+			Flight:      shown.Flight,
+			Departure:   shown.Departure,
+			Arrival:     shown.Arrival,
+			Opponent:    challengeGuess(round),
+			PointsDiff:  round.PointsEarned,
+		}
+		if i < len(source.Rounds) {
+			diff.Rounds[i].Challenger = challengeGuess(source.Rounds[i])
+			diff.Rounds[i].PointsDiff -= source.Rounds[i].PointsEarned
+		}
+	}
+	return diff, nil
+}
+
+// modify applies fn to a challenge with its finished games compared, and saves
+// it, retrying on concurrent updates. Without fn the challenge is only saved
+// if a game was newly compared.
+func (s *ChallengeService) modify(ctx context.Context, id string, fn func(c *models.Challenge, now time.Time) error) (*models.Challenge, error) {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		challenge, err := s.challenges.GetChallenge(ctx, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrChallengeNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		s.hold(challenge, now)
+		changed, err := s.compareFinished(ctx, challenge, now)
+		if err != nil {
+			return nil, err
+		}
+		if fn != nil {
+			if err := fn(challenge, now); err != nil {
+				return nil, err
+			}
+			changed = true
+		}
+		if changed {
+			err = s.challenges.UpdateChallenge(ctx, challenge)
+			if errors.Is(err, repository.ErrVersionConflict) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return challenge, nil
+	}
+	return nil, ErrConcurrentUpdate
+}
+
+// compareFinished records the outcome of the challenge's games that have
+// finished since it was last read, and reports whether there were any
+func (s *ChallengeService) compareFinished(ctx context.Context, c *models.Challenge, now time.Time) (bool, error) {
+	changed := false
+	for i := range c.Attempts {
+		attempt := &c.Attempts[i]
+		if attempt.FinishedAt != nil {
+			continue
+		}
+		session, err := s.sessions.GetSession(ctx, attempt.SessionID)
+		if errors.Is(err, repository.ErrNotFound) {
+			// Starting the game failed; the player may try again
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if session.Status == models.SessionInProgress {
+			continue
+		}
+		finishedAt := now
+		if session.EndedAt != nil {
+			finishedAt = *session.EndedAt
+		}
+		attempt.FinishedAt = &finishedAt
+		attempt.Score = session.TotalScore
+		attempt.Outcome = challengeOutcome(attempt.Score, c.Score)
+		changed = true
+	}
+	return changed, nil
+}
+
+// hold keeps an open challenge's flights out of the public feed, so replays and
+// diffs of its games don't give away their arrivals to those yet to play it.
+// The flights of challenges that have expired since are let back in.
+func (s *ChallengeService) hold(c *models.Challenge, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, held := range s.held {
+		if !now.Before(held.until) {
+			delete(s.held, id)
+			s.flightService.ReleaseFromPlay(held.ids...)
+		}
+	}
+	if _, ok := s.held[c.ID]; ok || !now.Before(c.ExpiresAt) {
+		return
+	}
+	ids := make([]string, len(c.Rounds))
+	for i, round := range c.Rounds {
+		ids[i] = round.Flight.ID
+	}
+	s.held[c.ID] = heldFlights{ids: ids, until: c.ExpiresAt}
+	s.flightService.MarkInPlay(ids...)
+}
+
+// challengeOutcome is how a score fared against the challenger's
+func challengeOutcome(score, challengerScore int) string {
+	switch {
+	case score > challengerScore:
+		return models.ChallengeWon
+	case score < challengerScore:
+		return models.ChallengeLost
+	}
+	return models.ChallengeTied
+}
+
+// challengeGuess describes a round's guess for a diff, or nil when the round
+// wasn't guessed
+func challengeGuess(round models.Round) *models.ChallengeGuess {
+	if round.PlayerGuess == "" {
+		return nil
+	}
+	guess := &models.ChallengeGuess{
+		Guess:     round.PlayerGuess,
+		Points:    round.PointsEarned,
+		GuessTime: round.GuessTime,
+	}
+	if round.Score != nil {
+		guess.MatchType = round.Score.MatchType
+		guess.DistanceKm = round.Score.DistanceKm
+		if round.Score.GuessedAirport.IATA != "" {
+			guessed := round.Score.GuessedAirport
+			guess.GuessedAirport = &guessed
+		}
+	}
+	return guess
+}
+
+func challengeView(c *models.Challenge, now time.Time) *models.ChallengeView {
+	view := &models.ChallengeView{
+		ID:         c.ID,
+		Challenger: c.Challenger,
+		Difficulty: c.Difficulty,
+		Score:      c.Score,
+		CreatedAt:  c.CreatedAt,
+		ExpiresAt:  c.ExpiresAt,
+		Expired:    !now.Before(c.ExpiresAt),
+		Attempts:   make([]models.ChallengeTake, len(c.Attempts)),
+	}
+	for i, attempt := range c.Attempts {
+		take := models.ChallengeTake{
+			Number:    i + 1,
+			Username:  attempt.Username,
+			StartedAt: attempt.StartedAt,
+			Finished:  attempt.FinishedAt != nil,
+		}
+		if take.Finished {
+			take.Score = attempt.Score
+			take.Outcome = attempt.Outcome
+		}
+		view.Attempts[i] = take
+	}
+	return view
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/repository"
+)
+
+// resultClaimTimeout is how long a pending result claim is honoured before
+// another request may take over (e.g. after a crash mid-save)
+const resultClaimTimeout = time.Minute
+
+var ErrScoreNotSaved = errors.New("failed to save score")
+
+// CompletionPolicy decides which finished games are written to the leaderboard
+type CompletionPolicy struct {
+	MinRoundsPlayed int  // games with fewer graded rounds are not recorded
+	RecordAbandoned bool // record the partial score of abandoned games
+}
+
+func (p CompletionPolicy) shouldRecord(session *models.GameSession) bool {
+	if pinnedGame(session) {
+		return false
+	}
+	played := roundsPlayed(session)
+	if played == 0 || played < p.MinRoundsPlayed {
+		return false
+	}
+	if session.Status == models.SessionAbandoned && !p.RecordAbandoned {
+		return false
+	}
+	return true
+}
+
+// Game completion pipeline
+//
+// A session is finished by exactly one of: the last guess, an explicit end, or
+// expiry. Whichever path finishes it also claims its result in the same
+// versioned write, so only that request goes on to record the score.
+
+// claimResult marks a session's result as being recorded by the caller
+func claimResult(session *models.GameSession, now time.Time) {
+	claim := &models.GameResult{
+		Status:    models.ResultPending,
+		UpdatedAt: now,
+	}
+	if session.Result != nil {
+		// A retried result must not count the game in the player's stats twice
+		claim.StatsCounted = session.Result.StatsCounted
+		claim.EventPublished = session.Result.EventPublished
+		claim.RatingCounted = session.Result.RatingCounted
+	}
+	session.Result = claim
+}
+
+// resultClaimable reports whether a finished session's result still needs recording
+// and nobody else is working on it
+func resultClaimable(session *models.GameSession, now time.Time) bool {
+	if session.Result == nil {
+		// Finished before results were tracked - its score was saved at the time
+		return false
+	}
+	switch session.Result.Status {
+	case models.ResultFailed:
+		return true
+	case models.ResultPending:
+		return now.Sub(session.Result.UpdatedAt) > resultClaimTimeout
+	}
+	return false
+}
+
+// finishSession ends an in-progress session, or re-claims a finished one whose
+// result was never recorded. It returns the session and whether the caller now
+// owns recording its result. Only the session's player may finish it.
+func (s *GameService) finishSession(ctx context.Context, sessionID, userID string) (*models.GameSession, bool, error) {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		session, err := s.sessions.GetSession(ctx, sessionID)
+		if err != nil {
+			return nil, false, ErrSessionNotFound
+		}
+		if err := checkPlayer(session, userID); err != nil {
+			return nil, false, err
+		}
+
+		now := time.Now()
+		wasInProgress := false
+		switch session.Status {
+		case models.SessionAbandoned:
+			return nil, false, ErrGameExpired
+		case models.SessionInProgress:
+			session.Status = models.SessionCompleted
+			session.EndedAt = &now
+			wasInProgress = true
+		default:
+			if !resultClaimable(session, now) {
+				return session, false, nil
+			}
+		}
+
+		claimResult(session, now)
+		err = s.sessions.UpdateSession(ctx, session)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if wasInProgress {
+			s.flightService.ReleaseFromPlay(sessionFlightIDs(session)...)
+		}
+		return session, true, nil
+	}
+	return nil, false, ErrConcurrentUpdate
+}
+
+// recordResult saves the score of a session whose result the caller has claimed,
+// stores the authoritative rank and percentile on the session, counts the
+// game in the player's stats and rating and publishes its completion to
+// achievements.
+func (s *GameService) recordResult(ctx context.Context, session *models.GameSession) (*models.GameSession, error) {
+	result := models.GameResult{Status: models.ResultSkipped}
+	if session.Result != nil {
+		result.StatsCounted = session.Result.StatsCounted
+		result.EventPublished = session.Result.EventPublished
+		result.RatingCounted = session.Result.RatingCounted
+	}
+
+	var saveErr error
+	if s.completionPolicy.shouldRecord(session) {
+		if err := s.scoreService.SaveScore(ctx, session); err != nil {
+			result.Status = models.ResultFailed
+			saveErr = fmt.Errorf("%w: %v", ErrScoreNotSaved, err)
+		} else {
+			result.Status = models.ResultRecorded
+			standing, err := s.scoreService.GetUserStanding(ctx, session.Username, session.Difficulty)
+			if err != nil {
+				log.Printf("Error getting rank for session %s: %v", session.SessionID, err)
+			} else {
+				result.Rank = standing.Rank
+				result.Percentile = standing.Percentile
+			}
+		}
+	}
+	counted := !pinnedGame(session)
+	if counted && !result.StatsCounted {
+		// Stats failures don't fail the game; the stats backfill catches up
+		if err := s.statsService.RecordGame(ctx, session); err != nil {
+			log.Printf("Error updating stats for session %s: %v", session.SessionID, err)
+		} else {
+			result.StatsCounted = true
+		}
+	}
+	if counted && !result.RatingCounted {
+		// Like stats, a failed rating update is retried with the result
+		if err := s.ratingService.RecordGame(ctx, session); err != nil {
+			log.Printf("Error updating rating for session %s: %v", session.SessionID, err)
+		} else {
+			result.RatingCounted = true
+		}
+	}
+	if counted && !result.EventPublished && session.Status == models.SessionCompleted && roundsPlayed(session) > 0 {
+		s.publish(newGameEvent(EventGameCompleted, session))
+		result.EventPublished = true
+	}
+	result.UpdatedAt = time.Now()
+
+	saved, err := s.saveResult(ctx, session.SessionID, result)
+	if err != nil {
+		return session, err
+	}
+	return saved, saveErr
+}
+
+// saveResult stores a session's result, re-reading the session on version conflicts
+func (s *GameService) saveResult(ctx context.Context, sessionID string, result models.GameResult) (*models.GameSession, error) {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		session, err := s.sessions.GetSession(ctx, sessionID)
+		if err != nil {
+			return nil, ErrSessionNotFound
+		}
+		session.Result = &result
+		err = s.sessions.UpdateSession(ctx, session)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return session, nil
+	}
+	return nil, ErrConcurrentUpdate
+}
+
+// pinnedGame reports whether a game was played on flights picked ahead of it,
+// in a tournament or a challenge. Those flights are known to someone before
+// the game, so it only counts on the tournament's standings or the
+// challenge's comparison: not on the leaderboard, nor towards stats, ratings
+// or achievements.
+func pinnedGame(session *models.GameSession) bool {
+	return session.TournamentID != "" || session.ChallengeID != ""
+}
+
+// roundsPlayed counts the graded rounds of a session
+func roundsPlayed(session *models.GameSession) int {
+	played := 0
+	for _, round := range session.Rounds {
+		if round.PlayerGuess != "" {
+			played++
+		}
+	}
+	return played
+}
@@ -0,0 +1,89 @@
+package services
+
+// countryContinents maps the country names used by airport data to their continent
+var countryContinents = map[string]string{
+	// North America
+	"USA":           "North America",
+	"United States": "North America",
+	"Canada":        "North America",
+	"Mexico":        "North America",
+	"Panama":        "North America",
+	"Costa Rica":    "North America",
+	"Cuba":          "North America",
+	"Jamaica":       "North America",
+	"Bahamas":       "North America",
+
+	// South America
+	"Brazil":    "South America",
+	"Argentina": "South America",
+	"Chile":     "South America",
+	"Colombia":  "South America",
+	"Peru":      "South America",
+	"Ecuador":   "South America",
+	"Venezuela": "South America",
+	"Uruguay":   "South America",
+	"Bolivia":   "South America",
+	"Paraguay":  "South America",
+
+	// Europe
+	"UK":             "Europe",
+	"United Kingdom": "Europe",
+	"Ireland":        "Europe",
+	"France":         "Europe",
+	"Germany":        "Europe",
+	"Netherlands":    "Europe",
+	"Belgium":        "Europe",
+	"Luxembourg":     "Europe",
+	"Spain":          "Europe",
+	"Portugal":       "Europe",
+	"Italy":          "Europe",
+	"Switzerland":    "Europe",
+	"Austria":        "Europe",
+	"Denmark":        "Europe",
+	"Norway":         "Europe",
+	"Sweden":         "Europe",
+	"Finland":        "Europe",
+	"Iceland":        "Europe",
+	"Poland":         "Europe",
+	"Czech Republic": "Europe",
+	"Hungary":        "Europe",
+	"Greece":         "Europe",
+	"Russia":         "Europe",
+
+	// Asia
+	"Turkey":       "Asia",
+	"UAE":          "Asia",
+	"Qatar":        "Asia",
+	"Saudi Arabia": "Asia",
+	"Israel":       "Asia",
+	"India":        "Asia",
+	"China":        "Asia",
+	"Hong Kong":    "Asia",
+	"Taiwan":       "Asia",
+	"Japan":        "Asia",
+	"South Korea":  "Asia",
+	"Singapore":    "Asia",
+	"Malaysia":     "Asia",
+	"Thailand":     "Asia",
+	"Vietnam":      "Asia",
+	"Indonesia":    "Asia",
+	"Philippines":  "Asia",
+
+	// Africa
+	"Egypt":        "Africa",
+	"South Africa": "Africa",
+	"Morocco":      "Africa",
+	"Kenya":        "Africa",
+	"Ethiopia":     "Africa",
+	"Nigeria":      "Africa",
+
+	// Oceania
+	"Australia":   "Oceania",
+	"New Zealand": "Oceania",
+	"Fiji":        "Oceania",
+}
+
+// continentOf returns the continent of a country, or "" when it's unknown
+func continentOf(country string) string {
+	return countryContinents[country]
+}
@@ -2,9 +2,14 @@ package services
 
 import (
 	"context"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"log"
 	"math"
 	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
@@ -21,14 +26,27 @@ type FlightService struct {
 	flightsMux  sync.RWMutex
 	airports    map[string]models.Airport
 	airportsMux sync.RWMutex
+	// Flights used by active game rounds, reference counted by flight ID
+	inPlay    map[string]int
+	inPlayMux sync.RWMutex
+	// routes estimates how hard flights are to guess, to draw them by difficulty
+	routes *RouteStats
+	// feedKey derives the opaque flight IDs shown in the public feed
+	feedKey []byte
 }
 
-func NewFlightService(client *aviation.Client, redis *repository.RedisClient) *FlightService {
+func NewFlightService(client *aviation.Client, redis *repository.RedisClient, routes *RouteStats) *FlightService {
 	fs := &FlightService{
 		client:   client,
 		redis:    redis,
 		flights:  make([]models.Flight, 0),
 		airports: make(map[string]models.Airport),
+		inPlay:   make(map[string]int),
+		routes:   routes,
+		feedKey:  make([]byte, 32),
+	}
+	if _, err := crand.Read(fs.feedKey); err != nil {
+		log.Fatalf("Failed to generate flight feed key: %v", err)
 	}
 	fs.initializeAirports()
 	// Load initial flight data immediately (don't wait for polling)
@@ -154,7 +172,7 @@ func (s *FlightService) fetchAndBroadcast(hub *websocket.Hub) {
 		cached, err := s.redis.GetCachedFlights(ctx)
 		if err == nil && cached != nil {
 			s.updateFlights(cached)
-			hub.BroadcastFlights(cached)
+			hub.BroadcastFlights(s.filterPublic(cached))
 			return
 		}
 	}
@@ -177,7 +195,7 @@ func (s *FlightService) fetchAndBroadcast(hub *websocket.Hub) {
 	}
 
 	s.updateFlights(flights)
-	hub.BroadcastFlights(flights)
+	hub.BroadcastFlights(s.filterPublic(flights))
 }
 
 func (s *FlightService) updateFlights(flights []models.Flight) {
@@ -299,8 +317,82 @@ func (s *FlightService) GetFlights(difficulty models.Difficulty) []models.Flight
 	return filtered
 }
 
-// GetRandomFlights returns n random flights matching difficulty filter
-func (s *FlightService) GetRandomFlights(difficulty models.Difficulty, n int) []models.Flight {
+// GetPublicFlights returns flights matching difficulty that are safe to publish.
+// Flights used in active game rounds are left out, and the rest are redacted
+// so none can be matched to its arrival once a game draws it.
+func (s *FlightService) GetPublicFlights(difficulty models.Difficulty) []models.Flight {
+	return s.filterPublic(s.GetFlights(difficulty))
+}
+
+// MarkInPlay records that flights are being used by an active game
+func (s *FlightService) MarkInPlay(ids ...string) {
+	s.inPlayMux.Lock()
+	defer s.inPlayMux.Unlock()
+	for _, id := range ids {
+		s.inPlay[id]++
+	}
+}
+
+// ReleaseFromPlay undoes MarkInPlay once a game no longer uses the flights
+func (s *FlightService) ReleaseFromPlay(ids ...string) {
+	s.inPlayMux.Lock()
+	defer s.inPlayMux.Unlock()
+	for _, id := range ids {
+		if s.inPlay[id] <= 1 {
+			delete(s.inPlay, id)
+		} else {
+			s.inPlay[id]--
+		}
+	}
+}
+
+// isInPlay reports whether a flight is being used by an active game
+func (s *FlightService) isInPlay(id string) bool {
+	s.inPlayMux.RLock()
+	defer s.inPlayMux.RUnlock()
+	return s.inPlay[id] > 0
+}
+
+// filterPublic drops flights that are in play from a list meant for broadcast
+// and redacts the rest. Any flight may yet be drawn for a game, so the feed
+// never carries its arrival or the codes a flight tracker would look it up
+// by. Live flight IDs are made of those codes, so they're replaced too.
+func (s *FlightService) filterPublic(flights []models.Flight) []models.Flight {
+	s.inPlayMux.RLock()
+	defer s.inPlayMux.RUnlock()
+
+	public := make([]models.Flight, 0, len(flights))
+	for _, f := range flights {
+		if s.inPlay[f.ID] > 0 {
+			continue
+		}
+		f.ID = s.publicFlightID(f.ID)
+		f.ICAO24 = ""
+		f.Aircraft.Registration = ""
+		f.Arrival = models.Airport{
+			IATA: "???",
+			ICAO: "????",
+			Name: "Unknown Destination",
+		}
+		public = append(public, f)
+	}
+	return public
+}
+
+// publicFlightID is the opaque ID a flight has in the public feed. It's stable
+// until the server restarts.
+func (s *FlightService) publicFlightID(id string) string {
+	mac := hmac.New(sha256.New, s.feedKey)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil)[:12])
+}
+
+// GetRandomFlights returns n random flights matching difficulty filter, drawn
+// by how well players have guessed their routes: easy games favour
+// well-guessed routes and hard games obscure ones. The flights meet the
+// selection policy and leave out the seen routes; ErrNotEnoughFlights is
+// returned when too few do.
+func (s *FlightService) GetRandomFlights(difficulty models.Difficulty, n int, policy SelectionPolicy, seen map[string]bool) ([]models.Flight, error) {
 	flights := s.GetFlights(difficulty)
 
 	// Fallback: if no flights match difficulty, try without filter
@@ -324,27 +416,46 @@ func (s *FlightService) GetRandomFlights(difficulty models.Difficulty, n int) []
 
 	if len(flights) == 0 {
 		log.Println("Still no flights available after reload attempt")
-		return nil
+		return nil, ErrNoFlights
 	}
 
-	// Shuffle and take n flights
-	rand.Shuffle(len(flights), func(i, j int) {
-		flights[i], flights[j] = flights[j], flights[i]
+	// Weighted sampling without replacement: each flight draws a key of
+	// u^(1/weight) and the highest keys that meet the policy win
+	target := targetEase[difficulty]
+	keys := make(map[string]float64, len(flights))
+	for _, f := range flights {
+		keys[f.ID] = math.Pow(rand.Float64(), 1/easeWeight(s.routes.FlightEase(f), target))
+	}
+	sort.SliceStable(flights, func(i, j int) bool {
+		return keys[flights[i].ID] > keys[flights[j].ID]
 	})
 
-	if n > len(flights) {
-		n = len(flights)
-	}
-	return flights[:n]
+	return policy.selectFlights(flights, n, seen)
+}
+
+// targetEase is the route ease each difficulty draws flights around
+var targetEase = map[models.Difficulty]float64{
+	models.DifficultyEasy:   0.8,
+	models.DifficultyMedium: 0.5,
+	models.DifficultyHard:   0.2,
+}
+
+// easeWeight is how likely a flight is drawn for a difficulty: highest on
+// target, falling off with distance but never to zero so every flight
+// matching the difficulty can still come up
+func easeWeight(ease, target float64) float64 {
+	d := (ease - target) / 0.25
+	return math.Max(math.Exp(-d*d), 0.01)
 }
 
-// GetFlightByID returns a specific flight
+// GetFlightByID returns a specific flight by its live ID or its ID in the
+// public feed
 func (s *FlightService) GetFlightByID(id string) *models.Flight {
 	s.flightsMux.RLock()
 	defer s.flightsMux.RUnlock()
 
 	for _, f := range s.flights {
-		if f.ID == id {
+		if f.ID == id || s.publicFlightID(f.ID) == id {
 			return &f
 		}
 	}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/pkg/aviation"
+)
+
+func TestPublicFlightsRedacted(t *testing.T) {
+	flights := NewFlightService(aviation.NewClient(""), nil, NewRouteStats())
+	flights.updateFlights([]models.Flight{
+		{
+			ID:        "BA304-LHR-CDG",
+			ICAO24:    "4ca7b5",
+			Departure: models.Airport{IATA: "LHR"},
+			Arrival:   models.Airport{IATA: "CDG", City: "Paris"},
+			Aircraft:  models.Aircraft{Model: "A320", Registration: "G-EUUA"},
+		},
+		{
+			ID:        "in-play",
+			Departure: models.Airport{IATA: "LHR"},
+			Arrival:   models.Airport{IATA: "AMS"},
+		},
+	})
+	flights.MarkInPlay("in-play")
+
+	public := flights.GetPublicFlights(models.DifficultyHard)
+	if len(public) != 1 {
+		t.Fatalf("got %d public flights, want 1 with the flight in play left out", len(public))
+	}
+	flight := public[0]
+	if flight.Arrival.IATA != "???" || flight.Arrival.City != "" {
+		t.Errorf("feed shows the arrival: %+v", flight.Arrival)
+	}
+	if flight.ICAO24 != "" || flight.Aircraft.Registration != "" {
+		t.Errorf("feed shows tracker codes: ICAO24 %q, registration %q", flight.ICAO24, flight.Aircraft.Registration)
+	}
+	if flight.ID == "BA304-LHR-CDG" {
+		t.Error("feed shows the live flight ID")
+	}
+	if flight.Departure.IATA != "LHR" || flight.Aircraft.Model != "A320" {
+		t.Errorf("feed lost the flight's public details: %+v", flight)
+	}
+
+	// The feed's ID still finds the flight, for picking tournament flights
+	found := flights.GetFlightByID(flight.ID)
+	if found == nil || found.ID != "BA304-LHR-CDG" {
+		t.Errorf("feed ID %s found %+v, want the live flight", flight.ID, found)
+	}
+	// The stored flight is left as it was
+	if stored := flights.GetFlightByID("BA304-LHR-CDG"); stored == nil || stored.Arrival.IATA != "CDG" {
+		t.Errorf("redacting the feed changed the stored flight: %+v", stored)
+	}
+}
@@ -3,9 +3,10 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log"
 	"math"
 	"math/rand"
-	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,55 +17,127 @@ import (
 
 const (
 	TotalRounds = 10
+
+	// maxUpdateAttempts bounds retries after optimistic concurrency conflicts
+	maxUpdateAttempts = 3
 )
 
 var (
-	ErrSessionNotFound = errors.New("game session not found")
-	ErrGameCompleted   = errors.New("game already completed")
-	ErrInvalidRound    = errors.New("invalid round")
-	ErrNoFlights       = errors.New("no flights available")
+	ErrSessionNotFound      = errors.New("game session not found")
+	ErrGameCompleted        = errors.New("game already completed")
+	ErrInvalidRound         = errors.New("invalid round")
+	ErrNoFlights            = errors.New("no flights available")
+	ErrStaleRound           = errors.New("guess is not for the current round")
+	ErrConcurrentUpdate     = errors.New("game session is being updated concurrently")
+	ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different round")
+	ErrGameExpired          = errors.New("game session expired")
+	ErrUsernameRequired     = errors.New("username is required to play as a guest")
+	ErrUsernameRegistered   = errors.New("username belongs to a registered player")
+	ErrNotSessionPlayer     = errors.New("game belongs to another player")
 )
 
 type GameService struct {
-	repo          *repository.MongoRepository
+	sessions      repository.SessionStore
+	users         repository.UserStore
 	flightService *FlightService
-	// In-memory session storage (fallback when MongoDB is unavailable)
-	sessions    map[string]*models.GameSession
-	sessionsMux sync.RWMutex
+	scoreService  *ScoreService
+	statsService  *StatsService
+	ratingService *RatingService
+	// achievementService is nil when achievements are off
+	achievementService *AchievementService
+	spectators         *Spectators
+	sessionTTL         time.Duration // idle time before a session is abandoned
+	completionPolicy   CompletionPolicy
+	progressionPolicy  ProgressionPolicy
+	selectionPolicy    SelectionPolicy
 }
 
-func NewGameService(repo *repository.MongoRepository, flightService *FlightService) *GameService {
+func NewGameService(sessions repository.SessionStore, users repository.UserStore, flightService *FlightService, scoreService *ScoreService, statsService *StatsService, ratingService *RatingService, achievementService *AchievementService, spectators *Spectators, sessionTTL time.Duration, completionPolicy CompletionPolicy, progressionPolicy ProgressionPolicy, selectionPolicy SelectionPolicy) *GameService {
 	return &GameService{
-		repo:          repo,
-		flightService: flightService,
-		sessions:      make(map[string]*models.GameSession),
+		sessions:           sessions,
+		users:              users,
+		flightService:      flightService,
+		scoreService:       scoreService,
+		statsService:       statsService,
+		ratingService:      ratingService,
+		achievementService: achievementService,
+		spectators:         spectators,
+		sessionTTL:         sessionTTL,
+		completionPolicy:   completionPolicy,
+		progressionPolicy:  progressionPolicy,
+		selectionPolicy:    selectionPolicy,
 	}
 }
 
 // StartGame creates a new game session
 func (s *GameService) StartGame(ctx context.Context, req models.StartGameRequest) (*models.StartGameResponse, error) {
-	// Get random flights for the game based on difficulty
-	flights := s.flightService.GetRandomFlights(req.Difficulty, TotalRounds)
-	if len(flights) == 0 {
-		return nil, ErrNoFlights
+	username, xp, err := s.resolvePlayer(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.progressionPolicy.checkUnlocked(req.Difficulty, xp); err != nil {
+		return nil, err
+	}
+
+	// Get random flights for the game based on difficulty, leaving out the
+	// routes the player saw last
+	seen, err := s.recentRoutes(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	flights, err := s.flightService.GetRandomFlights(req.Difficulty, TotalRounds, s.selectionPolicy, seen)
+	if err != nil {
+		return nil, err
+	}
+
+	preset := GamePreset{SessionID: uuid.New().String(), Rounds: make([]models.PresetRound, TotalRounds)}
+	for i, flight := range flights {
+		preset.Rounds[i] = models.PresetRound{Flight: flight, Display: s.randomDisplayPosition(flight, req.Difficulty)}
 	}
+	return s.startGame(ctx, req, username, xp, preset)
+}
+
+// GamePreset locks a game to flights chosen ahead of it, shown at fixed
+// positions, so that every player of a tournament stage, or everyone taking
+// up a challenge, plays the same game
+type GamePreset struct {
+	SessionID    string
+	TournamentID string
+	ChallengeID  string
+	Rounds       []models.PresetRound
+}
 
-	// Ensure we have enough flights, duplicate if necessary
-	for len(flights) < TotalRounds {
-		flights = append(flights, flights[len(flights)%len(flights)])
+// StartPresetGame starts a game on a preset's flights. The difficulty's level
+// requirement doesn't apply: whoever set the preset decided who plays it.
+func (s *GameService) StartPresetGame(ctx context.Context, req models.StartGameRequest, preset GamePreset) (*models.StartGameResponse, error) {
+	if len(preset.Rounds) != TotalRounds {
+		return nil, fmt.Errorf("preset has %d rounds, a game has %d", len(preset.Rounds), TotalRounds)
+	}
+	username, xp, err := s.resolvePlayer(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if preset.SessionID == "" {
+		preset.SessionID = uuid.New().String()
 	}
+	return s.startGame(ctx, req, username, xp, preset)
+}
 
-	sessionID := uuid.New().String()
+// startGame stores a new game on a preset's flights and returns its first flight
+func (s *GameService) startGame(ctx context.Context, req models.StartGameRequest, username string, xp int, preset GamePreset) (*models.StartGameResponse, error) {
 	now := time.Now()
 
 	// Create rounds
 	rounds := make([]models.Round, TotalRounds)
 	for i := 0; i < TotalRounds; i++ {
-		flight := flights[i]
+		flight := preset.Rounds[i].Flight
+		display := preset.Rounds[i].Display
 		rounds[i] = models.Round{
 			RoundNumber:   i + 1,
 			FlightID:      flight.ID,
+			Token:         uuid.New().String(),
 			Flight:        &flight,
+			Display:       &display,
 			Departure:     flight.Departure.IATA,
 			ActualArrival: flight.Arrival.IATA,
 			StartedAt:     now,
@@ -72,41 +145,110 @@ func (s *GameService) StartGame(ctx context.Context, req models.StartGameRequest
 	}
 
 	session := &models.GameSession{
-		SessionID:  sessionID,
-		Username:   req.Username,
-		StartedAt:  now,
-		Difficulty: req.Difficulty,
-		TotalScore: 0,
-		Rounds:     rounds,
-		Status:     "in_progress",
-	}
-
-	// Store session (MongoDB or in-memory fallback)
-	if err := s.createSession(ctx, session); err != nil {
+		SessionID:      preset.SessionID,
+		UserID:         req.UserID,
+		Username:       username,
+		StartedAt:      now,
+		Difficulty:     req.Difficulty,
+		TotalScore:     0,
+		Rounds:         rounds,
+		Status:         models.SessionInProgress,
+		LastActivityAt: now,
+		StartXP:        &xp,
+		TournamentID:   preset.TournamentID,
+		ChallengeID:    preset.ChallengeID,
+	}
+
+	// Store session
+	if err := s.sessions.CreateSession(ctx, session); err != nil {
 		return nil, err
 	}
 
+	// Keep this game's flights out of the public feed until it's over
+	s.flightService.MarkInPlay(sessionFlightIDs(session)...)
+
 	// Prepare first flight for response (hide destination based on difficulty)
-	firstFlight := s.prepareFlightForDisplay(flights[0], req.Difficulty)
+	firstFlight := s.prepareFlightForDisplay(rounds[0], req.Difficulty)
 
 	return &models.StartGameResponse{
-		SessionID:    sessionID,
+		SessionID:    session.SessionID,
 		Difficulty:   req.Difficulty,
 		TotalRounds:  TotalRounds,
 		CurrentRound: 1,
-		Flight:       &firstFlight,
+		Flight:       firstFlight,
 	}, nil
 }
 
-// SubmitGuess processes a player's guess
+// resolvePlayer returns the username a game is played under, a logged-in
+// player's own or a guest's chosen one as long as no account has registered
+// it, and the player's experience
+func (s *GameService) resolvePlayer(ctx context.Context, req models.StartGameRequest) (string, int, error) {
+	if req.UserID != "" {
+		user, err := s.users.GetUser(ctx, req.UserID)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to load user: %w", err)
+		}
+		return user.Username, user.Progression.XP, nil
+	}
+
+	if req.Username == "" {
+		return "", 0, ErrUsernameRequired
+	}
+	user, err := s.users.GetUserByUsername(ctx, req.Username)
+	if errors.Is(err, repository.ErrNotFound) {
+		return req.Username, 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if user.Registered() {
+		return "", 0, ErrUsernameRegistered
+	}
+	return req.Username, user.Progression.XP, nil
+}
+
+// SubmitGuess processes a player's guess.
+// Retries with the same idempotency key return the original result, and
+// concurrent guesses for the same round are graded exactly once.
 func (s *GameService) SubmitGuess(ctx context.Context, req models.GuessRequest) (*models.GuessResponse, error) {
-	session, err := s.getSession(ctx, req.SessionID)
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		resp, err := s.trySubmitGuess(ctx, req)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			// Another request updated the session first - reload and re-check
+			continue
+		}
+		return resp, err
+	}
+	return nil, ErrConcurrentUpdate
+}
+
+func (s *GameService) trySubmitGuess(ctx context.Context, req models.GuessRequest) (*models.GuessResponse, error) {
+	session, err := s.sessions.GetSession(ctx, req.SessionID)
 	if err != nil {
 		return nil, ErrSessionNotFound
 	}
+	if err := checkPlayer(session, req.UserID); err != nil {
+		return nil, err
+	}
+
+	// Replay the original result if this guess was already processed
+	if req.IdempotencyKey != "" {
+		for i := range session.Rounds {
+			if session.Rounds[i].GuessKey != req.IdempotencyKey {
+				continue
+			}
+			if session.Rounds[i].RoundNumber != req.RoundNumber {
+				return nil, ErrIdempotencyKeyReused
+			}
+			return s.guessResponse(session, i), nil
+		}
+	}
 
-	if session.Status == "completed" {
+	switch session.Status {
+	case models.SessionCompleted:
 		return nil, ErrGameCompleted
+	case models.SessionAbandoned:
+		return nil, ErrGameExpired
 	}
 
 	// Find current round (first incomplete round)
@@ -124,6 +266,10 @@ func (s *GameService) SubmitGuess(ctx context.Context, req models.GuessRequest)
 		return nil, ErrInvalidRound
 	}
 
+	if req.RoundNumber != currentRound.RoundNumber {
+		return nil, ErrStaleRound
+	}
+
 	// Calculate score
 	guessTime := time.Since(currentRound.StartedAt).Seconds()
 
@@ -143,11 +289,14 @@ func (s *GameService) SubmitGuess(ctx context.Context, req models.GuessRequest)
 
 	// Update round
 	now := time.Now()
-	session.Rounds[roundIndex].PlayerGuess = req.AirportIATA
-	session.Rounds[roundIndex].PointsEarned = score.TotalPoints
-	session.Rounds[roundIndex].GuessTime = guessTime
-	session.Rounds[roundIndex].Confidence = req.Confidence
-	session.Rounds[roundIndex].CompletedAt = &now
+	currentRound.PlayerGuess = req.AirportIATA
+	currentRound.PointsEarned = score.TotalPoints
+	currentRound.GuessTime = guessTime
+	currentRound.Confidence = req.Confidence
+	currentRound.CompletedAt = &now
+	currentRound.GuessKey = req.IdempotencyKey
+	currentRound.Score = &score
+	session.LastActivityAt = now
 
 	// Update total score
 	session.TotalScore += score.TotalPoints
@@ -156,108 +305,208 @@ func (s *GameService) SubmitGuess(ctx context.Context, req models.GuessRequest)
 	isGameOver := roundIndex == TotalRounds-1
 
 	if isGameOver {
-		session.Status = "completed"
+		session.Status = models.SessionCompleted
 		session.EndedAt = &now
+		claimResult(session, now)
+	} else if roundIndex+1 < len(session.Rounds) {
+		// Start the clock on the next round in the same write
+		session.Rounds[roundIndex+1].StartedAt = now
 	}
 
-	// Update session
-	if err := s.updateSession(ctx, session); err != nil {
+	// Update session, failing if another request got there first
+	if err := s.sessions.UpdateSession(ctx, session); err != nil {
 		return nil, err
 	}
 
-	// Prepare next flight if game continues
-	var nextFlight *models.Flight
-	if !isGameOver && roundIndex+1 < len(session.Rounds) {
-		nextRound := session.Rounds[roundIndex+1]
-		nextRound.StartedAt = now
-		session.Rounds[roundIndex+1] = nextRound
-		s.updateSession(ctx, session)
-
-		if nextRound.Flight != nil {
-			prepared := s.prepareFlightForDisplay(*nextRound.Flight, session.Difficulty)
-			nextFlight = &prepared
+	if err := s.awardXP(ctx, session, xpForRound(&score)); err != nil {
+		// The guess itself is graded; the experience is lost
+		log.Printf("Error awarding experience for session %s: %v", session.SessionID, err)
+	}
+
+	if !pinnedGame(session) {
+		event := newGameEvent(EventRoundScored, session)
+		event.Round = session.Rounds[roundIndex]
+		s.publish(event)
+		if streak := roundStreak(session, roundIndex); streak > 0 {
+			event.Type = EventStreakReached
+			event.Streak = streak
+			s.publish(event)
 		}
 	}
 
-	return &models.GuessResponse{
-		Score:       score,
-		RoundNumber: currentRound.RoundNumber,
+	if isGameOver {
+		s.flightService.ReleaseFromPlay(sessionFlightIDs(session)...)
+		if recorded, err := s.recordResult(ctx, session); err != nil {
+			// The guess itself is graded; ending the game again retries the save
+			log.Printf("Error recording result for session %s: %v", session.SessionID, err)
+		} else {
+			session.Result = recorded.Result
+		}
+	}
+	s.spectateRound(session, roundIndex)
+
+	return s.guessResponse(session, roundIndex), nil
+}
+
+// guessResponse builds the response for a graded round
+func (s *GameService) guessResponse(session *models.GameSession, roundIndex int) *models.GuessResponse {
+	round := session.Rounds[roundIndex]
+	isGameOver := roundIndex == TotalRounds-1
+
+	resp := &models.GuessResponse{
+		RoundNumber: round.RoundNumber,
 		IsGameOver:  isGameOver,
-		NextFlight:  nextFlight,
 		TotalScore:  session.TotalScore,
-	}, nil
+		XPEarned:    xpForRound(round.Score),
+	}
+	if round.Score != nil {
+		resp.Score = *round.Score
+	}
+	if session.StartXP != nil {
+		before := *session.StartXP + sessionXP(session, roundIndex)
+		resp.LevelUp = levelUp(before, before+resp.XPEarned)
+	}
+
+	// Prepare next flight if game continues
+	if !isGameOver && roundIndex+1 < len(session.Rounds) {
+		resp.NextFlight = s.prepareFlightForDisplay(session.Rounds[roundIndex+1], session.Difficulty)
+	}
+
+	return resp
 }
 
-// EndGame finalizes a game session
-func (s *GameService) EndGame(ctx context.Context, sessionID string) (*models.EndGameResponse, error) {
-	session, err := s.getSession(ctx, sessionID)
+// EndGame finalizes a game session and records its score. Calling it again
+// returns the same result without counting the game twice.
+func (s *GameService) EndGame(ctx context.Context, req models.EndGameRequest) (*models.EndGameResponse, error) {
+	session, claimed, err := s.finishSession(ctx, req.SessionID, req.UserID)
 	if err != nil {
-		return nil, ErrSessionNotFound
+		return nil, err
 	}
-
-	// Mark as completed if not already
-	if session.Status != "completed" {
-		now := time.Now()
-		session.Status = "completed"
-		session.EndedAt = &now
-		if err := s.updateSession(ctx, session); err != nil {
+	if claimed {
+		if session, err = s.recordResult(ctx, session); err != nil {
 			return nil, err
 		}
+		s.spectateEnd(session)
 	}
 
-	// Get rank (will be calculated after saving score)
-	rank := 0
-
-	return &models.EndGameResponse{
+	resp := &models.EndGameResponse{
 		SessionID:  session.SessionID,
 		TotalScore: session.TotalScore,
 		Rounds:     session.Rounds,
-		Rank:       rank,
 		Difficulty: session.Difficulty,
-	}, nil
+		XPEarned:   sessionXP(session, len(session.Rounds)),
+	}
+	if session.StartXP != nil {
+		resp.LevelUp = levelUp(*session.StartXP, *session.StartXP+resp.XPEarned)
+	}
+	if session.Result != nil {
+		resp.Rank = session.Result.Rank
+		resp.Percentile = session.Result.Percentile
+		resp.Recorded = session.Result.Status == models.ResultRecorded
+	}
+	return resp, nil
 }
 
-// GetSession retrieves a game session
-func (s *GameService) GetSession(ctx context.Context, sessionID string) (*models.GameSession, error) {
-	return s.getSession(ctx, sessionID)
+// GetPlayerGameState returns a redacted view of a session so its player can
+// resume it
+func (s *GameService) GetPlayerGameState(ctx context.Context, sessionID, userID string) (*models.GameStateResponse, error) {
+	session, err := s.sessions.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+	if err := checkPlayer(session, userID); err != nil {
+		return nil, err
+	}
+	return s.gameState(session), nil
 }
 
-// Helper methods for session storage with fallback
+// GetGameState returns a redacted view of a session for the server's own use,
+// without checking who's asking
+func (s *GameService) GetGameState(ctx context.Context, sessionID string) (*models.GameStateResponse, error) {
+	session, err := s.sessions.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+	return s.gameState(session), nil
+}
 
-func (s *GameService) createSession(ctx context.Context, session *models.GameSession) error {
-	if s.repo != nil {
-		return s.repo.CreateSession(ctx, session)
+// gameState builds the redacted view of a session
+func (s *GameService) gameState(session *models.GameSession) *models.GameStateResponse {
+
+	state := &models.GameStateResponse{
+		SessionID:       session.SessionID,
+		Username:        session.Username,
+		Difficulty:      session.Difficulty,
+		Status:          session.Status,
+		TotalRounds:     len(session.Rounds),
+		TotalScore:      session.TotalScore,
+		CompletedRounds: make([]models.CompletedRound, 0, len(session.Rounds)),
+	}
+
+	for _, round := range session.Rounds {
+		if round.PlayerGuess == "" {
+			if state.CurrentRound == 0 && session.Status == models.SessionInProgress {
+				state.CurrentRound = round.RoundNumber
+				state.Flight = s.prepareFlightForDisplay(round, session.Difficulty)
+				state.RoundStartedAt = round.StartedAt
+				state.Deadline = s.sessionDeadline(session)
+			}
+			continue
+		}
+		state.CompletedRounds = append(state.CompletedRounds, models.CompletedRound{
+			RoundNumber:   round.RoundNumber,
+			PlayerGuess:   round.PlayerGuess,
+			ActualArrival: round.ActualArrival,
+			PointsEarned:  round.PointsEarned,
+			GuessTime:     round.GuessTime,
+			Score:         round.Score,
+		})
 	}
-	// In-memory fallback
-	s.sessionsMux.Lock()
-	defer s.sessionsMux.Unlock()
-	s.sessions[session.SessionID] = session
-	return nil
+
+	return state
 }
 
-func (s *GameService) getSession(ctx context.Context, sessionID string) (*models.GameSession, error) {
-	if s.repo != nil {
-		return s.repo.GetSession(ctx, sessionID)
+// sessionDeadline is when an in-progress session will be abandoned if the player stays idle
+func (s *GameService) sessionDeadline(session *models.GameSession) time.Time {
+	lastActivity := session.LastActivityAt
+	if lastActivity.IsZero() {
+		lastActivity = session.StartedAt
 	}
-	// In-memory fallback
-	s.sessionsMux.RLock()
-	defer s.sessionsMux.RUnlock()
-	session, ok := s.sessions[sessionID]
-	if !ok {
+	return lastActivity.Add(s.sessionTTL)
+}
+
+// checkPlayer stops anyone but a registered player from playing their game.
+// Guest games are only guarded by their session ID.
+func checkPlayer(session *models.GameSession, userID string) error {
+	if session.UserID != "" && session.UserID != userID {
+		return ErrNotSessionPlayer
+	}
+	return nil
+}
+
+// GetSession retrieves a game session
+func (s *GameService) GetSession(ctx context.Context, sessionID string) (*models.GameSession, error) {
+	session, err := s.sessions.GetSession(ctx, sessionID)
+	if err != nil {
 		return nil, ErrSessionNotFound
 	}
 	return session, nil
 }
 
-func (s *GameService) updateSession(ctx context.Context, session *models.GameSession) error {
-	if s.repo != nil {
-		return s.repo.UpdateSession(ctx, session)
+// publish hands a game event to the achievements engine
+func (s *GameService) publish(event GameEvent) {
+	if s.achievementService != nil {
+		s.achievementService.Publish(event)
 	}
-	// In-memory fallback
-	s.sessionsMux.Lock()
-	defer s.sessionsMux.Unlock()
-	s.sessions[session.SessionID] = session
-	return nil
+}
+
+// sessionFlightIDs returns the live flight IDs used by a session's rounds
+func sessionFlightIDs(session *models.GameSession) []string {
+	ids := make([]string, 0, len(session.Rounds))
+	for _, round := range session.Rounds {
+		ids = append(ids, round.FlightID)
+	}
+	return ids
 }
 
 // calculateScore determines points based on guess accuracy
@@ -349,9 +598,10 @@ func getSpeedMultiplier(guessTime float64) float64 {
 	return 1.0
 }
 
-// prepareFlightForDisplay hides certain info based on difficulty and generates random flight position
-func (s *GameService) prepareFlightForDisplay(flight models.Flight, difficulty models.Difficulty) models.Flight {
-	displayFlight := flight
+// randomDisplayPosition generates the random position a round's flight is shown at.
+// It's stored on the round so the same view can be served again on resume.
+func (s *GameService) randomDisplayPosition(flight models.Flight, difficulty models.Difficulty) models.DisplayPosition {
+	var display models.DisplayPosition
 
 	// Store airport info before hiding
 	arrivalCity := flight.Arrival.City
@@ -378,51 +628,55 @@ func (s *GameService) prepareFlightForDisplay(flight models.Flight, difficulty m
 	angle := rand.Float64() * 2 * math.Pi // Random angle in radians
 
 	// Calculate aircraft position at random offset from DEPARTURE airport (centered around it)
-	displayFlight.Latitude = departureLat + distance*math.Cos(angle)
-	displayFlight.Longitude = departureLon + distance*math.Sin(angle)
+	display.Latitude = departureLat + distance*math.Cos(angle)
+	display.Longitude = departureLon + distance*math.Sin(angle)
 
 	// Calculate heading from aircraft position towards the ARRIVAL airport
-	displayFlight.Direction = calculateBearing(
-		displayFlight.Latitude, displayFlight.Longitude,
+	display.Direction = calculateBearing(
+		display.Latitude, display.Longitude,
 		arrivalLat, arrivalLon,
 	)
 
 	// Randomize altitude and speed within realistic ranges
-	displayFlight.Altitude = 28000 + rand.Float64()*10000    // 28,000-38,000 ft
-	displayFlight.Speed = 420 + rand.Float64()*100           // 420-520 knots
-	displayFlight.VerticalSpeed = -500 + rand.Float64()*1000 // -500 to +500 ft/min
+	display.Altitude = 28000 + rand.Float64()*10000    // 28,000-38,000 ft
+	display.Speed = 420 + rand.Float64()*100           // 420-520 knots
+	display.VerticalSpeed = -500 + rand.Float64()*1000 // -500 to +500 ft/min
 
-	// Always hide the actual arrival for guessing
-	displayFlight.Arrival = models.Airport{
-		IATA: "???",
-		ICAO: "????",
-		Name: "Unknown Destination",
+	// Add a hint fact about the destination city
+	if GetRedactionPolicy(difficulty).ShowHint && arrivalCity != "" {
+		display.Hint = hints.GetCityFact(arrivalCity, flight.ID)
 	}
 
-	switch difficulty {
-	case models.DifficultyEasy:
-		// Show most info - flight number visible
-		// Add a hint fact about the destination city
-		if arrivalCity != "" {
-			displayFlight.Hint = hints.GetCityFact(arrivalCity, flight.ID)
-		}
-	case models.DifficultyMedium:
-		// Hide flight number, show airline and aircraft
-		displayFlight.FlightNumber = ""
-		displayFlight.Callsign = ""
-	case models.DifficultyHard:
-		// Hide almost everything except position and speed
-		displayFlight.FlightNumber = ""
-		displayFlight.Callsign = ""
-		displayFlight.Airline = models.Airline{}
-		displayFlight.Departure = models.Airport{
-			IATA: "???",
-			ICAO: "????",
-			Name: "Unknown Origin",
-		}
-	}
+	return display
+}
 
-	return displayFlight
+// prepareFlightForDisplay places the flight at the round's stored display position
+// and hides certain info based on difficulty.
+// The flight ID is replaced by the round's opaque token so it can't be looked up.
+func (s *GameService) prepareFlightForDisplay(round models.Round, difficulty models.Difficulty) *models.Flight {
+	if round.Flight == nil {
+		return nil
+	}
+	displayFlight := *round.Flight
+
+	display := round.Display
+	if display == nil {
+		// Sessions created before display positions were stored
+		generated := s.randomDisplayPosition(displayFlight, difficulty)
+		display = &generated
+	}
+	displayFlight.Latitude = display.Latitude
+	displayFlight.Longitude = display.Longitude
+	displayFlight.Altitude = display.Altitude
+	displayFlight.Speed = display.Speed
+	displayFlight.Direction = display.Direction
+	displayFlight.VerticalSpeed = display.VerticalSpeed
+	displayFlight.Hint = display.Hint
+
+	// Hide answer-leaking fields according to the difficulty's redaction policy
+	GetRedactionPolicy(difficulty).Apply(&displayFlight, round.Token)
+
+	return &displayFlight
 }
 
 // calculateBearing calculates the bearing/heading from point 1 to point 2 in degrees
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/repository"
+)
+
+// maxClaimedSessions bounds the sessions claimed in one request
+const maxClaimedSessions = 100
+
+var (
+	ErrTooManySessions = fmt.Errorf("at most %d sessions can be claimed at once", maxClaimedSessions)
+	ErrGameInProgress  = errors.New("game is still in progress")
+)
+
+// SessionPage is a page of a player's games, newest first
+type SessionPage struct {
+	Sessions []models.SessionSummary
+	// NextOffset continues the history after this page; 0 on the last page
+	NextOffset int
+}
+
+// GetUserSessions returns a page of a player's games, newest first
+func (s *GameService) GetUserSessions(ctx context.Context, userID string, offset, limit int) (*SessionPage, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	// Read one more game than asked for to know whether there's another page
+	sessions, err := s.sessions.GetUserSessions(ctx, userID, offset, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &SessionPage{Sessions: []models.SessionSummary{}}
+	if len(sessions) > limit {
+		sessions = sessions[:limit]
+		page.NextOffset = offset + limit
+	}
+	for i := range sessions {
+		page.Sessions = append(page.Sessions, summarizeSession(&sessions[i]))
+	}
+	return page, nil
+}
+
+// GetUserGames returns a page of a registered player's games, newest first,
+// as seen by viewerID. Others aren't shown the session IDs of games still in
+// progress, since those would let them play the games.
+func (s *GameService) GetUserGames(ctx context.Context, userID, viewerID string, offset, limit int) (*SessionPage, error) {
+	if _, err := s.users.GetUser(ctx, userID); errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrPlayerNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	page, err := s.GetUserSessions(ctx, userID, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	if viewerID != userID {
+		for i := range page.Sessions {
+			if page.Sessions[i].Status == models.SessionInProgress {
+				page.Sessions[i].SessionID = ""
+			}
+		}
+	}
+	return page, nil
+}
+
+// GetReplay returns a finished game round by round: the flight as it was
+// shown, its true route, the guess and how it scored. Replays are public, so
+// for a flight that's in play in another game only what the player was shown
+// is kept.
+func (s *GameService) GetReplay(ctx context.Context, sessionID string) (*models.GameReplay, error) {
+	session, err := s.sessions.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+	if session.Status == models.SessionInProgress {
+		return nil, ErrGameInProgress
+	}
+
+	replay := &models.GameReplay{
+		SessionID:  session.SessionID,
+		Username:   session.Username,
+		Difficulty: session.Difficulty,
+		Status:     session.Status,
+		TotalScore: session.TotalScore,
+		StartedAt:  session.StartedAt,
+		EndedAt:    session.EndedAt,
+		Rounds:     []models.ReplayRound{},
+	}
+	for _, round := range session.Rounds {
+		if round.PlayerGuess == "" {
+			continue
+		}
+		replay.Rounds = append(replay.Rounds, s.replayRound(round, session.Difficulty))
+	}
+	return replay, nil
+}
+
+func (s *GameService) replayRound(round models.Round, difficulty models.Difficulty) models.ReplayRound {
+	replayed := models.ReplayRound{
+		RoundNumber: round.RoundNumber,
+		Flight:      s.prepareFlightForDisplay(round, difficulty),
+		GuessTime:   round.GuessTime,
+	}
+
+	var arrival models.Airport
+	if round.Flight != nil {
+		replayed.Departure = round.Flight.Departure
+		arrival = round.Flight.Arrival
+	} else {
+		replayed.Departure, _ = s.flightService.GetAirport(round.Departure)
+		replayed.Departure.IATA = round.Departure
+		arrival, _ = s.flightService.GetAirport(round.ActualArrival)
+		arrival.IATA = round.ActualArrival
+	}
+	if s.flightService.isInPlay(round.FlightID) {
+		// The guess and its distance and points would narrow down the arrival
+		replayed.Withheld = true
+		return replayed
+	}
+	replayed.Arrival = &arrival
+	replayed.Guess = round.PlayerGuess
+	replayed.Points = round.PointsEarned
+
+	if round.Score != nil {
+		replayed.MatchType = round.Score.MatchType
+		replayed.DistanceKm = round.Score.DistanceKm
+		if round.Score.GuessedAirport.IATA != "" {
+			guessed := round.Score.GuessedAirport
+			replayed.GuessedAirport = &guessed
+		}
+	}
+	return replayed
+}
+
+// summarizeSession describes a game without revealing any round's flight
+func summarizeSession(session *models.GameSession) models.SessionSummary {
+	return models.SessionSummary{
+		SessionID:    session.SessionID,
+		Username:     session.Username,
+		Difficulty:   session.Difficulty,
+		Status:       session.Status,
+		TotalScore:   session.TotalScore,
+		RoundsPlayed: roundsPlayed(session),
+		TotalRounds:  len(session.Rounds),
+		StartedAt:    session.StartedAt,
+		EndedAt:      session.EndedAt,
+		Recorded:     session.Result != nil && session.Result.Status == models.ResultRecorded,
+	}
+}
+
+// ClaimSessions attaches games a player played as a guest to their account.
+// Guest games have no other owner, so knowing a session's ID is the proof of
+// having played it; no endpoint shows a guest game's ID to anyone else, and
+// unfinished games' IDs are only shown to their players. Claimed games are
+// renamed to the account's username, and recorded scores are recorded again
+// under it; the guest name's own leaderboard entries are left as they are.
+// Finished games are counted in the account's stats too. It returns the IDs of
+// the sessions now owned by the account, skipping unknown sessions and those
+// owned by other accounts.
+func (s *GameService) ClaimSessions(ctx context.Context, userID string, sessionIDs []string) ([]string, error) {
+	if len(sessionIDs) > maxClaimedSessions {
+		return nil, ErrTooManySessions
+	}
+	user, err := s.users.GetUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+
+	claimed := []string{}
+	for _, sessionID := range sessionIDs {
+		ok, err := s.claimSession(ctx, user, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			claimed = append(claimed, sessionID)
+		}
+	}
+	return claimed, nil
+}
+
+func (s *GameService) claimSession(ctx context.Context, user *models.User, sessionID string) (bool, error) {
+	userID := user.ID.Hex()
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		session, err := s.sessions.GetSession(ctx, sessionID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if session.UserID != "" {
+			return session.UserID == userID, nil
+		}
+
+		renamed := session.Username != user.Username
+		session.UserID = userID
+		session.Username = user.Username
+		err = s.sessions.UpdateSession(ctx, session)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		if renamed && session.Result != nil && session.Result.Status == models.ResultRecorded {
+			if err := s.scoreService.SaveScore(ctx, session); err != nil {
+				return false, fmt.Errorf("%w: %v", ErrScoreNotSaved, err)
+			}
+		}
+		// Games still in progress are counted for the account when they finish
+		if renamed && session.Result != nil && session.Result.StatsCounted {
+			if err := s.statsService.RecordGame(ctx, session); err != nil {
+				log.Printf("Error updating stats for claimed session %s: %v", sessionID, err)
+			}
+		}
+		return true, nil
+	}
+	return false, ErrConcurrentUpdate
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/repository"
+	"github.com/skyquest/server/pkg/aviation"
+)
+
+func TestReplayWithholdsFlightsInPlay(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	flights := NewFlightService(aviation.NewClient(""), nil, NewRouteStats())
+	games := NewGameService(store, store, flights, nil, nil, nil, nil, nil, time.Hour,
+		CompletionPolicy{}, ProgressionPolicy{}, SelectionPolicy{})
+
+	cdg := models.Airport{IATA: "CDG", City: "Paris"}
+	round := func(number int, flightID string) models.Round {
+		flight := models.Flight{ID: flightID, Departure: models.Airport{IATA: "LHR"}, Arrival: cdg}
+		return models.Round{
+			RoundNumber:   number,
+			FlightID:      flightID,
+			Flight:        &flight,
+			Departure:     "LHR",
+			ActualArrival: "CDG",
+			PlayerGuess:   "CDG",
+			PointsEarned:  1000,
+			Score:         &models.ScoreResult{MatchType: "exact", CorrectAirport: cdg, GuessedAirport: cdg},
+		}
+	}
+	ended := time.Now()
+	session := &models.GameSession{
+		SessionID:  "replayed",
+		Username:   "ada",
+		Difficulty: models.DifficultyHard,
+		Status:     models.SessionCompleted,
+		TotalScore: 2000,
+		StartedAt:  ended.Add(-time.Minute),
+		EndedAt:    &ended,
+		Rounds:     []models.Round{round(1, "held"), round(2, "free")},
+	}
+	if err := store.CreateSession(ctx, session); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	flights.MarkInPlay("held")
+
+	replay, err := games.GetReplay(ctx, "replayed")
+	if err != nil {
+		t.Fatalf("get replay: %v", err)
+	}
+	if len(replay.Rounds) != 2 {
+		t.Fatalf("got %d rounds, want 2", len(replay.Rounds))
+	}
+
+	held := replay.Rounds[0]
+	if !held.Withheld || held.Arrival != nil || held.Guess != "" || held.GuessedAirport != nil ||
+		held.MatchType != "" || held.DistanceKm != 0 || held.Points != 0 {
+		t.Errorf("round in play gives the answer away: %+v", held)
+	}
+
+	free := replay.Rounds[1]
+	if free.Withheld || free.Arrival == nil || free.Arrival.IATA != "CDG" || free.Guess != "CDG" ||
+		free.MatchType != "exact" || free.Points != 1000 {
+		t.Errorf("round out of play is missing its result: %+v", free)
+	}
+
+	// Once the flight is out of play, the round is shown in full
+	flights.ReleaseFromPlay("held")
+	replay, err = games.GetReplay(ctx, "replayed")
+	if err != nil {
+		t.Fatalf("get replay: %v", err)
+	}
+	if replay.Rounds[0].Withheld || replay.Rounds[0].Guess != "CDG" {
+		t.Errorf("released round is still withheld: %+v", replay.Rounds[0])
+	}
+}
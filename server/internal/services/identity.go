@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ErrIdentityProvider wraps failures talking to an identity provider
+var ErrIdentityProvider = errors.New("identity provider error")
+
+// ExternalIdentity is a player's account at an identity provider
+type ExternalIdentity struct {
+	// Subject is the provider's stable ID for the account
+	Subject string
+	// Email is set only when the provider has verified it
+	Email string
+	// Username is the account's name at the provider, suggested for new players
+	Username string
+}
+
+// IdentityProvider runs the authorization code flow against one provider
+type IdentityProvider interface {
+	// AuthCodeURL is where the player is sent to log in. The verifier is the
+	// PKCE code verifier; the nonce is bound into OIDC ID tokens.
+	AuthCodeURL(state, nonce, verifier string) string
+	// Exchange redeems the code returned to the callback for the player's identity
+	Exchange(ctx context.Context, code, nonce, verifier string) (*ExternalIdentity, error)
+}
+
+// OIDCProvider logs players in with an OpenID Connect issuer, such as Google
+// or a self-hosted IdP, verifying the signature, audience and nonce of its ID tokens
+type OIDCProvider struct {
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCProvider discovers an issuer's endpoints and signing keys
+func NewOIDCProvider(ctx context.Context, issuer, clientID, clientSecret, redirectURL string, scopes []string) (*OIDCProvider, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("%w: discovery failed: %v", ErrIdentityProvider, err)
+	}
+	if len(scopes) == 0 {
+		scopes = []string{"profile", "email"}
+	}
+	return &OIDCProvider{
+		oauth: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  redirectURL,
+			Scopes:       append([]string{oidc.ScopeOpenID}, scopes...),
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+	}, nil
+}
+
+func (p *OIDCProvider) AuthCodeURL(state, nonce, verifier string) string {
+	return p.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+func (p *OIDCProvider) Exchange(ctx context.Context, code, nonce, verifier string) (*ExternalIdentity, error) {
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: code exchange failed: %v", ErrIdentityProvider, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: no id_token in token response", ErrIdentityProvider)
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid id_token: %v", ErrIdentityProvider, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: id_token nonce mismatch", ErrIdentityProvider)
+	}
+
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		PreferredUsername string `json:"preferred_username"`
+		Name              string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: invalid id_token claims: %v", ErrIdentityProvider, err)
+	}
+	identity := &ExternalIdentity{
+		Subject:  idToken.Subject,
+		Username: claims.PreferredUsername,
+	}
+	if claims.EmailVerified {
+		identity.Email = claims.Email
+	}
+	if identity.Username == "" {
+		identity.Username = claims.Name
+	}
+	if identity.Username == "" {
+		identity.Username, _, _ = strings.Cut(claims.Email, "@")
+	}
+	return identity, nil
+}
+
+// GitHubProvider logs players in with a GitHub OAuth app. GitHub doesn't
+// speak OIDC to apps, so the player is looked up with the access token.
+type GitHubProvider struct {
+	oauth  oauth2.Config
+	apiURL string
+}
+
+// NewGitHubProvider configures a GitHub or GitHub Enterprise OAuth app
+func NewGitHubProvider(webURL, apiURL, clientID, clientSecret, redirectURL string, scopes []string) *GitHubProvider {
+	webURL = strings.TrimSuffix(webURL, "/")
+	if len(scopes) == 0 {
+		scopes = []string{"read:user", "user:email"}
+	}
+	return &GitHubProvider{
+		oauth: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  webURL + "/login/oauth/authorize",
+				TokenURL: webURL + "/login/oauth/access_token",
+			},
+			RedirectURL: redirectURL,
+			Scopes:      scopes,
+		},
+		apiURL: strings.TrimSuffix(apiURL, "/"),
+	}
+}
+
+// AuthCodeURL ignores the nonce, which only OIDC ID tokens carry
+func (p *GitHubProvider) AuthCodeURL(state, nonce, verifier string) string {
+	return p.oauth.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
+}
+
+func (p *GitHubProvider) Exchange(ctx context.Context, code, nonce, verifier string) (*ExternalIdentity, error) {
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: code exchange failed: %v", ErrIdentityProvider, err)
+	}
+	client := p.oauth.Client(ctx, token)
+
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+	}
+	if err := p.get(ctx, client, "/user", &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, fmt.Errorf("%w: GitHub returned no user ID", ErrIdentityProvider)
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	identity := &ExternalIdentity{
+		Subject:  strconv.FormatInt(user.ID, 10),
+		Username: user.Login,
+	}
+	// The email is optional; the user:email scope may not have been granted
+	if err := p.get(ctx, client, "/user/emails", &emails); err == nil {
+		for _, email := range emails {
+			if email.Primary && email.Verified {
+				identity.Email = email.Email
+			}
+		}
+	}
+	return identity, nil
+}
+
+func (p *GitHubProvider) get(ctx context.Context, client *http.Client, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.apiURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: GitHub API request failed: %v", ErrIdentityProvider, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: GitHub API returned %s for %s", ErrIdentityProvider, resp.Status, path)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%w: invalid GitHub API response: %v", ErrIdentityProvider, err)
+	}
+	return nil
+}
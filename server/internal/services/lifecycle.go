@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"time"
+
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/repository"
+	"github.com/skyquest/server/internal/websocket"
+)
+
+// Lifecycle metrics, published on /debug/vars
+var (
+	sessionsExpired      = expvar.NewInt("sessions_expired_total")
+	sessionsEvicted      = expvar.NewInt("sessions_evicted_total")
+	abandonedScoresSaved = expvar.NewInt("abandoned_scores_saved_total")
+	sessionSweepErrors   = expvar.NewInt("session_sweep_errors_total")
+)
+
+// LifecycleManager expires idle game sessions
+type LifecycleManager struct {
+	gameService *GameService
+	hub         *websocket.Hub
+	// retention is how long stores that keep sessions in memory keep finished
+	// ones; 0 keeps them for good
+	retention time.Duration
+}
+
+func NewLifecycleManager(gameService *GameService, hub *websocket.Hub, retention time.Duration) *LifecycleManager {
+	return &LifecycleManager{
+		gameService: gameService,
+		hub:         hub,
+		retention:   retention,
+	}
+}
+
+// Start sweeps for idle sessions every interval
+func (m *LifecycleManager) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := m.Sweep(context.Background()); err != nil {
+			log.Printf("Error sweeping idle sessions: %v", err)
+		}
+	}
+}
+
+// Sweep marks sessions idle for longer than the session TTL as abandoned and,
+// with a retention set, evicts finished sessions from memory. It returns the
+// number of sessions expired.
+func (m *LifecycleManager) Sweep(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-m.gameService.sessionTTL)
+
+	idle, err := m.gameService.sessions.FindIdleSessions(ctx, cutoff)
+	if err != nil {
+		sessionSweepErrors.Add(1)
+		return 0, err
+	}
+
+	expired := 0
+	for i := range idle {
+		session := &idle[i]
+		if err := m.expire(ctx, session); err != nil {
+			if !errors.Is(err, repository.ErrVersionConflict) {
+				sessionSweepErrors.Add(1)
+				log.Printf("Error expiring session %s: %v", session.SessionID, err)
+			}
+			// On conflict the player was active again - leave it for the next sweep
+			continue
+		}
+		expired++
+	}
+	sessionsExpired.Add(int64(expired))
+
+	// Stores that keep sessions in memory may drop finished ones to stay
+	// bounded, at the cost of their history and replays
+	evicted := 0
+	if evicter, ok := m.gameService.sessions.(repository.SessionEvicter); ok && m.retention > 0 {
+		evicted = evicter.EvictFinishedSessions(time.Now().Add(-m.retention))
+		sessionsEvicted.Add(int64(evicted))
+	}
+
+	if expired > 0 || evicted > 0 {
+		log.Printf("Session sweep: %d expired, %d evicted", expired, evicted)
+	}
+	return expired, nil
+}
+
+// expire abandons a session, claiming its result in the same write so the
+// completion pipeline can record it under the abandoned-game policy
+func (m *LifecycleManager) expire(ctx context.Context, session *models.GameSession) error {
+	now := time.Now()
+	session.Status = models.SessionAbandoned
+	session.EndedAt = &now
+	claimResult(session, now)
+	if err := m.gameService.sessions.UpdateSession(ctx, session); err != nil {
+		return err
+	}
+	m.gameService.flightService.ReleaseFromPlay(sessionFlightIDs(session)...)
+
+	recorded, err := m.gameService.recordResult(ctx, session)
+	if err != nil {
+		log.Printf("Error recording result for abandoned session %s: %v", session.SessionID, err)
+	} else if recorded.Result.Status == models.ResultRecorded {
+		abandonedScoresSaved.Add(1)
+	}
+
+	if m.hub != nil {
+		m.hub.SendGameExpired(session.SessionID, session.TotalScore, roundsPlayed(session))
+	}
+	return nil
+}
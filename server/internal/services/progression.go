@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/repository"
+)
+
+const (
+	// roundXP is the experience every graded round earns, right or wrong
+	roundXP = 5
+	// levelXPStep is how much more experience each level takes than the one
+	// before: level 2 is reached at 250 XP, level 3 at 750, level 4 at 1500
+	levelXPStep = 250
+)
+
+var ErrDifficultyLocked = errors.New("difficulty is locked")
+
+// ProgressionPolicy decides which difficulties a player's level unlocks
+type ProgressionPolicy struct {
+	// UnlockLevels is the level each gated difficulty needs; difficulties not
+	// listed are open to every player
+	UnlockLevels map[models.Difficulty]int
+}
+
+// checkUnlocked returns ErrDifficultyLocked if a player with xp experience
+// hasn't reached the level a difficulty needs
+func (p ProgressionPolicy) checkUnlocked(difficulty models.Difficulty, xp int) error {
+	if required := p.UnlockLevels[difficulty]; levelForXP(xp) < required {
+		return fmt.Errorf("%w: reach level %d to play %s", ErrDifficultyLocked, required, difficulty)
+	}
+	return nil
+}
+
+// xpForRound is the experience a graded round earns: a hundredth of its points,
+// which already reward difficulty and speed, on top of the base
+func xpForRound(score *models.ScoreResult) int {
+	if score == nil {
+		return 0
+	}
+	return roundXP + score.TotalPoints/100
+}
+
+// xpForLevel is the experience a level is reached at
+func xpForLevel(level int) int {
+	return levelXPStep * (level - 1) * level / 2
+}
+
+// levelForXP is the level reached with an amount of experience
+func levelForXP(xp int) int {
+	level := 1
+	for xp >= xpForLevel(level+1) {
+		level++
+	}
+	return level
+}
+
+// levelUp reports the levels gained going from one amount of experience to
+// another, or nil if none were
+func levelUp(from, to int) *models.LevelUp {
+	fromLevel, toLevel := levelForXP(from), levelForXP(to)
+	if toLevel <= fromLevel {
+		return nil
+	}
+	return &models.LevelUp{From: fromLevel, To: toLevel}
+}
+
+// sessionXP sums the experience earned by a session's first rounds
+func sessionXP(session *models.GameSession, rounds int) int {
+	xp := 0
+	for _, round := range session.Rounds[:rounds] {
+		xp += xpForRound(round.Score)
+	}
+	return xp
+}
+
+// awardXP adds experience to a game's player
+func (s *GameService) awardXP(ctx context.Context, session *models.GameSession, xp int) error {
+	if xp == 0 {
+		return nil
+	}
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		user, err := playerOf(ctx, s.users, session)
+		if err != nil {
+			return fmt.Errorf("failed to load player: %w", err)
+		}
+		progression := models.Progression{XP: user.Progression.XP + xp}
+		progression.Level = levelForXP(progression.XP)
+		err = s.users.UpdateUserProgression(ctx, user.ID.Hex(), progression, user.Progression.XP)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			// Another of the player's rounds was awarded first
+			continue
+		}
+		return err
+	}
+	return ErrConcurrentUpdate
+}
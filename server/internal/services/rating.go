@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/repository"
+)
+
+// Glicko-2 parameters. Each rated game is its own rating period: a single
+// match against the difficulty of the flights it was played on.
+const (
+	initialRating     = 1500.0
+	initialRD         = 350.0
+	initialVolatility = 0.06
+	// glickoTau constrains how quickly volatility changes
+	glickoTau = 0.5
+	// glickoScale converts between the Glicko and Glicko-2 scales
+	glickoScale   = 173.7178
+	glickoEpsilon = 0.000001
+	// flightRD is the rating deviation of the flight difficulty games are
+	// played against
+	flightRD = 50.0
+)
+
+// RatingService rates players per difficulty with Glicko-2. Ratings depend
+// only on the order games ended in, so they can be recomputed from history.
+type RatingService struct {
+	ratings  repository.RatingStore
+	users    repository.UserStore
+	sessions repository.SessionStore
+	routes   *RouteStats
+}
+
+func NewRatingService(ratings repository.RatingStore, users repository.UserStore, sessions repository.SessionStore, routes *RouteStats) *RatingService {
+	return &RatingService{
+		ratings:  ratings,
+		users:    users,
+		sessions: sessions,
+		routes:   routes,
+	}
+}
+
+// RecordGame rates a completed game's player against the difficulty of its
+// flights, then counts its rounds towards the difficulty of their routes
+func (s *RatingService) RecordGame(ctx context.Context, session *models.GameSession) error {
+	if opponent, score, ok := s.routes.match(session); ok && session.Status == models.SessionCompleted {
+		if err := s.rate(ctx, session, opponent, score); err != nil {
+			return err
+		}
+	}
+	s.routes.add(session)
+	return nil
+}
+
+// GetRatingBoard returns a page of a difficulty's ratings with their ranks
+func (s *RatingService) GetRatingBoard(ctx context.Context, difficulty models.Difficulty, limit, offset int) ([]models.PlayerRating, error) {
+	board, err := s.ratings.GetRatingBoard(ctx, difficulty, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range board {
+		board[i].Rank = offset + i + 1
+	}
+	return board, nil
+}
+
+// rate updates the rating of a game's player
+func (s *RatingService) rate(ctx context.Context, session *models.GameSession, opponent, score float64) error {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		user, err := playerOf(ctx, s.users, session)
+		if err != nil {
+			return fmt.Errorf("failed to load player: %w", err)
+		}
+		ratings, err := s.ratings.GetRatings(ctx, user.ID.Hex())
+		if err != nil {
+			return err
+		}
+		current := ratingOn(ratings, user, session.Difficulty)
+		updated := rateGame(current, opponent, score, session)
+		err = s.ratings.SaveRating(ctx, &updated, current.Games)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			// Another of the player's games was rated first
+			continue
+		}
+		return err
+	}
+	return ErrConcurrentUpdate
+}
+
+// Recompute rates every finished game in storage again, in the order they
+// ended, and returns the number of players updated. As with the stats
+// backfill, run it while the server is quiet.
+func (s *RatingService) Recompute(ctx context.Context) (int, error) {
+	type player struct {
+		session *models.GameSession // a game the player played, to find them by
+		ratings map[models.Difficulty]*models.PlayerRating
+	}
+	players := make(map[string]*player)
+	var order []string
+
+	routes := NewRouteStats()
+	err := eachFinishedSession(ctx, s.sessions, func(session *models.GameSession) {
+		if opponent, score, ok := routes.match(session); ok && session.Status == models.SessionCompleted {
+			key := "user:" + session.UserID
+			if session.UserID == "" {
+				key = "guest:" + session.Username
+			}
+			p, ok := players[key]
+			if !ok {
+				p = &player{session: session, ratings: make(map[models.Difficulty]*models.PlayerRating)}
+				players[key] = p
+				order = append(order, key)
+			}
+			current, ok := p.ratings[session.Difficulty]
+			if !ok {
+				current = &models.PlayerRating{
+					Difficulty: session.Difficulty,
+					Rating:     initialRating,
+					RD:         initialRD,
+					Volatility: initialVolatility,
+				}
+			}
+			updated := rateGame(*current, opponent, score, session)
+			p.ratings[session.Difficulty] = &updated
+		}
+		routes.add(session)
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.routes.replace(routes)
+
+	for _, key := range order {
+		p := players[key]
+		for _, rating := range p.ratings {
+			if err := s.replaceRating(ctx, p.session, *rating); err != nil {
+				return 0, fmt.Errorf("failed to update rating of %s: %w", p.session.Username, err)
+			}
+		}
+	}
+	return len(order), nil
+}
+
+// replaceRating overwrites a game's player's rating on a difficulty
+func (s *RatingService) replaceRating(ctx context.Context, session *models.GameSession, rating models.PlayerRating) error {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		user, err := playerOf(ctx, s.users, session)
+		if err != nil {
+			return err
+		}
+		ratings, err := s.ratings.GetRatings(ctx, user.ID.Hex())
+		if err != nil {
+			return err
+		}
+		current := ratingOn(ratings, user, rating.Difficulty)
+		rating.UserID, rating.Username = current.UserID, current.Username
+		err = s.ratings.SaveRating(ctx, &rating, current.Games)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			continue
+		}
+		return err
+	}
+	return ErrConcurrentUpdate
+}
+
+// ratingOn returns a user's rating on a difficulty, or an initial one if
+// they have none yet
+func ratingOn(ratings []models.PlayerRating, user *models.User, difficulty models.Difficulty) models.PlayerRating {
+	for _, rating := range ratings {
+		if rating.Difficulty == difficulty {
+			return rating
+		}
+	}
+	return models.PlayerRating{
+		UserID:     user.ID.Hex(),
+		Username:   user.Username,
+		Difficulty: difficulty,
+		Rating:     initialRating,
+		RD:         initialRD,
+		Volatility: initialVolatility,
+	}
+}
+
+// rateGame applies the Glicko-2 update for a game scored score, between 0 and
+// 1, against flights of the opponent rating
+func rateGame(rating models.PlayerRating, opponent, score float64, session *models.GameSession) models.PlayerRating {
+	mu := (rating.Rating - initialRating) / glickoScale
+	phi := rating.RD / glickoScale
+	sigma := rating.Volatility
+	opponentMu := (opponent - initialRating) / glickoScale
+	opponentPhi := flightRD / glickoScale
+
+	g := 1 / math.Sqrt(1+3*opponentPhi*opponentPhi/(math.Pi*math.Pi))
+	expected := 1 / (1 + math.Exp(-g*(mu-opponentMu)))
+	v := 1 / (g * g * expected * (1 - expected))
+	delta := v * g * (score - expected)
+
+	// Find the new volatility with the Illinois algorithm
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(glickoTau*glickoTau)
+	}
+	lower := a
+	var upper float64
+	if delta*delta > phi*phi+v {
+		upper = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*glickoTau) < 0 {
+			k++
+		}
+		upper = a - k*glickoTau
+	}
+	fLower, fUpper := f(lower), f(upper)
+	for math.Abs(upper-lower) > glickoEpsilon {
+		c := lower + (lower-upper)*fLower/(fUpper-fLower)
+		fc := f(c)
+		if fc*fUpper <= 0 {
+			lower, fLower = upper, fUpper
+		} else {
+			fLower /= 2
+		}
+		upper, fUpper = c, fc
+	}
+	volatility := math.Exp(lower / 2)
+
+	phiStar := math.Sqrt(phi*phi + volatility*volatility)
+	newPhi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	newMu := mu + newPhi*newPhi*g*(score-expected)
+
+	rating.Rating = initialRating + glickoScale*newMu
+	rating.RD = math.Min(glickoScale*newPhi, initialRD)
+	rating.Volatility = volatility
+	rating.Games++
+	rating.UpdatedAt = time.Time{}
+	if session.EndedAt != nil {
+		rating.UpdatedAt = *session.EndedAt
+	}
+	return rating
+}
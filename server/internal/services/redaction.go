@@ -0,0 +1,83 @@
+package services
+
+import (
+	"github.com/skyquest/server/internal/models"
+)
+
+// RedactionPolicy controls which flight fields a player may see for a difficulty.
+// Fields that can be looked up on a public flight tracker to reveal the
+// destination (live flight ID, ICAO24 hex code, aircraft registration) are
+// never shown, regardless of policy.
+type RedactionPolicy struct {
+	ShowFlightNumber bool // flight number and callsign
+	ShowAirline      bool
+	ShowAircraft     bool // aircraft type, never the registration
+	ShowDeparture    bool
+	ShowHint         bool // destination city fact
+}
+
+var redactionPolicies = map[models.Difficulty]RedactionPolicy{
+	// Easy: flight number is shown on purpose, plus a hint about the destination
+	models.DifficultyEasy: {
+		ShowFlightNumber: true,
+		ShowAirline:      true,
+		ShowAircraft:     true,
+		ShowDeparture:    true,
+		ShowHint:         true,
+	},
+	// Medium: airline and aircraft type only
+	models.DifficultyMedium: {
+		ShowAirline:   true,
+		ShowAircraft:  true,
+		ShowDeparture: true,
+	},
+	// Hard: position, speed, altitude and aircraft type only
+	models.DifficultyHard: {
+		ShowAircraft: true,
+	},
+}
+
+// GetRedactionPolicy returns the redaction policy for a difficulty.
+// Unknown difficulties get the strictest policy.
+func GetRedactionPolicy(difficulty models.Difficulty) RedactionPolicy {
+	if policy, ok := redactionPolicies[difficulty]; ok {
+		return policy
+	}
+	return redactionPolicies[models.DifficultyHard]
+}
+
+// Apply strips answer-leaking fields from a flight in place.
+// The flight ID is replaced by the opaque round token.
+func (p RedactionPolicy) Apply(flight *models.Flight, roundToken string) {
+	flight.ID = roundToken
+	flight.ICAO24 = ""
+	flight.Aircraft.Registration = ""
+
+	// Always hide the actual arrival for guessing
+	flight.Arrival = models.Airport{
+		IATA: "???",
+		ICAO: "????",
+		Name: "Unknown Destination",
+	}
+
+	if !p.ShowFlightNumber {
+		flight.FlightNumber = ""
+		flight.Callsign = ""
+	}
+	if !p.ShowAirline {
+		flight.Airline = models.Airline{}
+	}
+	if !p.ShowAircraft {
+		flight.Aircraft = models.Aircraft{}
+	}
+	if !p.ShowDeparture {
+		flight.Departure = models.Airport{
+			IATA: "???",
+			ICAO: "????",
+			Name: "Unknown Origin",
+		}
+	}
+	if !p.ShowHint {
+		flight.Hint = ""
+	}
+}
@@ -0,0 +1,625 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/websocket"
+)
+
+const (
+	roomCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // no 0/O or 1/I
+	roomCodeLength   = 6
+	// finishedRoomTTL is how long a finished room's scoreboard stays up
+	finishedRoomTTL = 5 * time.Minute
+)
+
+var (
+	ErrRoomNotFound      = errors.New("room not found")
+	ErrRoomStarted       = errors.New("room has already started")
+	ErrRoomFull          = errors.New("room is full")
+	ErrRoomUsernameTaken = errors.New("username is already in the room")
+	ErrNotRoomHost       = errors.New("only the host can start the room")
+	ErrNotInRoom         = errors.New("not a player in the room")
+	ErrRoundClosed       = errors.New("round is not open for guesses")
+	ErrAlreadyLockedIn   = errors.New("guess is already locked in")
+)
+
+var (
+	roomsOpened  = expvar.NewInt("rooms_opened_total")
+	roomsStarted = expvar.NewInt("rooms_started_total")
+)
+
+// RoomPolicy sizes and times multiplayer rooms
+type RoomPolicy struct {
+	MaxPlayers     int
+	RoundDuration  time.Duration // time players have to lock in a guess
+	RevealDuration time.Duration // time a round's results show before the next round
+	LobbyTTL       time.Duration // lobbies not started by then are closed
+}
+
+// RoomService runs multiplayer rooms: every player gets the same flight at
+// the same moment, guesses stay locked until the round's timer ends, and the
+// results are revealed to all at once. Only the server moves a room between
+// states. Rooms live in memory and aren't recorded to the leaderboard.
+type RoomService struct {
+	gameService *GameService
+	hub         *websocket.Hub
+	policy      RoomPolicy
+	rooms       map[string]*room
+	mu          sync.RWMutex
+}
+
+type room struct {
+	mu         sync.Mutex
+	code       string
+	difficulty models.Difficulty
+	host       string // player ID
+	players    map[string]*roomPlayer
+	order      []string // player IDs in the order they joined
+	state      models.RoomState
+	rounds     []models.Round
+	current    int // index of the open or revealed round
+	endsAt     time.Time
+	guesses    map[string]*models.RoomGuess // the current round's, by player ID
+	revealed   *models.WSRoomReveal         // the last round's reveal
+	timer      *time.Timer
+}
+
+type roomPlayer struct {
+	username string
+	userID   string
+	score    int
+}
+
+func NewRoomService(gameService *GameService, hub *websocket.Hub, policy RoomPolicy) *RoomService {
+	return &RoomService{
+		gameService: gameService,
+		hub:         hub,
+		policy:      policy,
+		rooms:       make(map[string]*room),
+	}
+}
+
+// CreateRoom opens a lobby with the caller as its host
+func (s *RoomService) CreateRoom(ctx context.Context, req models.CreateRoomRequest) (*models.RoomTicket, error) {
+	username, xp, err := s.gameService.resolvePlayer(ctx, models.StartGameRequest{Username: req.Username, UserID: req.UserID})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.gameService.progressionPolicy.checkUnlocked(req.Difficulty, xp); err != nil {
+		return nil, err
+	}
+
+	playerID := uuid.New().String()
+	r := &room{
+		difficulty: req.Difficulty,
+		host:       playerID,
+		players:    map[string]*roomPlayer{playerID: {username: username, userID: req.UserID}},
+		order:      []string{playerID},
+		state:      models.RoomLobby,
+	}
+
+	s.mu.Lock()
+	for r.code == "" || s.rooms[r.code] != nil {
+		if r.code, err = newRoomCode(); err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+	}
+	s.rooms[r.code] = r
+	s.mu.Unlock()
+	roomsOpened.Add(1)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s.policy.LobbyTTL > 0 {
+		s.schedule(r, s.policy.LobbyTTL, func() {
+			if r.state == models.RoomLobby {
+				s.finish(r)
+			}
+		})
+	}
+	return &models.RoomTicket{Code: r.code, PlayerID: playerID, Room: s.view(r, 0)}, nil
+}
+
+// JoinRoom adds the caller to a room's lobby. A logged-in player already in
+// the room gets their place back.
+func (s *RoomService) JoinRoom(ctx context.Context, code string, req models.JoinRoomRequest) (*models.RoomTicket, error) {
+	username, _, err := s.gameService.resolvePlayer(ctx, models.StartGameRequest{Username: req.Username, UserID: req.UserID})
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.room(code)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range r.order {
+		p := r.players[id]
+		if p.username != username {
+			continue
+		}
+		if req.UserID != "" && p.userID == req.UserID {
+			return &models.RoomTicket{Code: r.code, PlayerID: id, Room: s.view(r, 0)}, nil
+		}
+		return nil, ErrRoomUsernameTaken
+	}
+	if r.state != models.RoomLobby {
+		return nil, ErrRoomStarted
+	}
+	if s.policy.MaxPlayers > 0 && len(r.players) >= s.policy.MaxPlayers {
+		return nil, ErrRoomFull
+	}
+
+	playerID := uuid.New().String()
+	r.players[playerID] = &roomPlayer{username: username, userID: req.UserID}
+	r.order = append(r.order, playerID)
+	s.broadcastState(r)
+	return &models.RoomTicket{Code: r.code, PlayerID: playerID, Room: s.view(r, 0)}, nil
+}
+
+// GetRoom returns a room as its players see it
+func (s *RoomService) GetRoom(code string) (*models.RoomView, error) {
+	r, err := s.room(code)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return s.view(r, 0), nil
+}
+
+// HandleMessage handles a "room:" message from a WebSocket client:
+//
+//	room:join  {code, playerId}          connect as a player holding a ticket
+//	room:start {}                        the host starts the game
+//	room:guess {roundNumber, airportIata} lock in a guess for the open round
+func (s *RoomService) HandleMessage(client *websocket.Client, msg models.WSMessage) {
+	var err error
+	switch msg.Type {
+	case "room:join":
+		var payload struct {
+			Code     string `json:"code"`
+			PlayerID string `json:"playerId"`
+		}
+		if err = decodePayload(msg.Payload, &payload); err == nil {
+			err = s.connect(client, payload.Code, payload.PlayerID)
+		}
+	case "room:start":
+		err = s.start(client.Identity())
+	case "room:guess":
+		var payload struct {
+			RoundNumber int    `json:"roundNumber"`
+			AirportIATA string `json:"airportIata"`
+		}
+		if err = decodePayload(msg.Payload, &payload); err == nil {
+			err = s.guess(client.Identity(), payload.RoundNumber, payload.AirportIATA)
+		}
+	default:
+		err = fmt.Errorf("unknown message type %q", msg.Type)
+	}
+
+	if err != nil {
+		s.hub.Send(client, models.WSMessage{Type: "room:error", Payload: models.WSRoomError{Error: err.Error()}})
+	}
+}
+
+// HandleSpectate handles a "spectate:" message from a WebSocket client:
+//
+//	spectate:room {code}       watch a multiplayer room
+//	spectate:game {spectateId} watch a featured solo game
+func (s *RoomService) HandleSpectate(client *websocket.Client, msg models.WSMessage) {
+	var payload struct {
+		Code       string `json:"code"`
+		SpectateID string `json:"spectateId"`
+	}
+	err := decodePayload(msg.Payload, &payload)
+	if err == nil {
+		switch msg.Type {
+		case "spectate:room":
+			err = s.spectate(client, strings.ToUpper(payload.Code))
+		case "spectate:game":
+			err = s.gameService.SpectateGame(context.Background(), client, payload.SpectateID)
+		default:
+			err = fmt.Errorf("unknown message type %q", msg.Type)
+		}
+	}
+
+	if err != nil {
+		s.hub.Send(client, models.WSMessage{Type: "spectate:error", Payload: models.WSRoomError{Error: err.Error()}})
+	}
+}
+
+// spectate subscribes a client to a room's spectator feed, starting from the
+// room as its players saw it a delay ago
+func (s *RoomService) spectate(client *websocket.Client, code string) error {
+	r, err := s.room(code)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lag := s.gameService.spectators.Delay()
+	snapshot := []models.WSMessage{s.stateMessage(r, lag)}
+	switch r.state {
+	case models.RoomPlaying:
+		snapshot = append(snapshot, s.roundMessage(r, lag))
+	case models.RoomReveal:
+		snapshot = append(snapshot, s.revealMessage(r, lag))
+	}
+	s.gameService.spectators.watch(client, roomChannel(r.code), snapshot...)
+	return nil
+}
+
+// HandleLeave updates a room when one of its players' clients disconnects
+func (s *RoomService) HandleLeave(identity websocket.Identity) {
+	r, err := s.room(identity.Room)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state == models.RoomFinished {
+		return
+	}
+	s.broadcastState(r)
+	// The round needn't wait for a player who left
+	if r.state == models.RoomPlaying && s.allLockedIn(r) {
+		s.reveal(r)
+	}
+}
+
+// connect joins a client to a room as a player and catches it up
+func (s *RoomService) connect(client *websocket.Client, code, playerID string) error {
+	r, err := s.room(code)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.players[playerID] == nil {
+		return ErrNotInRoom
+	}
+
+	s.hub.JoinRoom(client, r.code, playerID)
+	s.broadcastState(r)
+	if r.state == models.RoomPlaying {
+		s.hub.Send(client, s.roundMessage(r, 0))
+		if guess, ok := r.guesses[playerID]; ok {
+			s.hub.Send(client, s.lockedMessage(r, guess.Guess))
+		}
+	}
+	return nil
+}
+
+// start draws the room's flights and opens its first round
+func (s *RoomService) start(identity websocket.Identity) error {
+	r, err := s.room(identity.Room)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if identity.Player != r.host {
+		return ErrNotRoomHost
+	}
+	if r.state != models.RoomLobby {
+		return ErrRoomStarted
+	}
+
+	flights, err := s.gameService.flightService.GetRandomFlights(r.difficulty, TotalRounds, s.gameService.selectionPolicy, nil)
+	if err != nil {
+		return err
+	}
+	r.rounds = make([]models.Round, TotalRounds)
+	ids := make([]string, TotalRounds)
+	for i := range r.rounds {
+		flight := flights[i]
+		// Every player sees the flight at the same position
+		display := s.gameService.randomDisplayPosition(flight, r.difficulty)
+		r.rounds[i] = models.Round{
+			RoundNumber:   i + 1,
+			FlightID:      flight.ID,
+			Token:         uuid.New().String(),
+			Flight:        &flight,
+			Display:       &display,
+			Departure:     flight.Departure.IATA,
+			ActualArrival: flight.Arrival.IATA,
+		}
+		ids[i] = flight.ID
+	}
+	s.gameService.flightService.MarkInPlay(ids...)
+	roomsStarted.Add(1)
+
+	s.openRound(r, 0)
+	return nil
+}
+
+// guess locks in a player's guess for the open round. Its result stays
+// hidden until the round is revealed.
+func (s *RoomService) guess(identity websocket.Identity, roundNumber int, airportIATA string) error {
+	r, err := s.room(identity.Room)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	player := r.players[identity.Player]
+	if player == nil {
+		return ErrNotInRoom
+	}
+	if r.state != models.RoomPlaying || roundNumber != r.current+1 {
+		return ErrRoundClosed
+	}
+	if _, ok := r.guesses[identity.Player]; ok {
+		return ErrAlreadyLockedIn
+	}
+
+	round := r.rounds[r.current]
+	guessTime := time.Since(round.StartedAt).Seconds()
+	score := s.gameService.calculateScore(round.ActualArrival, airportIATA, r.difficulty, guessTime, &round.Flight.Arrival)
+	r.guesses[identity.Player] = &models.RoomGuess{Username: player.username, Guess: airportIATA, Score: score}
+
+	s.hub.SendToRoomPlayer(r.code, identity.Player, s.lockedMessage(r, airportIATA))
+	s.broadcastState(r)
+	if s.allLockedIn(r) {
+		s.reveal(r)
+	}
+	return nil
+}
+
+// openRound sends a round's flight to every player and starts its timer
+func (s *RoomService) openRound(r *room, index int) {
+	now := time.Now()
+	r.state = models.RoomPlaying
+	r.current = index
+	r.rounds[index].StartedAt = now
+	r.endsAt = now.Add(s.policy.RoundDuration)
+	r.guesses = make(map[string]*models.RoomGuess)
+
+	s.relay(r, func(lag time.Duration) models.WSMessage { return s.roundMessage(r, lag) })
+	s.broadcastState(r)
+	s.schedule(r, s.policy.RoundDuration, func() {
+		if r.state == models.RoomPlaying && r.current == index {
+			s.reveal(r)
+		}
+	})
+}
+
+// reveal closes the open round and shows every player's result at once.
+// Players who didn't guess in time score nothing.
+func (s *RoomService) reveal(r *room) {
+	round := r.rounds[r.current]
+	r.state = models.RoomReveal
+	r.endsAt = time.Time{}
+
+	results := make([]models.RoomGuess, 0, len(r.order))
+	for _, id := range r.order {
+		player := r.players[id]
+		guess, ok := r.guesses[id]
+		if !ok {
+			guess = &models.RoomGuess{
+				Username: player.username,
+				Score:    models.ScoreResult{MatchType: "wrong", CorrectAirport: round.Flight.Arrival},
+			}
+		}
+		player.score += guess.Score.TotalPoints
+		results = append(results, *guess)
+	}
+
+	payload := models.WSRoomReveal{
+		Code:        r.code,
+		RoundNumber: round.RoundNumber,
+		Arrival:     round.Flight.Arrival,
+		Results:     results,
+		Scoreboard:  s.scoreboard(r),
+	}
+	next := r.current + 1
+	if next < len(r.rounds) {
+		nextRoundAt := time.Now().Add(s.policy.RevealDuration)
+		payload.NextRoundAt = &nextRoundAt
+	}
+	r.revealed = &payload
+	s.relay(r, func(lag time.Duration) models.WSMessage { return s.revealMessage(r, lag) })
+
+	s.schedule(r, s.policy.RevealDuration, func() {
+		if r.state != models.RoomReveal || r.current != next-1 {
+			return
+		}
+		if next < len(r.rounds) {
+			s.openRound(r, next)
+		} else {
+			s.finish(r)
+		}
+	})
+}
+
+// finish ends a room's game, or closes its lobby, and removes it once its
+// final scoreboard has been up for a while
+func (s *RoomService) finish(r *room) {
+	if r.rounds != nil {
+		ids := make([]string, len(r.rounds))
+		for i, round := range r.rounds {
+			ids[i] = round.FlightID
+		}
+		s.gameService.flightService.ReleaseFromPlay(ids...)
+	}
+	r.state = models.RoomFinished
+	s.relay(r, func(lag time.Duration) models.WSMessage {
+		return models.WSMessage{Type: "room:end", Payload: models.WSRoomState{Room: s.view(r, lag)}}
+	})
+
+	s.schedule(r, finishedRoomTTL, func() {
+		s.mu.Lock()
+		delete(s.rooms, r.code)
+		s.mu.Unlock()
+	})
+}
+
+// schedule runs fn with the room locked after d, replacing any transition
+// scheduled before. fn must check the room is still in the state it expects.
+func (s *RoomService) schedule(r *room, d time.Duration, fn func()) {
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	r.timer = time.AfterFunc(d, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		fn()
+	})
+}
+
+// allLockedIn reports whether every connected player has guessed the open
+// round. It's false while nobody is connected, so the timer decides.
+func (s *RoomService) allLockedIn(r *room) bool {
+	connected := 0
+	for _, id := range r.order {
+		if !s.hub.InRoom(r.code, id) {
+			continue
+		}
+		connected++
+		if _, ok := r.guesses[id]; !ok {
+			return false
+		}
+	}
+	return connected > 0
+}
+
+func (s *RoomService) broadcastState(r *room) {
+	s.relay(r, func(lag time.Duration) models.WSMessage { return s.stateMessage(r, lag) })
+}
+
+// relay sends a message to a room's players, and after the delay to its
+// spectators. Messages are built for a lag, which pushes back the times in
+// them so spectators' countdowns match what they see.
+func (s *RoomService) relay(r *room, msg func(lag time.Duration) models.WSMessage) {
+	s.hub.SendToRoom(r.code, msg(0))
+	if spectators := s.gameService.spectators; spectators != nil {
+		spectators.publish(roomChannel(r.code), msg(spectators.Delay()))
+	}
+}
+
+func (s *RoomService) stateMessage(r *room, lag time.Duration) models.WSMessage {
+	return models.WSMessage{Type: "room:state", Payload: models.WSRoomState{Room: s.view(r, lag)}}
+}
+
+// roundMessage opens the current round. Its flight is redacted like a solo
+// game's, so the arrival is never in it.
+func (s *RoomService) roundMessage(r *room, lag time.Duration) models.WSMessage {
+	round := r.rounds[r.current]
+	return models.WSMessage{
+		Type: "room:round",
+		Payload: models.WSRoomRound{
+			Code:        r.code,
+			RoundNumber: round.RoundNumber,
+			TotalRounds: len(r.rounds),
+			Flight:      s.gameService.prepareFlightForDisplay(round, r.difficulty),
+			EndsAt:      r.endsAt.Add(lag),
+		},
+	}
+}
+
+func (s *RoomService) revealMessage(r *room, lag time.Duration) models.WSMessage {
+	payload := *r.revealed
+	if payload.NextRoundAt != nil {
+		nextRoundAt := payload.NextRoundAt.Add(lag)
+		payload.NextRoundAt = &nextRoundAt
+	}
+	return models.WSMessage{Type: "room:reveal", Payload: payload}
+}
+
+func (s *RoomService) lockedMessage(r *room, guess string) models.WSMessage {
+	return models.WSMessage{
+		Type: "room:locked",
+		Payload: models.WSRoomLocked{
+			Code:        r.code,
+			RoundNumber: r.current + 1,
+			Guess:       guess,
+		},
+	}
+}
+
+func (s *RoomService) view(r *room, lag time.Duration) *models.RoomView {
+	view := &models.RoomView{
+		Code:        r.code,
+		State:       r.state,
+		Difficulty:  r.difficulty,
+		Host:        r.players[r.host].username,
+		TotalRounds: TotalRounds,
+		Scoreboard:  s.scoreboard(r),
+	}
+	if r.state == models.RoomPlaying || r.state == models.RoomReveal {
+		view.CurrentRound = r.current + 1
+	}
+	if r.state == models.RoomPlaying {
+		endsAt := r.endsAt.Add(lag)
+		view.RoundEndsAt = &endsAt
+	}
+	return view
+}
+
+// scoreboard lists a room's players, highest score first
+func (s *RoomService) scoreboard(r *room) []models.RoomPlayer {
+	board := make([]models.RoomPlayer, 0, len(r.order))
+	for _, id := range r.order {
+		player := r.players[id]
+		_, lockedIn := r.guesses[id]
+		board = append(board, models.RoomPlayer{
+			Username:  player.username,
+			Score:     player.score,
+			Connected: s.hub.InRoom(r.code, id),
+			LockedIn:  r.state == models.RoomPlaying && lockedIn,
+		})
+	}
+	sort.SliceStable(board, func(i, j int) bool {
+		return board[i].Score > board[j].Score
+	})
+	return board
+}
+
+func (s *RoomService) room(code string) (*room, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.rooms[code]
+	if !ok {
+		return nil, ErrRoomNotFound
+	}
+	return r, nil
+}
+
+func newRoomCode() (string, error) {
+	b := make([]byte, roomCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate room code: %w", err)
+	}
+	for i := range b {
+		b[i] = roomCodeAlphabet[int(b[i])%len(roomCodeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// decodePayload decodes a WebSocket message's payload into v
+func decodePayload(payload interface{}, v interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	return nil
+}
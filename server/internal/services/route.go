@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/repository"
+)
+
+const (
+	// routePriorRounds is how many rounds of the wider estimate a route's
+	// estimate starts from: a departure-arrival pair starts from an even
+	// outcome, and the pair flown by one airline from the pair's. Routes
+	// guessed only a few times aren't estimated extremely.
+	routePriorRounds = 4
+	// historyPageSize is how many sessions are read at a time when replaying history
+	historyPageSize = 500
+)
+
+// RouteStats tallies how well players have guessed each route, by departure,
+// arrival and airline, to estimate how hard routes are to guess
+type RouteStats struct {
+	mu sync.RWMutex
+	// pairs is keyed by departure-arrival, routes by departure-arrival-airline
+	pairs  map[string]*routeTally
+	routes map[string]*routeTally
+}
+
+type routeTally struct {
+	departure string
+	arrival   string
+	airline   string
+	rounds    int
+	exact     int
+	outcome   float64 // sum of the rounds' outcomes
+}
+
+func NewRouteStats() *RouteStats {
+	return &RouteStats{
+		pairs:  make(map[string]*routeTally),
+		routes: make(map[string]*routeTally),
+	}
+}
+
+// Load tallies every finished game in storage
+func (r *RouteStats) Load(ctx context.Context, sessions repository.SessionStore) error {
+	loaded := NewRouteStats()
+	if err := eachFinishedSession(ctx, sessions, loaded.add); err != nil {
+		return err
+	}
+	r.replace(loaded)
+	return nil
+}
+
+// List returns a page of the routes guessed at least minRounds times,
+// hardest first, or easiest first when easiest is set
+func (r *RouteStats) List(minRounds int, easiest bool, offset, limit int) []models.RouteDifficulty {
+	r.mu.RLock()
+	routes := make([]models.RouteDifficulty, 0, len(r.routes))
+	for _, tally := range r.routes {
+		if tally.rounds < minRounds {
+			continue
+		}
+		ease := r.ease(tally.departure, tally.arrival, tally.airline)
+		routes = append(routes, models.RouteDifficulty{
+			Departure:    tally.departure,
+			Arrival:      tally.arrival,
+			Airline:      tally.airline,
+			Rounds:       tally.rounds,
+			ExactMatches: tally.exact,
+			Ease:         ease,
+			Rating:       easeRating(ease),
+		})
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Ease != routes[j].Ease {
+			return (routes[i].Ease < routes[j].Ease) != easiest
+		}
+		if routes[i].Rounds != routes[j].Rounds {
+			return routes[i].Rounds > routes[j].Rounds
+		}
+		return routeID(routes[i].Departure, routes[i].Arrival, routes[i].Airline) <
+			routeID(routes[j].Departure, routes[j].Arrival, routes[j].Airline)
+	})
+	if offset >= len(routes) {
+		return []models.RouteDifficulty{}
+	}
+	routes = routes[offset:]
+	if limit < len(routes) {
+		routes = routes[:limit]
+	}
+	return routes
+}
+
+// FlightEase estimates the share of points players get guessing a flight's
+// destination, from 0 for routes nobody gets to 1 for routes everybody does
+func (r *RouteStats) FlightEase(flight models.Flight) float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.ease(flight.Departure.IATA, flight.Arrival.IATA, airlineCode(flight.Airline))
+}
+
+// replace takes over the tallies of other
+func (r *RouteStats) replace(other *RouteStats) {
+	other.mu.RLock()
+	defer other.mu.RUnlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pairs, r.routes = other.pairs, other.routes
+}
+
+// add counts a finished game's graded rounds
+func (r *RouteStats) add(session *models.GameSession) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, round := range session.Rounds {
+		if round.PlayerGuess == "" || round.Score == nil || !knownRoute(round) {
+			continue
+		}
+		airline := ""
+		if round.Flight != nil {
+			airline = airlineCode(round.Flight.Airline)
+		}
+		outcome := roundOutcome(round.Score)
+		exact := round.Score.MatchType == "exact"
+		for _, tally := range []*routeTally{
+			r.tally(r.pairs, round.Departure, round.ActualArrival, ""),
+			r.tally(r.routes, round.Departure, round.ActualArrival, airline),
+		} {
+			tally.rounds++
+			tally.outcome += outcome
+			if exact {
+				tally.exact++
+			}
+		}
+	}
+}
+
+func (r *RouteStats) tally(tallies map[string]*routeTally, departure, arrival, airline string) *routeTally {
+	id := routeID(departure, arrival, airline)
+	tally, ok := tallies[id]
+	if !ok {
+		tally = &routeTally{departure: departure, arrival: arrival, airline: airline}
+		tallies[id] = tally
+	}
+	return tally
+}
+
+// match returns the flight difficulty a game was played against, the mean
+// rating of its graded rounds' departure-arrival pairs, and the game's score
+// between 0 and 1. It reports false for games without a graded round.
+func (r *RouteStats) match(session *models.GameSession) (opponent, score float64, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rounds := 0
+	for _, round := range session.Rounds {
+		if round.PlayerGuess == "" || round.Score == nil {
+			continue
+		}
+		rounds++
+		ease := 0.5
+		if knownRoute(round) {
+			ease = r.pairEase(round.Departure, round.ActualArrival)
+		}
+		opponent += easeRating(ease)
+		score += roundOutcome(round.Score)
+	}
+	if rounds == 0 {
+		return 0, 0, false
+	}
+	return opponent / float64(rounds), score / float64(rounds), true
+}
+
+// pairEase estimates the ease of a departure-arrival pair on any airline
+func (r *RouteStats) pairEase(departure, arrival string) float64 {
+	return smoothedOutcome(r.pairs[routeID(departure, arrival, "")], 0.5)
+}
+
+// ease estimates the ease of a route, drawing on the pair's estimate until
+// the airline's route has been guessed often
+func (r *RouteStats) ease(departure, arrival, airline string) float64 {
+	return smoothedOutcome(r.routes[routeID(departure, arrival, airline)], r.pairEase(departure, arrival))
+}
+
+// smoothedOutcome is a tally's mean outcome, shrunk towards prior
+func smoothedOutcome(tally *routeTally, prior float64) float64 {
+	rounds, outcome := 0, 0.0
+	if tally != nil {
+		rounds, outcome = tally.rounds, tally.outcome
+	}
+	return (outcome + prior*routePriorRounds) / float64(rounds+routePriorRounds)
+}
+
+// easeRating converts a route's ease to the rating a player would need to
+// expect that outcome on it
+func easeRating(ease float64) float64 {
+	ease = math.Max(0.01, math.Min(0.99, ease))
+	return initialRating + 400*math.Log10((1-ease)/ease)
+}
+
+func routeID(departure, arrival, airline string) string {
+	return fmt.Sprintf("%s-%s-%s", departure, arrival, airline)
+}
+
+// knownRoute reports whether a round's departure and arrival are known
+func knownRoute(round models.Round) bool {
+	return round.Departure != "" && round.ActualArrival != "" && round.ActualArrival != "???"
+}
+
+// airlineCode identifies an airline by its IATA code, or its name when it has none
+func airlineCode(airline models.Airline) string {
+	if airline.IATA != "" {
+		return airline.IATA
+	}
+	return airline.Name
+}
+
+// roundOutcome scores a graded round between 0 and 1 by how close the guess
+// was, leaving out the difficulty and speed multipliers
+func roundOutcome(score *models.ScoreResult) float64 {
+	return math.Max(0, math.Min(1, float64(score.BasePoints)/1000))
+}
+
+// eachFinishedSession calls fn with every finished session in storage, in the
+// order they ended. Tournament and challenge games are left out, as they are
+// when they finish.
+func eachFinishedSession(ctx context.Context, sessions repository.SessionStore, fn func(*models.GameSession)) error {
+	var cursor repository.SessionCursor
+	for {
+		page, err := sessions.ListFinishedSessions(ctx, cursor, historyPageSize)
+		if err != nil {
+			return fmt.Errorf("failed to list sessions: %w", err)
+		}
+		for i := range page {
+			if !pinnedGame(&page[i]) {
+				fn(&page[i])
+			}
+		}
+		if len(page) < historyPageSize {
+			return nil
+		}
+		cursor = repository.CursorAt(&page[len(page)-1])
+	}
+}
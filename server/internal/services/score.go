@@ -2,112 +2,218 @@ package services
 
 import (
 	"context"
-	"sort"
-	"sync"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/skyquest/server/internal/models"
 	"github.com/skyquest/server/internal/repository"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var ErrInvalidCursor = errors.New("invalid leaderboard cursor")
+
 type ScoreService struct {
-	repo *repository.MongoRepository
-	// In-memory leaderboard fallback when MongoDB is unavailable
-	memoryScores    map[string]*models.LeaderboardEntry // key: username:difficulty
-	memoryScoresMux sync.RWMutex
+	scores  repository.LeaderboardStore
+	archive repository.LeaderboardArchive
 }
 
-func NewScoreService(repo *repository.MongoRepository) *ScoreService {
+func NewScoreService(scores repository.LeaderboardStore, archive repository.LeaderboardArchive) *ScoreService {
 	return &ScoreService{
-		repo:         repo,
-		memoryScores: make(map[string]*models.LeaderboardEntry),
+		scores:  scores,
+		archive: archive,
 	}
 }
 
 // SaveScore saves the final game score to leaderboard
 func (s *ScoreService) SaveScore(ctx context.Context, session *models.GameSession) error {
-	if s.repo != nil {
-		return s.repo.SaveScore(ctx, session)
-	}
-	
-	// In-memory fallback
-	s.memoryScoresMux.Lock()
-	defer s.memoryScoresMux.Unlock()
-	
-	key := session.Username + ":" + string(session.Difficulty)
-	existing, ok := s.memoryScores[key]
-	
-	if !ok || session.TotalScore > existing.TotalScore {
-		s.memoryScores[key] = &models.LeaderboardEntry{
-			ID:          primitive.NewObjectID(),
-			Username:    session.Username,
-			Difficulty:  session.Difficulty,
-			TotalScore:  session.TotalScore,
-			GamesPlayed: 1,
-			UpdatedAt:   time.Now(),
-		}
-		if ok {
-			s.memoryScores[key].GamesPlayed = existing.GamesPlayed + 1
+	return s.scores.SaveScore(ctx, session)
+}
+
+// LeaderboardOptions selects a leaderboard and a page of it
+type LeaderboardOptions struct {
+	Difficulty models.Difficulty
+	Window     models.LeaderboardWindow // all time when empty
+	Ranking    repository.Ranking       // competition when empty
+	// Country and Airport restrict the board to players from a home country or airport
+	Country string
+	Airport string
+	Limit   int
+	// Offset skips entries; Cursor continues from a previous page's NextCursor instead
+	Offset int
+	Cursor string
+}
+
+// LeaderboardPage is a page of a leaderboard
+type LeaderboardPage struct {
+	Entries []models.LeaderboardEntry
+	// NextCursor continues the board after this page; empty on the last page
+	NextCursor string
+}
+
+// GetLeaderboard retrieves a page of top scores
+func (s *ScoreService) GetLeaderboard(ctx context.Context, opts LeaderboardOptions) (*LeaderboardPage, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = 10
+	}
+	query := leaderboardQuery(opts.Difficulty, opts.Window, opts.Ranking, time.Now())
+	query.Country = opts.Country
+	query.Airport = opts.Airport
+	query.Limit = opts.Limit
+	query.Offset = max(opts.Offset, 0)
+	if opts.Cursor != "" {
+		cursor, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
 		}
-	} else if ok {
-		existing.GamesPlayed++
-		existing.UpdatedAt = time.Now()
+		query.After = cursor
+	}
+
+	entries, err := s.scores.GetLeaderboard(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &LeaderboardPage{Entries: entries}
+	if len(entries) == opts.Limit {
+		last := entries[len(entries)-1]
+		page.NextCursor = encodeCursor(&repository.LeaderboardCursor{
+			TotalScore: last.TotalScore,
+			Username:   last.Username,
+			Difficulty: last.Difficulty,
+		})
 	}
-	
-	return nil
+	return page, nil
 }
 
-// GetLeaderboard retrieves top scores
-func (s *ScoreService) GetLeaderboard(ctx context.Context, difficulty models.Difficulty, limit int) ([]models.LeaderboardEntry, error) {
+// GetCountryLeaderboard ranks countries by the average score of their top
+// players on a difficulty's leaderboard
+func (s *ScoreService) GetCountryLeaderboard(ctx context.Context, difficulty models.Difficulty, window models.LeaderboardWindow, top, limit int) ([]models.CountryEntry, error) {
+	if top <= 0 {
+		top = 10
+	}
 	if limit <= 0 {
 		limit = 10
 	}
-	
-	if s.repo != nil {
-		return s.repo.GetLeaderboard(ctx, difficulty, limit)
-	}
-	
-	// In-memory fallback
-	s.memoryScoresMux.RLock()
-	defer s.memoryScoresMux.RUnlock()
-	
-	var entries []models.LeaderboardEntry
-	for _, entry := range s.memoryScores {
-		if difficulty == "" || entry.Difficulty == difficulty {
-			entries = append(entries, *entry)
-		}
-	}
-	
-	// Sort by score descending
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].TotalScore > entries[j].TotalScore
-	})
-	
-	// Assign ranks and limit
-	for i := range entries {
-		entries[i].Rank = i + 1
-	}
-	
-	if len(entries) > limit {
-		entries = entries[:limit]
+	query := leaderboardQuery(difficulty, window, "", time.Now())
+	query.Limit = limit
+	return s.scores.GetCountryLeaderboard(ctx, query, top)
+}
+
+// GetArchivedWinners retrieves snapshots of a calendar window's past periods, most recent first
+func (s *ScoreService) GetArchivedWinners(ctx context.Context, window models.LeaderboardWindow, difficulty models.Difficulty, limit int) ([]models.LeaderboardSnapshot, error) {
+	if limit <= 0 {
+		limit = 10
 	}
-	
-	return entries, nil
+	return s.archive.GetSnapshots(ctx, window, difficulty, limit)
 }
 
 // GetUserRank gets a user's rank for a specific difficulty
 func (s *ScoreService) GetUserRank(ctx context.Context, username string, difficulty models.Difficulty) (int, error) {
-	if s.repo != nil {
-		return s.repo.GetUserRank(ctx, username, difficulty)
+	return s.scores.GetUserRank(ctx, username, difficulty)
+}
+
+// Standing is a player's position on a difficulty's leaderboard
+type Standing struct {
+	Rank       int
+	Percentile float64 // share of players scoring below, counting ties as half
+}
+
+// GetUserStanding gets a user's all-time rank and percentile for a specific difficulty
+func (s *ScoreService) GetUserStanding(ctx context.Context, username string, difficulty models.Difficulty) (Standing, error) {
+	higher, equal, total, err := s.scores.GetScoreStanding(ctx, repository.LeaderboardQuery{Difficulty: difficulty}, username)
+	if err != nil {
+		return Standing{}, err
+	}
+	return Standing{
+		Rank:       int(higher) + 1,
+		Percentile: percentile(higher, equal, total),
+	}, nil
+}
+
+// PlayerStanding is a player's place on a leaderboard with the players ranked around them
+type PlayerStanding struct {
+	Entry      models.LeaderboardEntry   `json:"entry"`
+	Percentile float64                   `json:"percentile"`
+	Players    int64                     `json:"players"`
+	Above      []models.LeaderboardEntry `json:"above"`
+	Below      []models.LeaderboardEntry `json:"below"`
+}
+
+// GetPlayerStanding gets a user's entry, percentile and up to radius neighbours
+// above and below on a difficulty's leaderboard
+func (s *ScoreService) GetPlayerStanding(ctx context.Context, username string, difficulty models.Difficulty, window models.LeaderboardWindow, ranking repository.Ranking, radius int) (*PlayerStanding, error) {
+	query := leaderboardQuery(difficulty, window, ranking, time.Now())
+
+	entries, err := s.scores.GetScoresAround(ctx, query, username, max(radius, 0))
+	if err != nil {
+		return nil, err
+	}
+	higher, equal, total, err := s.scores.GetScoreStanding(ctx, query, username)
+	if err != nil {
+		return nil, err
+	}
+
+	standing := &PlayerStanding{
+		Percentile: percentile(higher, equal, total),
+		Players:    total,
+		Above:      []models.LeaderboardEntry{},
+		Below:      []models.LeaderboardEntry{},
 	}
-	
-	// In-memory fallback
-	entries, _ := s.GetLeaderboard(ctx, difficulty, 100)
+	found := false
 	for _, entry := range entries {
-		if entry.Username == username {
-			return entry.Rank, nil
+		switch {
+		case entry.Username == username:
+			standing.Entry = entry
+			found = true
+		case found:
+			standing.Below = append(standing.Below, entry)
+		default:
+			standing.Above = append(standing.Above, entry)
 		}
 	}
-	return 0, nil
+	if !found {
+		// The board changed between the two reads
+		return nil, repository.ErrNotFound
+	}
+	return standing, nil
+}
+
+// leaderboardQuery selects the board for a difficulty and window as of now
+func leaderboardQuery(difficulty models.Difficulty, window models.LeaderboardWindow, ranking repository.Ranking, now time.Time) repository.LeaderboardQuery {
+	query := repository.LeaderboardQuery{
+		Difficulty: difficulty,
+		Ranking:    ranking,
+	}
+	if window != "" && window != models.WindowAllTime {
+		query.Since, query.Until = windowBounds(window, now)
+	}
+	return query
+}
+
+// percentile is the share of players scoring below, counting ties as half
+func percentile(higher, equal, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	below := total - higher - equal
+	return 100 * (float64(below) + 0.5*float64(equal)) / float64(total)
+}
+
+// encodeCursor makes an opaque page token from the last entry of a page
+func encodeCursor(cursor *repository.LeaderboardCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (*repository.LeaderboardCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor repository.LeaderboardCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
 }
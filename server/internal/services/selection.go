@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/skyquest/server/internal/models"
+)
+
+var ErrNotEnoughFlights = errors.New("not enough flights meet the selection constraints")
+
+// SelectionPolicy constrains the flights drawn for a game. A game never has
+// two flights to the same arrival airport; the caps are off when zero.
+type SelectionPolicy struct {
+	MaxPerCity    int     // flights to one destination city
+	MaxPerAirline int     // flights by one airline
+	MinSpreadKm   float64 // distance every arrival keeps from the others
+	// RecentGames is how many of a logged-in player's last games have their
+	// routes left out of a new one
+	RecentGames int
+}
+
+// selectFlights takes the first n flights, in order, that keep to the policy
+// and aren't on a seen route
+func (p SelectionPolicy) selectFlights(candidates []models.Flight, n int, seen map[string]bool) ([]models.Flight, error) {
+	selected := make([]models.Flight, 0, n)
+	ids := make(map[string]bool)
+	arrivals := make(map[string]bool)
+	cities := make(map[string]int)
+	airlines := make(map[string]int)
+	// rejected counts the candidates each constraint turned down, for the error
+	rejected := make(map[string]int)
+
+	for _, f := range candidates {
+		if len(selected) == n {
+			break
+		}
+		city := f.Arrival.City
+		if city == "" {
+			city = f.Arrival.IATA
+		}
+		airline := airlineCode(f.Airline)
+
+		switch {
+		case ids[f.ID]:
+			continue
+		case seen[routeID(f.Departure.IATA, f.Arrival.IATA, "")]:
+			rejected["recently seen"]++
+		case arrivals[f.Arrival.IATA]:
+			rejected["repeat an arrival"]++
+		case p.MaxPerCity > 0 && cities[city] >= p.MaxPerCity:
+			rejected["over the city cap"]++
+		case p.MaxPerAirline > 0 && airline != "" && airlines[airline] >= p.MaxPerAirline:
+			rejected["over the airline cap"]++
+		case !p.spreadFrom(f.Arrival, selected):
+			rejected["too close to another arrival"]++
+		default:
+			selected = append(selected, f)
+			ids[f.ID] = true
+			arrivals[f.Arrival.IATA] = true
+			cities[city]++
+			if airline != "" {
+				airlines[airline]++
+			}
+		}
+	}
+
+	if len(selected) < n {
+		reasons := make([]string, 0, len(rejected))
+		for _, reason := range []string{"recently seen", "repeat an arrival", "over the city cap",
+			"over the airline cap", "too close to another arrival"} {
+			if rejected[reason] > 0 {
+				reasons = append(reasons, fmt.Sprintf("%d %s", rejected[reason], reason))
+			}
+		}
+		detail := ""
+		if len(reasons) > 0 {
+			detail = " (" + strings.Join(reasons, ", ") + ")"
+		}
+		return nil, fmt.Errorf("%w: found %d of %d flights among %d candidates%s",
+			ErrNotEnoughFlights, len(selected), n, len(candidates), detail)
+	}
+	return selected, nil
+}
+
+// spreadFrom reports whether an arrival is far enough from those already
+// selected. Arrivals without coordinates can't be measured and always are.
+func (p SelectionPolicy) spreadFrom(arrival models.Airport, selected []models.Flight) bool {
+	if p.MinSpreadKm <= 0 || !hasCoordinates(arrival) {
+		return true
+	}
+	for _, f := range selected {
+		if !hasCoordinates(f.Arrival) {
+			continue
+		}
+		distance := CalculateDistance(arrival.Latitude, arrival.Longitude, f.Arrival.Latitude, f.Arrival.Longitude)
+		if distance < p.MinSpreadKm {
+			return false
+		}
+	}
+	return true
+}
+
+func hasCoordinates(airport models.Airport) bool {
+	return airport.Latitude != 0 || airport.Longitude != 0
+}
+
+// recentRoutes returns the routes of a logged-in player's last games, which
+// the selection policy keeps out of their next one. Guests' games aren't
+// looked up by player, so they have none.
+func (s *GameService) recentRoutes(ctx context.Context, userID string) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	if userID == "" || s.selectionPolicy.RecentGames <= 0 {
+		return seen, nil
+	}
+	sessions, err := s.sessions.GetUserSessions(ctx, userID, 0, s.selectionPolicy.RecentGames)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load recent games: %w", err)
+	}
+	for _, session := range sessions {
+		for _, round := range session.Rounds {
+			if knownRoute(round) {
+				seen[routeID(round.Departure, round.ActualArrival, "")] = true
+			}
+		}
+	}
+	return seen, nil
+}
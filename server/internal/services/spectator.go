@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/websocket"
+)
+
+// spectatorQueueSize bounds the messages waiting out the spectator delay
+const spectatorQueueSize = 4096
+
+var ErrGameNotFeatured = errors.New("game is not featured for spectators")
+
+var spectatorMessagesDropped = expvar.NewInt("spectator_messages_dropped_total")
+
+// Spectators relays multiplayer rooms and featured solo games to read-only
+// spectators over the WebSocket. The feed runs a delay behind the players, so
+// a projector screen can't be used to ghost them, and is built from the same
+// redacted flights players see: a round's arrival is only sent in its reveal.
+type Spectators struct {
+	hub   *websocket.Hub
+	delay time.Duration
+	queue chan spectatorMessage
+
+	mu       sync.RWMutex
+	featured map[string]featuredGame // by session ID
+	handles  map[string]string       // session IDs by spectate ID
+}
+
+// featuredGame is a featured solo game's entry. Spectators know it by its
+// spectate ID, as its session ID would let them play it.
+type featuredGame struct {
+	spectateID string
+	at         time.Time
+}
+
+// spectatorMessage is a delivery waiting out the delay
+type spectatorMessage struct {
+	due     time.Time
+	deliver func()
+}
+
+func NewSpectators(hub *websocket.Hub, delay time.Duration) *Spectators {
+	return &Spectators{
+		hub:      hub,
+		delay:    delay,
+		queue:    make(chan spectatorMessage, spectatorQueueSize),
+		featured: make(map[string]featuredGame),
+		handles:  make(map[string]string),
+	}
+}
+
+// Start delivers queued messages once their delay is up, in the order they
+// were queued
+func (s *Spectators) Start() {
+	for msg := range s.queue {
+		time.Sleep(time.Until(msg.due))
+		msg.deliver()
+	}
+}
+
+// Delay is how far the spectator feed runs behind the players
+func (s *Spectators) Delay() time.Duration {
+	return s.delay
+}
+
+// watch subscribes a client to a spectator channel. It starts from a snapshot
+// taken now, so it joins the channel once the snapshot's delay is up.
+func (s *Spectators) watch(client *websocket.Client, channel string, snapshot ...models.WSMessage) {
+	s.after(func() {
+		s.hub.JoinRoom(client, channel, "")
+		for _, msg := range snapshot {
+			s.hub.Send(client, msg)
+		}
+	})
+}
+
+// publish sends a message to a channel's spectators after the delay
+func (s *Spectators) publish(channel string, msg models.WSMessage) {
+	s.after(func() {
+		s.hub.SendToRoom(channel, msg)
+	})
+}
+
+// after queues a delivery for after the delay. Deliveries are dropped while
+// the queue is full, so games never wait on spectators.
+func (s *Spectators) after(deliver func()) {
+	select {
+	case s.queue <- spectatorMessage{due: time.Now().Add(s.delay), deliver: deliver}:
+	default:
+		spectatorMessagesDropped.Add(1)
+	}
+}
+
+// feature features a game, returning its spectate ID
+func (s *Spectators) feature(sessionID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	game, ok := s.featured[sessionID]
+	if !ok {
+		game = featuredGame{spectateID: uuid.New().String(), at: time.Now()}
+		s.featured[sessionID] = game
+		s.handles[game.spectateID] = sessionID
+	}
+	return game.spectateID
+}
+
+func (s *Spectators) unfeature(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if game, ok := s.featured[sessionID]; ok {
+		delete(s.handles, game.spectateID)
+		delete(s.featured, sessionID)
+	}
+}
+
+// spectateID returns a featured game's spectate ID, or "" if it isn't featured
+func (s *Spectators) spectateID(sessionID string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.featured[sessionID].spectateID
+}
+
+// featuredSession returns the session ID of the featured game with a spectate ID
+func (s *Spectators) featuredSession(spectateID string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sessionID, ok := s.handles[spectateID]
+	return sessionID, ok
+}
+
+// featuredGames returns the featured session IDs, in the order they were featured
+func (s *Spectators) featuredGames() ([]string, map[string]featuredGame) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.featured))
+	games := make(map[string]featuredGame, len(s.featured))
+	for id, game := range s.featured {
+		ids = append(ids, id)
+		games[id] = game
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return games[ids[i]].at.Before(games[ids[j]].at)
+	})
+	return ids, games
+}
+
+func roomChannel(code string) string {
+	return "spectate:room:" + code
+}
+
+func gameChannel(spectateID string) string {
+	return "spectate:game:" + spectateID
+}
+
+// FeatureGame lets spectators watch a solo game in progress, returning the
+// spectate ID they watch it by
+func (s *GameService) FeatureGame(ctx context.Context, sessionID string) (string, error) {
+	session, err := s.sessions.GetSession(ctx, sessionID)
+	if err != nil {
+		return "", ErrSessionNotFound
+	}
+	if session.Status != models.SessionInProgress {
+		return "", ErrGameCompleted
+	}
+	return s.spectators.feature(sessionID), nil
+}
+
+// SpectatorDelay is how far spectators' feed runs behind the players
+func (s *GameService) SpectatorDelay() time.Duration {
+	return s.spectators.Delay()
+}
+
+// UnfeatureGame stops spectators joining a solo game. Those watching it
+// already keep watching.
+func (s *GameService) UnfeatureGame(sessionID string) {
+	s.spectators.unfeature(sessionID)
+}
+
+// GetFeaturedGames returns the featured solo games still in progress
+func (s *GameService) GetFeaturedGames(ctx context.Context) ([]models.FeaturedGame, error) {
+	ids, featured := s.spectators.featuredGames()
+	games := make([]models.FeaturedGame, 0, len(ids))
+	for _, id := range ids {
+		state, err := s.GetGameState(ctx, id)
+		if errors.Is(err, ErrSessionNotFound) {
+			s.spectators.unfeature(id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if state.Status != models.SessionInProgress {
+			// Abandoned games don't pass through the game service
+			s.spectators.unfeature(id)
+			continue
+		}
+		games = append(games, models.FeaturedGame{
+			SpectateID:   featured[id].spectateID,
+			Username:     state.Username,
+			Difficulty:   state.Difficulty,
+			CurrentRound: state.CurrentRound,
+			TotalRounds:  state.TotalRounds,
+			TotalScore:   state.TotalScore,
+			FeaturedAt:   featured[id].at,
+		})
+	}
+	return games, nil
+}
+
+// SpectateGame subscribes a client to a featured solo game by its spectate ID,
+// starting from its state as players' screens showed it a delay ago. The game
+// messages spectators get carry the spectate ID in place of the session ID.
+func (s *GameService) SpectateGame(ctx context.Context, client *websocket.Client, spectateID string) error {
+	sessionID, ok := s.spectators.featuredSession(spectateID)
+	if !ok {
+		return ErrGameNotFeatured
+	}
+	state, err := s.GetGameState(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	state.SessionID = spectateID
+	s.spectators.watch(client, gameChannel(spectateID), models.WSMessage{
+		Type:    "game:state",
+		Payload: models.WSGameState{State: state},
+	})
+	return nil
+}
+
+// spectateRound relays a graded round of a featured game to its spectators:
+// the guess and answer pins with the score, then the next flight or the end
+func (s *GameService) spectateRound(session *models.GameSession, roundIndex int) {
+	if s.spectators == nil {
+		return
+	}
+	spectateID := s.spectators.spectateID(session.SessionID)
+	if spectateID == "" {
+		return
+	}
+	channel := gameChannel(spectateID)
+	resp := s.guessResponse(session, roundIndex)
+	s.spectators.publish(channel, models.WSMessage{
+		Type: "guess:result",
+		Payload: models.WSGuessResult{
+			SessionID:   spectateID,
+			RoundNumber: resp.RoundNumber,
+			Score:       resp.Score,
+			TotalScore:  resp.TotalScore,
+		},
+	})
+	if resp.IsGameOver {
+		s.spectateEnd(session)
+		return
+	}
+	s.spectators.publish(channel, models.WSMessage{
+		Type: "round:start",
+		Payload: models.WSRoundStart{
+			SessionID:   spectateID,
+			RoundNumber: resp.RoundNumber + 1,
+			Flight:      resp.NextFlight,
+		},
+	})
+}
+
+// spectateEnd tells a featured game's spectators it's over and takes it off
+// the featured list
+func (s *GameService) spectateEnd(session *models.GameSession) {
+	if s.spectators == nil {
+		return
+	}
+	spectateID := s.spectators.spectateID(session.SessionID)
+	if spectateID == "" {
+		return
+	}
+	end := models.WSGameEnd{SessionID: spectateID, TotalScore: session.TotalScore}
+	if session.Result != nil {
+		end.Rank = session.Result.Rank
+	}
+	s.spectators.publish(gameChannel(spectateID), models.WSMessage{Type: "game:end", Payload: end})
+	s.spectators.unfeature(session.SessionID)
+}
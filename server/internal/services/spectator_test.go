@@ -0,0 +1,41 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/websocket"
+)
+
+// A spectator who disconnects before the delay is up must not be joined to
+// the channel afterwards, or the next message to it would go to a closed client
+func TestSpectatorDisconnectsBeforeDelay(t *testing.T) {
+	hub := websocket.NewHub()
+	go hub.Run()
+	spectators := NewSpectators(hub, 20*time.Millisecond)
+	go spectators.Start()
+
+	client := websocket.NewClient(hub, nil, websocket.Identity{})
+	hub.Register(client)
+	spectators.watch(client, "spectate:game", models.WSMessage{Type: "spectate:state"})
+	hub.Unregister(client)
+	// The hub handles one client at a time, so this waits for the unregister
+	hub.Register(websocket.NewClient(hub, nil, websocket.Identity{}))
+
+	spectators.publish("spectate:game", models.WSMessage{Type: "spectate:round"})
+	done := make(chan struct{})
+	spectators.after(func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("spectator deliveries didn't run")
+	}
+
+	if hub.InRoom("spectate:game", "") {
+		t.Error("disconnected spectator joined the channel")
+	}
+	for range client.GetSendChannel() {
+		t.Error("disconnected spectator was sent a message")
+	}
+}
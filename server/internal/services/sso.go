@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/repository"
+	"golang.org/x/oauth2"
+)
+
+const (
+	loginFlowIssuer  = "skyquest-sso-flow"
+	linkTicketIssuer = "skyquest-sso-link"
+	// LoginFlowTTL bounds how long a player has to log in at the provider
+	LoginFlowTTL    = 10 * time.Minute
+	linkTicketTTL   = 5 * time.Minute
+	maxNameAttempts = 20
+)
+
+var (
+	ErrUnknownProvider  = errors.New("unknown identity provider")
+	ErrInvalidLoginFlow = errors.New("login state is missing, expired or doesn't match")
+	ErrIdentityLinked   = errors.New("this identity is linked to another account")
+)
+
+// loginFlowClaims carry a login in progress between redirecting the player to
+// the provider and its callback. They are kept in a cookie on the player's
+// browser, which binds the callback to the browser that started the login.
+type loginFlowClaims struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	// LinkUserID is the account the identity is linked to, if linking
+	LinkUserID string `json:"linkUserId,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// SSOService logs players in with external identity providers, creating an
+// account on first login or linking the identity to an existing account
+type SSOService struct {
+	auth      *AuthService
+	users     repository.UserStore
+	providers map[string]IdentityProvider
+}
+
+func NewSSOService(auth *AuthService, users repository.UserStore, providers map[string]IdentityProvider) *SSOService {
+	return &SSOService{
+		auth:      auth,
+		users:     users,
+		providers: providers,
+	}
+}
+
+// Providers returns the names of the configured providers
+func (s *SSOService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LinkTicket lets a logged-in player start a login that links the identity to
+// their account. Logins are browser redirects, which can't carry the player's
+// token, so the ticket is passed in the login URL instead.
+func (s *SSOService) LinkTicket(provider, userID string) (string, error) {
+	if _, ok := s.providers[provider]; !ok {
+		return "", ErrUnknownProvider
+	}
+	now := time.Now()
+	return s.sign(jwt.RegisteredClaims{
+		Issuer:    linkTicketIssuer,
+		Subject:   userID,
+		Audience:  jwt.ClaimStrings{provider},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(linkTicketTTL)),
+	})
+}
+
+// BeginLogin starts a login with a provider, optionally linking to the account
+// of a link ticket. It returns the provider URL to send the player to, and the
+// flow token to hand back to CompleteLogin from the player's browser.
+func (s *SSOService) BeginLogin(provider, linkTicket string) (authURL, flowToken string, err error) {
+	idp, ok := s.providers[provider]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+	var linkUserID string
+	if linkTicket != "" {
+		var ticket jwt.RegisteredClaims
+		_, err := jwt.ParseWithClaims(linkTicket, &ticket, s.keyFunc,
+			jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(linkTicketIssuer),
+			jwt.WithAudience(provider), jwt.WithExpirationRequired())
+		if err != nil || ticket.Subject == "" {
+			return "", "", ErrInvalidToken
+		}
+		linkUserID = ticket.Subject
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+	now := time.Now()
+	flowToken, err = s.sign(loginFlowClaims{
+		Provider:   provider,
+		State:      state,
+		Nonce:      nonce,
+		Verifier:   verifier,
+		LinkUserID: linkUserID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    loginFlowIssuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(LoginFlowTTL)),
+		},
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return idp.AuthCodeURL(state, nonce, verifier), flowToken, nil
+}
+
+// CompleteLogin finishes a login at the provider's callback. The state must
+// match the flow token's; the code is then exchanged for the player's identity.
+// A linked identity logs in its account. Otherwise the identity is linked to
+// the flow's link account, or a new account is created for it. Accounts are
+// never matched by email address, which the player could have set to anything.
+func (s *SSOService) CompleteLogin(ctx context.Context, provider, flowToken, state, code string) (*models.AuthResponse, error) {
+	idp, ok := s.providers[provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	var flow loginFlowClaims
+	_, err := jwt.ParseWithClaims(flowToken, &flow, s.keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(loginFlowIssuer),
+		jwt.WithExpirationRequired())
+	if err != nil || flow.Provider != provider || flow.State == "" ||
+		subtle.ConstantTimeCompare([]byte(flow.State), []byte(state)) != 1 {
+		return nil, ErrInvalidLoginFlow
+	}
+	if code == "" {
+		return nil, fmt.Errorf("%w: no authorization code", ErrIdentityProvider)
+	}
+
+	external, err := idp.Exchange(ctx, code, flow.Nonce, flow.Verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.GetUserByIdentity(ctx, provider, external.Subject)
+	switch {
+	case err == nil:
+		if flow.LinkUserID != "" && user.ID.Hex() != flow.LinkUserID {
+			return nil, ErrIdentityLinked
+		}
+		return s.auth.issueToken(user)
+	case !errors.Is(err, repository.ErrNotFound):
+		return nil, err
+	}
+
+	identity := models.UserIdentity{
+		Provider: provider,
+		Subject:  external.Subject,
+		Email:    external.Email,
+		LinkedAt: time.Now(),
+	}
+	if flow.LinkUserID != "" {
+		user, err = s.users.GetUser(ctx, flow.LinkUserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load user: %w", err)
+		}
+	} else if user, err = s.createUser(ctx, external); err != nil {
+		return nil, err
+	}
+
+	err = s.users.LinkIdentity(ctx, user.ID.Hex(), identity)
+	if errors.Is(err, repository.ErrDuplicate) {
+		// Linked concurrently, maybe by a second callback for the same login
+		return nil, ErrIdentityLinked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to link identity: %w", err)
+	}
+	user.Identities = append(user.Identities, identity)
+	return s.auth.issueToken(user)
+}
+
+// createUser creates an account for a new identity, named after the player's
+// name at the provider. Names taken by accounts or guest profiles get a suffix.
+func (s *SSOService) createUser(ctx context.Context, external *ExternalIdentity) (*models.User, error) {
+	base := suggestUsername(external.Username)
+	for attempt := 1; attempt <= maxNameAttempts; attempt++ {
+		username := base
+		if attempt > 1 {
+			username = base + "-" + strconv.Itoa(attempt)
+		}
+		user := &models.User{
+			Username:    username,
+			Email:       external.Email,
+			CreatedAt:   time.Now(),
+			Progression: models.Progression{Level: 1},
+		}
+		err := s.users.CreateUser(ctx, user)
+		if errors.Is(err, repository.ErrDuplicate) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+		return user, nil
+	}
+	return nil, fmt.Errorf("failed to create user: no free username like %q", base)
+}
+
+// suggestUsername turns a provider's name for a player into a valid username
+// with room for a suffix
+func suggestUsername(name string) string {
+	var b strings.Builder
+	for _, c := range strings.TrimSpace(name) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+			b.WriteRune(c)
+		case c == ' ':
+			b.WriteRune('_')
+		}
+		if b.Len() == 20 {
+			break
+		}
+	}
+	username := b.String()
+	if len(username) < 3 {
+		username = "player" + username
+	}
+	return username
+}
+
+func (s *SSOService) sign(claims jwt.Claims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.auth.secret)
+}
+
+func (s *SSOService) keyFunc(*jwt.Token) (interface{}, error) {
+	return s.auth.secret, nil
+}
+
+// randomToken returns 32 random bytes, base64url encoded
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/skyquest/server/internal/repository"
+)
+
+const testClientID = "skyquest-test"
+
+// fakeIssuer is an OpenID Connect provider that authorizes every login. It
+// binds each code to the PKCE challenge and nonce it was authorized with, and
+// redeems it only for the matching verifier, like a real provider.
+type fakeIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+	// nonce, when set, replaces the login's nonce in issued ID tokens
+	nonce string
+}
+
+type authorization struct {
+	subject   string
+	challenge string
+	nonce     string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	f := &fakeIssuer{key: key, codes: make(map[string]authorization)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                f.URL,
+			"authorization_endpoint":                f.URL + "/authorize",
+			"token_endpoint":                        f.URL + "/token",
+			"jwks_uri":                              f.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", f.token)
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// authorize stands in for the player logging in at the provider: it checks the
+// login URL and returns the code and state the provider redirects back with
+func (f *fakeIssuer) authorize(t *testing.T, authURL, subject string) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse login URL: %v", err)
+	}
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("client_id") != testClientID {
+		t.Fatalf("login URL %s is not for this client", authURL)
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("login URL %s has no S256 PKCE challenge", authURL)
+	}
+	if q.Get("state") == "" || q.Get("nonce") == "" {
+		t.Fatalf("login URL %s has no state or nonce", authURL)
+	}
+
+	code = randomCode(t)
+	f.mu.Lock()
+	f.codes[code] = authorization{subject: subject, challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	f.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (f *fakeIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	f.mu.Lock()
+	auth, ok := f.codes[r.PostForm.Get("code")]
+	delete(f.codes, r.PostForm.Get("code"))
+	nonce := f.nonce
+	f.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	if nonce == "" {
+		nonce = auth.nonce
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                f.URL,
+		"aud":                testClientID,
+		"sub":                auth.subject,
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+		"nonce":              nonce,
+		"email":              auth.subject + "@example.com",
+		"email_verified":     true,
+		"preferred_username": auth.subject,
+	})
+	idToken.Header["kid"] = "test"
+	signed, err := idToken.SignedString(f.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomCode(t *testing.T) string {
+	t.Helper()
+	code, err := randomToken()
+	if err != nil {
+		t.Fatalf("random code: %v", err)
+	}
+	return code
+}
+
+func newTestSSO(t *testing.T) (*SSOService, *fakeIssuer) {
+	t.Helper()
+	issuer := newFakeIssuer(t)
+	provider, err := NewOIDCProvider(context.Background(), issuer.URL, testClientID, "secret",
+		"http://localhost/api/auth/sso/test/callback", nil)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	store := repository.NewMemoryStore()
+	auth := NewAuthService(store, []byte("test-secret"), time.Hour)
+	return NewSSOService(auth, store, map[string]IdentityProvider{"test": provider}), issuer
+}
+
+func TestOIDCLogin(t *testing.T) {
+	ctx := context.Background()
+	sso, issuer := newTestSSO(t)
+
+	authURL, flow, err := sso.BeginLogin("test", "")
+	if err != nil {
+		t.Fatalf("begin login: %v", err)
+	}
+	code, state := issuer.authorize(t, authURL, "ada")
+	first, err := sso.CompleteLogin(ctx, "test", flow, state, code)
+	if err != nil {
+		t.Fatalf("complete login: %v", err)
+	}
+	if first.User.Username != "ada" || first.User.Email != "ada@example.com" {
+		t.Fatalf("created user %q <%s>, want ada <ada@example.com>", first.User.Username, first.User.Email)
+	}
+
+	// A second login of the same identity logs in the same account
+	authURL, flow, err = sso.BeginLogin("test", "")
+	if err != nil {
+		t.Fatalf("begin login: %v", err)
+	}
+	code, state = issuer.authorize(t, authURL, "ada")
+	second, err := sso.CompleteLogin(ctx, "test", flow, state, code)
+	if err != nil {
+		t.Fatalf("complete second login: %v", err)
+	}
+	if second.User.ID != first.User.ID {
+		t.Fatalf("second login got user %s, want %s", second.User.ID.Hex(), first.User.ID.Hex())
+	}
+}
+
+func TestOIDCLoginState(t *testing.T) {
+	ctx := context.Background()
+	sso, issuer := newTestSSO(t)
+
+	authURL, flow, err := sso.BeginLogin("test", "")
+	if err != nil {
+		t.Fatalf("begin login: %v", err)
+	}
+	code, _ := issuer.authorize(t, authURL, "ada")
+	if _, err := sso.CompleteLogin(ctx, "test", flow, "forged", code); !errors.Is(err, ErrInvalidLoginFlow) {
+		t.Fatalf("forged state: got %v, want ErrInvalidLoginFlow", err)
+	}
+
+	// The callback of one login can't be completed in another's browser
+	authURL, _, err = sso.BeginLogin("test", "")
+	if err != nil {
+		t.Fatalf("begin login: %v", err)
+	}
+	code, state := issuer.authorize(t, authURL, "ada")
+	if _, err := sso.CompleteLogin(ctx, "test", flow, state, code); !errors.Is(err, ErrInvalidLoginFlow) {
+		t.Fatalf("other login's state: got %v, want ErrInvalidLoginFlow", err)
+	}
+}
+
+func TestOIDCLoginPKCE(t *testing.T) {
+	ctx := context.Background()
+	sso, issuer := newTestSSO(t)
+
+	// A code authorized for one login can't be redeemed with another login's
+	// verifier, even when the attacker also has a matching state and flow
+	victimURL, _, err := sso.BeginLogin("test", "")
+	if err != nil {
+		t.Fatalf("begin login: %v", err)
+	}
+	stolen, _ := issuer.authorize(t, victimURL, "ada")
+
+	_, flow, err := sso.BeginLogin("test", "")
+	if err != nil {
+		t.Fatalf("begin login: %v", err)
+	}
+	var claims loginFlowClaims
+	if _, err := jwt.ParseWithClaims(flow, &claims, sso.keyFunc); err != nil {
+		t.Fatalf("parse flow: %v", err)
+	}
+	_, err = sso.CompleteLogin(ctx, "test", flow, claims.State, stolen)
+	if !errors.Is(err, ErrIdentityProvider) {
+		t.Fatalf("stolen code: got %v, want ErrIdentityProvider", err)
+	}
+}
+
+func TestOIDCLoginNonce(t *testing.T) {
+	ctx := context.Background()
+	sso, issuer := newTestSSO(t)
+	issuer.nonce = "replayed"
+
+	authURL, flow, err := sso.BeginLogin("test", "")
+	if err != nil {
+		t.Fatalf("begin login: %v", err)
+	}
+	code, state := issuer.authorize(t, authURL, "ada")
+	if _, err := sso.CompleteLogin(ctx, "test", flow, state, code); !errors.Is(err, ErrIdentityProvider) {
+		t.Fatalf("wrong nonce: got %v, want ErrIdentityProvider", err)
+	}
+}
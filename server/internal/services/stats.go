@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/repository"
+)
+
+const (
+	// statsBackfillPageSize is how many sessions the backfill reads at a time
+	statsBackfillPageSize = 500
+	// profileAirports is how many airports a profile lists as most guessed and most missed
+	profileAirports = 5
+)
+
+var ErrPlayerNotFound = errors.New("player not found")
+
+// StatsService keeps players' lifetime stats, counting each finished game once
+type StatsService struct {
+	users         repository.UserStore
+	sessions      repository.SessionStore
+	ratings       repository.RatingStore
+	flightService *FlightService
+}
+
+func NewStatsService(users repository.UserStore, sessions repository.SessionStore, ratings repository.RatingStore, flightService *FlightService) *StatsService {
+	return &StatsService{
+		users:         users,
+		sessions:      sessions,
+		ratings:       ratings,
+		flightService: flightService,
+	}
+}
+
+// RecordGame adds a finished game to its player's stats. Games without a
+// graded round aren't counted.
+func (s *StatsService) RecordGame(ctx context.Context, session *models.GameSession) error {
+	if roundsPlayed(session) == 0 {
+		return nil
+	}
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		user, err := playerOf(ctx, s.users, session)
+		if err != nil {
+			return fmt.Errorf("failed to load player: %w", err)
+		}
+		stats := user.Stats.Clone()
+		addGame(&stats, session)
+		err = s.users.UpdateUserStats(ctx, user.ID.Hex(), stats, user.Stats.GamesPlayed)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			// Another of the player's games was counted first
+			continue
+		}
+		return err
+	}
+	return ErrConcurrentUpdate
+}
+
+// GetProfile returns a player's profile and lifetime stats
+func (s *StatsService) GetProfile(ctx context.Context, username string) (*models.PlayerProfile, error) {
+	user, err := s.users.GetUserByUsername(ctx, username)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrPlayerNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	ratings, err := s.ratings.GetRatings(ctx, user.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &models.PlayerProfile{
+		Username:    user.Username,
+		Registered:  user.Registered(),
+		CreatedAt:   user.CreatedAt,
+		HomeCountry: user.HomeCountry,
+		HomeAirport: user.HomeAirport,
+		Stats:       user.Stats,
+		Progression: models.Progression{XP: user.Progression.XP, Level: levelForXP(user.Progression.XP)},
+		Ratings:     ratings,
+		Accuracy:    make(map[string]float64, len(user.Stats.MatchTypes)),
+		MostGuessed: s.topAirports(user.Stats.Airports, func(a *models.AirportStats) int { return a.Guessed }),
+		MostMissed:  s.topAirports(user.Stats.Airports, func(a *models.AirportStats) int { return a.Missed }),
+	}
+	profile.NextLevelXP = xpForLevel(profile.Progression.Level + 1)
+	// The per-airport counts are summarized by the top lists
+	profile.Stats.Airports = nil
+	for matchType, n := range user.Stats.MatchTypes {
+		profile.Accuracy[matchType] = float64(n) / float64(user.Stats.RoundsPlayed)
+	}
+	return profile, nil
+}
+
+// Backfill recomputes the stats of every player with a finished game in
+// storage from their games, and returns the number of players updated.
+// Games finishing while it runs may be missed, so run it while the server
+// is quiet; players whose games are no longer stored keep their stats.
+func (s *StatsService) Backfill(ctx context.Context) (int, error) {
+	type player struct {
+		session *models.GameSession // a game the player played, to find them by
+		stats   models.UserStats
+	}
+	players := make(map[string]*player)
+	var order []string
+
+	var cursor repository.SessionCursor
+	for {
+		page, err := s.sessions.ListFinishedSessions(ctx, cursor, statsBackfillPageSize)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list sessions: %w", err)
+		}
+		for i := range page {
+			session := &page[i]
+			if roundsPlayed(session) == 0 || pinnedGame(session) {
+				continue
+			}
+			key := "user:" + session.UserID
+			if session.UserID == "" {
+				key = "guest:" + session.Username
+			}
+			p, ok := players[key]
+			if !ok {
+				p = &player{session: session}
+				players[key] = p
+				order = append(order, key)
+			}
+			addGame(&p.stats, session)
+		}
+		if len(page) < statsBackfillPageSize {
+			break
+		}
+		cursor = repository.CursorAt(&page[len(page)-1])
+	}
+
+	for _, key := range order {
+		p := players[key]
+		if err := s.replaceStats(ctx, p.session, p.stats); err != nil {
+			return 0, fmt.Errorf("failed to update stats of %s: %w", p.session.Username, err)
+		}
+	}
+	return len(order), nil
+}
+
+// replaceStats overwrites the stats of a game's player
+func (s *StatsService) replaceStats(ctx context.Context, session *models.GameSession, stats models.UserStats) error {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		user, err := playerOf(ctx, s.users, session)
+		if err != nil {
+			return err
+		}
+		err = s.users.UpdateUserStats(ctx, user.ID.Hex(), stats, user.Stats.GamesPlayed)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			continue
+		}
+		return err
+	}
+	return ErrConcurrentUpdate
+}
+
+// playerOf returns the user who played a game: the account it belongs to, or
+// the guest profile with its username, created if needed
+func playerOf(ctx context.Context, users repository.UserStore, session *models.GameSession) (*models.User, error) {
+	if session.UserID != "" {
+		return users.GetUser(ctx, session.UserID)
+	}
+	return findOrCreateUser(ctx, users, session.Username)
+}
+
+// topAirports lists the airports with the highest counts, most first
+func (s *StatsService) topAirports(airports map[string]*models.AirportStats, count func(*models.AirportStats) int) []models.AirportCount {
+	top := []models.AirportCount{}
+	for iata, stats := range airports {
+		if n := count(stats); n > 0 {
+			top = append(top, models.AirportCount{IATA: iata, Count: n})
+		}
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].IATA < top[j].IATA
+	})
+	if len(top) > profileAirports {
+		top = top[:profileAirports]
+	}
+	for i := range top {
+		if airport, ok := s.flightService.GetAirport(top[i].IATA); ok {
+			top[i].Name = airport.Name
+		}
+	}
+	return top
+}
+
+// addGame adds a finished game's graded rounds to stats
+func addGame(stats *models.UserStats, session *models.GameSession) {
+	if stats.MatchTypes == nil {
+		stats.MatchTypes = make(map[string]int)
+	}
+	if stats.Difficulties == nil {
+		stats.Difficulties = make(map[models.Difficulty]*models.DifficultyStats)
+	}
+	if stats.Airports == nil {
+		stats.Airports = make(map[string]*models.AirportStats)
+	}
+	difficulty, ok := stats.Difficulties[session.Difficulty]
+	if !ok {
+		difficulty = &models.DifficultyStats{}
+		stats.Difficulties[session.Difficulty] = difficulty
+	}
+
+	for _, round := range session.Rounds {
+		if round.PlayerGuess == "" || round.Score == nil {
+			continue
+		}
+		score := round.Score
+		stats.RoundsPlayed++
+		difficulty.RoundsPlayed++
+		stats.MatchTypes[score.MatchType]++
+		stats.TotalGuessTime += round.GuessTime
+		// Wrong guesses of unknown airports have no distance
+		if score.MatchType == "exact" || (score.CorrectAirport.IATA != "" && score.GuessedAirport.IATA != "") {
+			stats.TotalDistanceKm += score.DistanceKm
+			stats.DistanceRounds++
+		}
+
+		airportStats(stats, round.PlayerGuess).Guessed++
+		if score.MatchType == "exact" {
+			difficulty.ExactMatches++
+		} else if round.ActualArrival != "" && round.ActualArrival != "???" {
+			airportStats(stats, round.ActualArrival).Missed++
+		}
+
+		if score.MatchType == "exact" || score.MatchType == "family" {
+			stats.CurrentStreak++
+			stats.BestStreak = max(stats.BestStreak, stats.CurrentStreak)
+		} else {
+			stats.CurrentStreak = 0
+		}
+	}
+
+	stats.GamesPlayed++
+	stats.TotalScore += session.TotalScore
+	stats.BestScore = max(stats.BestScore, session.TotalScore)
+	stats.AvgScore = stats.TotalScore / stats.GamesPlayed
+	if stats.RoundsPlayed > 0 {
+		stats.AvgGuessTime = stats.TotalGuessTime / float64(stats.RoundsPlayed)
+	}
+	if stats.DistanceRounds > 0 {
+		stats.AvgDistanceKm = stats.TotalDistanceKm / float64(stats.DistanceRounds)
+	}
+	if session.EndedAt != nil && (stats.LastPlayedAt == nil || session.EndedAt.After(*stats.LastPlayedAt)) {
+		endedAt := *session.EndedAt
+		stats.LastPlayedAt = &endedAt
+	}
+
+	difficulty.GamesPlayed++
+	difficulty.TotalScore += session.TotalScore
+	difficulty.BestScore = max(difficulty.BestScore, session.TotalScore)
+	difficulty.AvgScore = difficulty.TotalScore / difficulty.GamesPlayed
+}
+
+func airportStats(stats *models.UserStats, iata string) *models.AirportStats {
+	airport, ok := stats.Airports[iata]
+	if !ok {
+		airport = &models.AirportStats{}
+		stats.Airports[iata] = airport
+	}
+	return airport
+}
@@ -0,0 +1,737 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/repository"
+)
+
+// maxTournamentStages bounds the stages a tournament is scheduled with
+const maxTournamentStages = 8
+
+var (
+	ErrTournamentNotFound    = errors.New("tournament not found")
+	ErrInvalidTournament     = errors.New("invalid tournament")
+	ErrRegistrationClosed    = errors.New("registration is closed")
+	ErrNotEligible           = errors.New("not eligible for the tournament")
+	ErrNotRegistered         = errors.New("not registered for the tournament")
+	ErrCheckInClosed         = errors.New("check-in is not open")
+	ErrNoStageOpen           = errors.New("no stage is being played")
+	ErrNotInStage            = errors.New("not a player in the current stage")
+	ErrStageAlreadyPlayed    = errors.New("current stage's game already played")
+	ErrTournamentNotFinished = errors.New("tournament is not finished")
+)
+
+var tournamentsCreated = expvar.NewInt("tournaments_created_total")
+
+// Clock tells the time. Tournaments run on it so their schedule can be
+// stepped through in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock is the wall clock
+var SystemClock Clock = systemClock{}
+
+// TournamentService runs tournaments. Players register, check in, then play
+// one game per stage on the stage's fixed flights. Stages move on by the
+// clock: a stage's players are seeded when it starts and scored when it
+// ends, by whichever request first sees the time has come. Games are scored
+// as they stand when their stage ends, and players who haven't started theirs
+// by then forfeit it.
+type TournamentService struct {
+	tournaments   repository.TournamentStore
+	users         repository.UserStore
+	sessions      repository.SessionStore
+	gameService   *GameService
+	flightService *FlightService
+	clock         Clock
+
+	mu sync.Mutex
+	// held are the flights each unfinished tournament keeps out of the public feed
+	held map[string][]string
+}
+
+func NewTournamentService(tournaments repository.TournamentStore, users repository.UserStore, sessions repository.SessionStore, gameService *GameService, flightService *FlightService, clock Clock) *TournamentService {
+	return &TournamentService{
+		tournaments:   tournaments,
+		users:         users,
+		sessions:      sessions,
+		gameService:   gameService,
+		flightService: flightService,
+		clock:         clock,
+		held:          make(map[string][]string),
+	}
+}
+
+// Load keeps the flights of every unfinished tournament in storage out of the
+// public feed
+func (s *TournamentService) Load(ctx context.Context) error {
+	for offset := 0; ; offset += historyPageSize {
+		page, err := s.tournaments.ListTournaments(ctx, offset, historyPageSize)
+		if err != nil {
+			return fmt.Errorf("failed to list tournaments: %w", err)
+		}
+		for i := range page {
+			s.hold(&page[i], s.clock.Now())
+		}
+		if len(page) < historyPageSize {
+			return nil
+		}
+	}
+}
+
+// CreateTournament schedules a tournament. Stages without flight IDs are
+// drawn flights, on routes no earlier stage uses.
+func (s *TournamentService) CreateTournament(ctx context.Context, req models.CreateTournamentRequest) (*models.TournamentView, error) {
+	now := s.clock.Now()
+	if err := validateTournament(req, now); err != nil {
+		return nil, err
+	}
+	organizer, err := s.users.GetUser(ctx, req.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+
+	tournament := &models.Tournament{
+		ID:                   uuid.New().String(),
+		Name:                 strings.TrimSpace(req.Name),
+		OrganizerID:          req.UserID,
+		Organizer:            organizer.Username,
+		Difficulty:           req.Difficulty,
+		RegistrationClosesAt: req.RegistrationClosesAt,
+		CheckInOpensAt:       req.CheckInOpensAt,
+		Eligible:             []string{},
+		Players:              []models.TournamentPlayer{},
+		CreatedAt:            now,
+	}
+	for _, username := range req.Eligible {
+		if username = strings.TrimSpace(username); username != "" && !slices.Contains(tournament.Eligible, username) {
+			tournament.Eligible = append(tournament.Eligible, username)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i, stageReq := range req.Stages {
+		flights, err := s.stageFlights(req.Difficulty, stageReq.FlightIDs, seen)
+		if err != nil {
+			return nil, fmt.Errorf("stage %d: %w", i+1, err)
+		}
+		stage := models.TournamentStage{
+			Name:        strings.TrimSpace(stageReq.Name),
+			StartsAt:    stageReq.StartsAt,
+			EndsAt:      stageReq.EndsAt,
+			Advancement: stageReq.Advancement,
+			Rounds:      make([]models.PresetRound, len(flights)),
+			Entries:     []models.StageEntry{},
+		}
+		for j, flight := range flights {
+			stage.Rounds[j] = models.PresetRound{
+				Flight:  flight,
+				Display: s.gameService.randomDisplayPosition(flight, req.Difficulty),
+			}
+			seen[routeID(flight.Departure.IATA, flight.Arrival.IATA, "")] = true
+		}
+		tournament.Stages = append(tournament.Stages, stage)
+	}
+
+	if err := s.tournaments.CreateTournament(ctx, tournament); err != nil {
+		return nil, err
+	}
+	tournamentsCreated.Add(1)
+	s.hold(tournament, now)
+	return tournamentView(tournament, now), nil
+}
+
+// validateTournament checks a tournament's schedule runs in order: check-in
+// and registration before the first stage, and each stage after the last
+func validateTournament(req models.CreateTournamentRequest, now time.Time) error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidTournament, fmt.Sprintf(format, args...))
+	}
+	switch req.Difficulty {
+	case models.DifficultyEasy, models.DifficultyMedium, models.DifficultyHard:
+	default:
+		return invalid("difficulty must be easy, medium or hard")
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return invalid("name is required")
+	}
+	if len(req.Stages) == 0 || len(req.Stages) > maxTournamentStages {
+		return invalid("a tournament has 1-%d stages", maxTournamentStages)
+	}
+	if !req.RegistrationClosesAt.After(now) {
+		return invalid("registration must close in the future")
+	}
+	first := req.Stages[0].StartsAt
+	if req.RegistrationClosesAt.After(first) || !req.CheckInOpensAt.Before(first) {
+		return invalid("registration must close and check-in open before the first stage starts")
+	}
+
+	for i, stage := range req.Stages {
+		if strings.TrimSpace(stage.Name) == "" {
+			return invalid("stage %d needs a name", i+1)
+		}
+		if !stage.EndsAt.After(stage.StartsAt) {
+			return invalid("stage %d must end after it starts", i+1)
+		}
+		if i > 0 && stage.StartsAt.Before(req.Stages[i-1].EndsAt) {
+			return invalid("stage %d must start after stage %d ends", i+1, i)
+		}
+		if len(stage.FlightIDs) != 0 && len(stage.FlightIDs) != TotalRounds {
+			return invalid("stage %d must have %d flights, or none to draw them", i+1, TotalRounds)
+		}
+
+		rule := stage.Advancement
+		switch {
+		case rule.Type == models.AdvanceTopN && rule.N >= 1:
+		case rule.Type == models.AdvanceTopN:
+			return invalid("stage %d must advance at least 1 player", i+1)
+		case rule.Type == models.AdvanceSingleElimination:
+		case rule.Type == "" && i == len(req.Stages)-1:
+			// Nobody goes through from the final stage
+		default:
+			return invalid("stage %d needs an advancement rule: %s or %s",
+				i+1, models.AdvanceTopN, models.AdvanceSingleElimination)
+		}
+	}
+	return nil
+}
+
+// stageFlights returns the flights with the given IDs, or draws a game's
+// worth leaving out the seen routes
+func (s *TournamentService) stageFlights(difficulty models.Difficulty, ids []string, seen map[string]bool) ([]models.Flight, error) {
+	if len(ids) == 0 {
+		return s.flightService.GetRandomFlights(difficulty, TotalRounds, s.gameService.selectionPolicy, seen)
+	}
+	flights := make([]models.Flight, 0, len(ids))
+	for _, id := range ids {
+		flight := s.flightService.GetFlightByID(id)
+		if flight == nil {
+			return nil, fmt.Errorf("%w: flight %s not found", ErrInvalidTournament, id)
+		}
+		for _, f := range flights {
+			if f.ID == flight.ID {
+				return nil, fmt.Errorf("%w: flight %s is listed twice", ErrInvalidTournament, id)
+			}
+		}
+		flights = append(flights, *flight)
+	}
+	return flights, nil
+}
+
+// GetTournament returns a tournament as it stands now
+func (s *TournamentService) GetTournament(ctx context.Context, id string) (*models.TournamentView, error) {
+	tournament, err := s.modify(ctx, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	return tournamentView(tournament, s.clock.Now()), nil
+}
+
+// ListTournaments returns a page of tournaments, newest first
+func (s *TournamentService) ListTournaments(ctx context.Context, limit, offset int) ([]models.TournamentView, error) {
+	tournaments, err := s.tournaments.ListTournaments(ctx, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	views := make([]models.TournamentView, len(tournaments))
+	for i := range tournaments {
+		views[i] = *tournamentView(&tournaments[i], now)
+	}
+	return views, nil
+}
+
+// Register signs a logged-in player up for a tournament. Registering again
+// changes nothing.
+func (s *TournamentService) Register(ctx context.Context, id, userID string) (*models.TournamentView, error) {
+	user, err := s.users.GetUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	tournament, err := s.modify(ctx, id, func(t *models.Tournament, now time.Time) error {
+		if playerIndex(t, userID) >= 0 {
+			return nil
+		}
+		if !now.Before(t.RegistrationClosesAt) {
+			return ErrRegistrationClosed
+		}
+		if len(t.Eligible) > 0 && !slices.Contains(t.Eligible, user.Username) {
+			return ErrNotEligible
+		}
+		t.Players = append(t.Players, models.TournamentPlayer{
+			UserID:       userID,
+			Username:     user.Username,
+			RegisteredAt: now,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tournamentView(tournament, s.clock.Now()), nil
+}
+
+// CheckIn confirms a registered player will play the first stage. Only
+// checked-in players are seeded into it.
+func (s *TournamentService) CheckIn(ctx context.Context, id, userID string) (*models.TournamentView, error) {
+	tournament, err := s.modify(ctx, id, func(t *models.Tournament, now time.Time) error {
+		i := playerIndex(t, userID)
+		if i < 0 {
+			return ErrNotRegistered
+		}
+		if now.Before(t.CheckInOpensAt) || !now.Before(t.Stages[0].StartsAt) {
+			return ErrCheckInClosed
+		}
+		if t.Players[i].CheckedInAt == nil {
+			t.Players[i].CheckedInAt = &now
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tournamentView(tournament, s.clock.Now()), nil
+}
+
+// Play starts a player's game in the stage being played. A player gets one
+// game per stage; if starting it failed they may try again.
+func (s *TournamentService) Play(ctx context.Context, id, userID string) (*models.StartGameResponse, error) {
+	var preset GamePreset
+	tournament, err := s.modify(ctx, id, func(t *models.Tournament, now time.Time) error {
+		stage := currentStage(t, now)
+		if stage < 0 {
+			return ErrNoStageOpen
+		}
+		entries := t.Stages[stage].Entries
+		i := slices.IndexFunc(entries, func(e models.StageEntry) bool { return e.UserID == userID })
+		if i < 0 {
+			return ErrNotInStage
+		}
+		if entries[i].SessionID != "" {
+			_, err := s.sessions.GetSession(ctx, entries[i].SessionID)
+			if err == nil {
+				return ErrStageAlreadyPlayed
+			}
+			if !errors.Is(err, repository.ErrNotFound) {
+				return err
+			}
+		} else {
+			entries[i].SessionID = uuid.New().String()
+		}
+		preset = GamePreset{
+			SessionID:    entries[i].SessionID,
+			TournamentID: t.ID,
+			Rounds:       t.Stages[stage].Rounds,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.gameService.StartPresetGame(ctx, models.StartGameRequest{
+		UserID:     userID,
+		Difficulty: tournament.Difficulty,
+	}, preset)
+}
+
+// GetStandings ranks every seeded stage's players. Stages still being
+// played are ranked by their games so far.
+func (s *TournamentService) GetStandings(ctx context.Context, id string) (*models.TournamentStandings, error) {
+	tournament, err := s.modify(ctx, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	standings := &models.TournamentStandings{
+		TournamentID: tournament.ID,
+		Status:       tournamentStatus(tournament, now),
+		Stages:       []models.StageStandings{},
+	}
+	for _, stage := range tournament.Stages {
+		if !stage.Seeded {
+			break
+		}
+		entries := stage.Entries
+		matches := stage.Matches
+		if !stage.Resolved {
+			if entries, err = s.scoreEntries(ctx, entries); err != nil {
+				return nil, err
+			}
+			rankEntries(entries, nil)
+		}
+		stageStandings := models.StageStandings{
+			Name:     stage.Name,
+			Resolved: stage.Resolved,
+			Entries:  make([]models.StandingEntry, len(entries)),
+			Matches:  matches,
+		}
+		for i, entry := range entries {
+			stageStandings.Entries[i] = models.StandingEntry{
+				Rank:         i + 1,
+				Username:     entry.Username,
+				Seed:         entry.Seed,
+				Score:        entry.Score,
+				RoundsPlayed: entry.RoundsPlayed,
+				Played:       entry.SessionID != "",
+				Advanced:     entry.Advanced,
+			}
+		}
+		standings.Stages = append(standings.Stages, stageStandings)
+	}
+	return standings, nil
+}
+
+// ExportResults places every player of a finished tournament: first by the
+// stage they reached, then by their rank in it
+func (s *TournamentService) ExportResults(ctx context.Context, id string) (*models.Tournament, []models.TournamentResult, error) {
+	tournament, err := s.modify(ctx, id, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tournamentStatus(tournament, s.clock.Now()) != models.TournamentFinished {
+		return nil, nil, ErrTournamentNotFinished
+	}
+
+	type placing struct {
+		result models.TournamentResult
+		stage  int
+	}
+	placings := make(map[string]*placing)
+	var order []string
+	for stage, st := range tournament.Stages {
+		for _, entry := range st.Entries {
+			p, ok := placings[entry.UserID]
+			if !ok {
+				p = &placing{result: models.TournamentResult{Username: entry.Username}}
+				placings[entry.UserID] = p
+				order = append(order, entry.UserID)
+			}
+			p.stage = stage
+			p.result.StageReached = st.Name
+			p.result.StageRank = entry.Rank
+			p.result.TotalScore += entry.Score
+			if entry.SessionID != "" {
+				p.result.StagesPlayed++
+			}
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := placings[order[i]], placings[order[j]]
+		if a.stage != b.stage {
+			return a.stage > b.stage
+		}
+		return a.result.StageRank < b.result.StageRank
+	})
+
+	results := make([]models.TournamentResult, len(order))
+	for i, userID := range order {
+		results[i] = placings[userID].result
+		results[i].Place = i + 1
+	}
+	return tournament, results, nil
+}
+
+// modify applies fn to a tournament brought up to date with the clock, and
+// saves it, retrying on concurrent updates. Without fn the tournament is only
+// saved if the clock moved it on.
+func (s *TournamentService) modify(ctx context.Context, id string, fn func(t *models.Tournament, now time.Time) error) (*models.Tournament, error) {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		tournament, err := s.tournaments.GetTournament(ctx, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrTournamentNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		now := s.clock.Now()
+		changed, err := s.advance(ctx, tournament, now)
+		if err != nil {
+			return nil, err
+		}
+		if fn != nil {
+			if err := fn(tournament, now); err != nil {
+				return nil, err
+			}
+			changed = true
+		}
+		if changed {
+			err = s.tournaments.UpdateTournament(ctx, tournament)
+			if errors.Is(err, repository.ErrVersionConflict) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		s.hold(tournament, now)
+		return tournament, nil
+	}
+	return nil, ErrConcurrentUpdate
+}
+
+// advance seeds the stages that have started and scores those that have
+// ended, in order, and reports whether anything changed
+func (s *TournamentService) advance(ctx context.Context, t *models.Tournament, now time.Time) (bool, error) {
+	changed := false
+	for i := range t.Stages {
+		stage := &t.Stages[i]
+		if !stage.Seeded {
+			if now.Before(stage.StartsAt) {
+				break
+			}
+			seedStage(t, i)
+			changed = true
+		}
+		if !stage.Resolved {
+			if now.Before(stage.EndsAt) {
+				break
+			}
+			if err := s.resolveStage(ctx, stage); err != nil {
+				return false, fmt.Errorf("failed to score stage %s: %w", stage.Name, err)
+			}
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// seedStage enters a stage's players: the checked-in players, in the order
+// they registered, for the first stage, and those who went through from the
+// stage before, in the order they ranked, for the rest
+func seedStage(t *models.Tournament, i int) {
+	stage := &t.Stages[i]
+	var players []models.StageEntry
+	if i == 0 {
+		for _, player := range t.Players {
+			if player.CheckedInAt != nil {
+				players = append(players, models.StageEntry{UserID: player.UserID, Username: player.Username})
+			}
+		}
+	} else {
+		for _, entry := range t.Stages[i-1].Entries {
+			if entry.Advanced {
+				players = append(players, models.StageEntry{UserID: entry.UserID, Username: entry.Username})
+			}
+		}
+	}
+	for j := range players {
+		players[j].Seed = j + 1
+	}
+	stage.Entries = players
+	if stage.Entries == nil {
+		stage.Entries = []models.StageEntry{}
+	}
+	if stage.Advancement.Type == models.AdvanceSingleElimination {
+		stage.Matches = bracket(stage.Entries)
+	}
+	stage.Seeded = true
+}
+
+// bracket pairs seeded players for single elimination, best seed against
+// worst. When the field isn't a power of two the top seeds get byes.
+func bracket(entries []models.StageEntry) []models.TournamentMatch {
+	matches := []models.TournamentMatch{}
+	if len(entries) == 0 {
+		return matches
+	}
+	size := 1
+	for size < len(entries) {
+		size *= 2
+	}
+	for i := 0; i < (size+1)/2; i++ {
+		match := models.TournamentMatch{Players: []string{entries[i].Username}}
+		if opponent := size - 1 - i; opponent < len(entries) && opponent != i {
+			match.Players = append(match.Players, entries[opponent].Username)
+		}
+		matches = append(matches, match)
+	}
+	return matches
+}
+
+// resolveStage scores a stage's games as they stand, ranks its players and
+// marks who goes through
+func (s *TournamentService) resolveStage(ctx context.Context, stage *models.TournamentStage) error {
+	entries, err := s.scoreEntries(ctx, stage.Entries)
+	if err != nil {
+		return err
+	}
+
+	winners := make(map[string]bool)
+	if stage.Advancement.Type == models.AdvanceSingleElimination {
+		byName := make(map[string]models.StageEntry, len(entries))
+		for _, entry := range entries {
+			byName[entry.Username] = entry
+		}
+		for i := range stage.Matches {
+			match := &stage.Matches[i]
+			var best *models.StageEntry
+			for _, username := range match.Players {
+				entry := byName[username]
+				if entry.SessionID != "" && (best == nil || beats(entry, *best)) {
+					best = &entry
+				}
+			}
+			if best != nil {
+				match.Winner = best.Username
+				winners[best.Username] = true
+			}
+		}
+	}
+
+	rankEntries(entries, winners)
+	for i := range entries {
+		entry := &entries[i]
+		entry.Rank = i + 1
+		switch stage.Advancement.Type {
+		case models.AdvanceTopN:
+			entry.Advanced = entry.SessionID != "" && entry.Rank <= stage.Advancement.N
+		case models.AdvanceSingleElimination:
+			entry.Advanced = winners[entry.Username]
+		}
+	}
+	stage.Entries = entries
+	stage.Resolved = true
+	return nil
+}
+
+// scoreEntries returns a copy of a stage's entries with their games' scores.
+// An entry whose game never started is left unplayed.
+func (s *TournamentService) scoreEntries(ctx context.Context, entries []models.StageEntry) ([]models.StageEntry, error) {
+	scored := append([]models.StageEntry{}, entries...)
+	for i := range scored {
+		entry := &scored[i]
+		if entry.SessionID == "" {
+			continue
+		}
+		session, err := s.sessions.GetSession(ctx, entry.SessionID)
+		if errors.Is(err, repository.ErrNotFound) {
+			entry.SessionID = ""
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entry.Score = session.TotalScore
+		entry.RoundsPlayed = roundsPlayed(session)
+	}
+	return scored, nil
+}
+
+// rankEntries orders a stage's entries: match winners first, then players
+// who played ahead of those who didn't, then by score, with ties going to the
+// better seed
+func rankEntries(entries []models.StageEntry, winners map[string]bool) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if winners[a.Username] != winners[b.Username] {
+			return winners[a.Username]
+		}
+		if (a.SessionID != "") != (b.SessionID != "") {
+			return a.SessionID != ""
+		}
+		return beats(a, b)
+	})
+}
+
+// beats reports whether entry a places above b on score, or seed on a tie
+func beats(a, b models.StageEntry) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.Seed < b.Seed
+}
+
+// hold keeps an unfinished tournament's flights out of the public feed, and
+// lets them back in once it's finished
+func (s *TournamentService) hold(t *models.Tournament, now time.Time) {
+	finished := tournamentStatus(t, now) == models.TournamentFinished
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, held := s.held[t.ID]
+	switch {
+	case !held && !finished:
+		for _, stage := range t.Stages {
+			for _, round := range stage.Rounds {
+				ids = append(ids, round.Flight.ID)
+			}
+		}
+		s.held[t.ID] = ids
+		s.flightService.MarkInPlay(ids...)
+	case held && finished:
+		delete(s.held, t.ID)
+		s.flightService.ReleaseFromPlay(ids...)
+	}
+}
+
+func playerIndex(t *models.Tournament, userID string) int {
+	return slices.IndexFunc(t.Players, func(p models.TournamentPlayer) bool { return p.UserID == userID })
+}
+
+// currentStage returns the index of the stage being played, or -1 between stages
+func currentStage(t *models.Tournament, now time.Time) int {
+	for i, stage := range t.Stages {
+		if !now.Before(stage.StartsAt) && now.Before(stage.EndsAt) {
+			return i
+		}
+	}
+	return -1
+}
+
+// tournamentStatus is where a tournament's schedule has got to
+func tournamentStatus(t *models.Tournament, now time.Time) models.TournamentStatus {
+	switch {
+	case !now.Before(t.Stages[len(t.Stages)-1].EndsAt):
+		return models.TournamentFinished
+	case !now.Before(t.Stages[0].StartsAt):
+		return models.TournamentRunning
+	case !now.Before(t.CheckInOpensAt):
+		return models.TournamentCheckIn
+	}
+	return models.TournamentRegistration
+}
+
+func tournamentView(t *models.Tournament, now time.Time) *models.TournamentView {
+	view := &models.TournamentView{
+		ID:                   t.ID,
+		Name:                 t.Name,
+		Organizer:            t.Organizer,
+		Difficulty:           t.Difficulty,
+		Status:               tournamentStatus(t, now),
+		RegistrationOpen:     now.Before(t.RegistrationClosesAt),
+		RegistrationClosesAt: t.RegistrationClosesAt,
+		CheckInOpensAt:       t.CheckInOpensAt,
+		Eligible:             t.Eligible,
+		Players:              make([]models.PlayerView, len(t.Players)),
+		Stages:               make([]models.StageView, len(t.Stages)),
+		CurrentStage:         currentStage(t, now) + 1,
+	}
+	for i, player := range t.Players {
+		view.Players[i] = models.PlayerView{Username: player.Username, CheckedIn: player.CheckedInAt != nil}
+	}
+	for i, stage := range t.Stages {
+		view.Stages[i] = models.StageView{
+			Name:        stage.Name,
+			StartsAt:    stage.StartsAt,
+			EndsAt:      stage.EndsAt,
+			Advancement: stage.Advancement,
+			Players:     len(stage.Entries),
+		}
+	}
+	return view
+}
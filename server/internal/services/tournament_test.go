@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/repository"
+	"github.com/skyquest/server/pkg/aviation"
+)
+
+// fakeClock is a clock the test moves by hand
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+type tournamentFixture struct {
+	store       *repository.MemoryStore
+	flights     *FlightService
+	scores      *ScoreService
+	games       *GameService
+	tournaments *TournamentService
+	clock       *fakeClock
+	users       map[string]string // username to user ID
+}
+
+func newTournamentFixture(t *testing.T, usernames ...string) *tournamentFixture {
+	t.Helper()
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	flights := NewFlightService(aviation.NewClient(""), nil, NewRouteStats())
+	feed := make([]models.Flight, 2*TotalRounds)
+	for i := range feed {
+		feed[i] = models.Flight{
+			ID:        fmt.Sprintf("flight-%d", i+1),
+			Departure: models.Airport{IATA: "LHR", Country: "GB", Latitude: 51.47, Longitude: -0.45},
+			Arrival:   models.Airport{IATA: fmt.Sprintf("A%02d", i), Country: "FR", Latitude: 49.0, Longitude: 2.55},
+		}
+	}
+	flights.updateFlights(feed)
+
+	scores := NewScoreService(store, store)
+	games := NewGameService(store, store, flights, scores, nil, nil, nil, nil, time.Hour,
+		CompletionPolicy{}, ProgressionPolicy{}, SelectionPolicy{})
+	clock := &fakeClock{now: time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)}
+	f := &tournamentFixture{
+		store:       store,
+		flights:     flights,
+		scores:      scores,
+		games:       games,
+		tournaments: NewTournamentService(store, store, store, games, flights, clock),
+		clock:       clock,
+		users:       make(map[string]string),
+	}
+	for _, username := range usernames {
+		user := &models.User{Username: username, CreatedAt: clock.now, Progression: models.Progression{Level: 1}}
+		if err := store.CreateUser(ctx, user); err != nil {
+			t.Fatalf("create user %s: %v", username, err)
+		}
+		f.users[username] = user.ID.Hex()
+	}
+	return f
+}
+
+// at moves the clock to an offset from the tournament's creation
+func (f *tournamentFixture) at(start time.Time, offset time.Duration) {
+	f.clock.now = start.Add(offset)
+}
+
+// play starts a player's stage game and finishes it with the given score
+func (f *tournamentFixture) play(t *testing.T, tournamentID, username string, score int) {
+	t.Helper()
+	ctx := context.Background()
+	userID := f.users[username]
+	started, err := f.tournaments.Play(ctx, tournamentID, userID)
+	if err != nil {
+		t.Fatalf("%s play: %v", username, err)
+	}
+	// Grade the first round by hand; the guess itself is covered elsewhere
+	session, err := f.store.GetSession(ctx, started.SessionID)
+	if err != nil {
+		t.Fatalf("load %s's game: %v", username, err)
+	}
+	session.Rounds[0].PlayerGuess = session.Rounds[0].ActualArrival
+	session.TotalScore = score
+	if err := f.store.UpdateSession(ctx, session); err != nil {
+		t.Fatalf("score %s's game: %v", username, err)
+	}
+	ended, err := f.games.EndGame(ctx, models.EndGameRequest{SessionID: started.SessionID, UserID: userID})
+	if err != nil {
+		t.Fatalf("%s end game: %v", username, err)
+	}
+	if ended.Recorded {
+		t.Errorf("%s's tournament game was recorded on the leaderboard", username)
+	}
+}
+
+func stageIDs(from, to int) []string {
+	ids := make([]string, 0, to-from+1)
+	for i := from; i <= to; i++ {
+		ids = append(ids, fmt.Sprintf("flight-%d", i))
+	}
+	return ids
+}
+
+func TestTournamentSchedule(t *testing.T) {
+	ctx := context.Background()
+	f := newTournamentFixture(t, "organizer", "ada", "bob", "cy", "dee", "eve")
+	start := f.clock.now
+
+	created, err := f.tournaments.CreateTournament(ctx, models.CreateTournamentRequest{
+		Name:                 "Spring Cup",
+		Difficulty:           models.DifficultyHard,
+		RegistrationClosesAt: start.Add(time.Hour),
+		CheckInOpensAt:       start.Add(30 * time.Minute),
+		Stages: []models.CreateStageRequest{
+			{
+				Name:        "Heats",
+				StartsAt:    start.Add(2 * time.Hour),
+				EndsAt:      start.Add(3 * time.Hour),
+				FlightIDs:   stageIDs(1, TotalRounds),
+				Advancement: models.AdvancementRule{Type: models.AdvanceTopN, N: 2},
+			},
+			{
+				Name:      "Final",
+				StartsAt:  start.Add(4 * time.Hour),
+				EndsAt:    start.Add(5 * time.Hour),
+				FlightIDs: stageIDs(TotalRounds+1, 2*TotalRounds),
+			},
+		},
+		UserID: f.users["organizer"],
+	})
+	if err != nil {
+		t.Fatalf("create tournament: %v", err)
+	}
+	id := created.ID
+	if created.Status != models.TournamentRegistration {
+		t.Fatalf("status %s after creation, want %s", created.Status, models.TournamentRegistration)
+	}
+	if !f.flights.isInPlay("flight-1") || !f.flights.isInPlay("flight-20") {
+		t.Fatal("stage flights are not held out of the public feed")
+	}
+
+	// Registration
+	for _, username := range []string{"ada", "bob", "cy", "dee"} {
+		if _, err := f.tournaments.Register(ctx, id, f.users[username]); err != nil {
+			t.Fatalf("register %s: %v", username, err)
+		}
+	}
+	if _, err := f.tournaments.CheckIn(ctx, id, f.users["ada"]); !errors.Is(err, ErrCheckInClosed) {
+		t.Fatalf("check-in before it opens: got %v, want ErrCheckInClosed", err)
+	}
+
+	// Check-in; registration closes while it's open
+	f.at(start, 45*time.Minute)
+	for _, username := range []string{"ada", "bob", "cy"} {
+		if _, err := f.tournaments.CheckIn(ctx, id, f.users[username]); err != nil {
+			t.Fatalf("check in %s: %v", username, err)
+		}
+	}
+	if _, err := f.tournaments.CheckIn(ctx, id, f.users["eve"]); !errors.Is(err, ErrNotRegistered) {
+		t.Fatalf("check-in without registering: got %v, want ErrNotRegistered", err)
+	}
+	f.at(start, time.Hour)
+	if _, err := f.tournaments.Register(ctx, id, f.users["eve"]); !errors.Is(err, ErrRegistrationClosed) {
+		t.Fatalf("late registration: got %v, want ErrRegistrationClosed", err)
+	}
+	view, err := f.tournaments.GetTournament(ctx, id)
+	if err != nil {
+		t.Fatalf("get tournament: %v", err)
+	}
+	if view.Status != models.TournamentCheckIn {
+		t.Fatalf("status %s during check-in, want %s", view.Status, models.TournamentCheckIn)
+	}
+	if _, err := f.tournaments.Play(ctx, id, f.users["ada"]); !errors.Is(err, ErrNoStageOpen) {
+		t.Fatalf("play before the first stage: got %v, want ErrNoStageOpen", err)
+	}
+
+	// The first stage seeds only the checked-in players
+	f.at(start, 2*time.Hour)
+	view, err = f.tournaments.GetTournament(ctx, id)
+	if err != nil {
+		t.Fatalf("get tournament: %v", err)
+	}
+	if view.Status != models.TournamentRunning || view.CurrentStage != 1 || view.Stages[0].Players != 3 {
+		t.Fatalf("first stage: status %s, stage %d, %d players; want running, 1, 3",
+			view.Status, view.CurrentStage, view.Stages[0].Players)
+	}
+	if _, err := f.tournaments.Play(ctx, id, f.users["dee"]); !errors.Is(err, ErrNotInStage) {
+		t.Fatalf("play without checking in: got %v, want ErrNotInStage", err)
+	}
+	f.play(t, id, "ada", 500)
+	f.play(t, id, "bob", 700)
+	if _, err := f.tournaments.Play(ctx, id, f.users["ada"]); !errors.Is(err, ErrStageAlreadyPlayed) {
+		t.Fatalf("second game in a stage: got %v, want ErrStageAlreadyPlayed", err)
+	}
+
+	// Once it ends, the top two who played go through; cy never started
+	f.at(start, 3*time.Hour)
+	standings, err := f.tournaments.GetStandings(ctx, id)
+	if err != nil {
+		t.Fatalf("get standings: %v", err)
+	}
+	heats := standings.Stages[0]
+	if !heats.Resolved {
+		t.Fatal("first stage is not scored after it ended")
+	}
+	wantHeats := []models.StandingEntry{
+		{Rank: 1, Username: "bob", Score: 700, Advanced: true},
+		{Rank: 2, Username: "ada", Score: 500, Advanced: true},
+		{Rank: 3, Username: "cy", Score: 0, Advanced: false},
+	}
+	for i, want := range wantHeats {
+		got := heats.Entries[i]
+		if got.Rank != want.Rank || got.Username != want.Username || got.Score != want.Score || got.Advanced != want.Advanced {
+			t.Errorf("heats place %d: got %+v, want %+v", i+1, got, want)
+		}
+	}
+
+	// The final seeds the players who went through, in the order they ranked
+	f.at(start, 4*time.Hour)
+	if _, err := f.tournaments.Play(ctx, id, f.users["cy"]); !errors.Is(err, ErrNotInStage) {
+		t.Fatalf("eliminated player plays the final: got %v, want ErrNotInStage", err)
+	}
+	f.play(t, id, "ada", 900)
+	f.play(t, id, "bob", 600)
+
+	if _, _, err := f.tournaments.ExportResults(ctx, id); !errors.Is(err, ErrTournamentNotFinished) {
+		t.Fatalf("results before the end: got %v, want ErrTournamentNotFinished", err)
+	}
+
+	// Finished: the final is scored and its flights go back to the public feed
+	f.at(start, 5*time.Hour)
+	_, results, err := f.tournaments.ExportResults(ctx, id)
+	if err != nil {
+		t.Fatalf("export results: %v", err)
+	}
+	if len(results) != 3 || results[0].Username != "ada" || results[1].Username != "bob" || results[2].Username != "cy" {
+		t.Fatalf("final places %+v, want ada, bob, cy", results)
+	}
+	if results[0].TotalScore != 1400 || results[0].StagesPlayed != 2 {
+		t.Errorf("winner's total %d over %d stages, want 1400 over 2", results[0].TotalScore, results[0].StagesPlayed)
+	}
+	if f.flights.isInPlay("flight-1") || f.flights.isInPlay("flight-20") {
+		t.Error("stage flights are still held after the tournament finished")
+	}
+
+	// Tournament games never reach the leaderboard
+	for _, username := range []string{"ada", "bob"} {
+		if _, err := f.scores.GetUserRank(ctx, username, models.DifficultyHard); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("%s is on the leaderboard after tournament games: %v", username, err)
+		}
+	}
+}
+
+func TestTournamentLoadHoldsFlights(t *testing.T) {
+	ctx := context.Background()
+	f := newTournamentFixture(t, "organizer")
+	start := f.clock.now
+	_, err := f.tournaments.CreateTournament(ctx, models.CreateTournamentRequest{
+		Name:                 "Night Cup",
+		Difficulty:           models.DifficultyHard,
+		RegistrationClosesAt: start.Add(time.Hour),
+		CheckInOpensAt:       start.Add(30 * time.Minute),
+		Stages: []models.CreateStageRequest{{
+			Name:      "Final",
+			StartsAt:  start.Add(2 * time.Hour),
+			EndsAt:    start.Add(3 * time.Hour),
+			FlightIDs: stageIDs(1, TotalRounds),
+		}},
+		UserID: f.users["organizer"],
+	})
+	if err != nil {
+		t.Fatalf("create tournament: %v", err)
+	}
+
+	// A restarted server holds the flights of unfinished tournaments again...
+	restarted := NewTournamentService(f.store, f.store, f.store, f.games, NewFlightService(aviation.NewClient(""), nil, NewRouteStats()), f.clock)
+	if err := restarted.Load(ctx); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !restarted.flightService.isInPlay("flight-1") {
+		t.Fatal("unfinished tournament's flights are not held after loading")
+	}
+
+	// ...but not those of finished ones
+	f.at(start, 3*time.Hour)
+	restarted = NewTournamentService(f.store, f.store, f.store, f.games, NewFlightService(aviation.NewClient(""), nil, NewRouteStats()), f.clock)
+	if err := restarted.Load(ctx); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if restarted.flightService.isInPlay("flight-1") {
+		t.Fatal("finished tournament's flights are held after loading")
+	}
+}
+
+func TestBracket(t *testing.T) {
+	entries := make([]models.StageEntry, 5)
+	for i := range entries {
+		entries[i] = models.StageEntry{Username: fmt.Sprintf("p%d", i+1), Seed: i + 1}
+	}
+	// Five players fill a bracket of eight: the top three seeds get byes
+	want := [][]string{{"p1"}, {"p2"}, {"p3"}, {"p4", "p5"}}
+	matches := bracket(entries)
+	if len(matches) != len(want) {
+		t.Fatalf("got %d matches, want %d", len(matches), len(want))
+	}
+	for i, match := range matches {
+		if fmt.Sprint(match.Players) != fmt.Sprint(want[i]) {
+			t.Errorf("match %d: got %v, want %v", i+1, match.Players, want[i])
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/skyquest/server/internal/models"
+	"github.com/skyquest/server/internal/repository"
+)
+
+var (
+	ErrInvalidCountry  = errors.New("country must be a two-letter ISO 3166-1 code")
+	ErrInvalidAirport  = errors.New("airport must be the IATA code of a known airport")
+	ErrNotAccountOwner = errors.New("only the account's owner can change it")
+	ErrNotGuestPlayer  = errors.New("a guest's home can only be set with a game they played")
+)
+
+type UserService struct {
+	users         repository.UserStore
+	scores        repository.LeaderboardStore
+	sessions      repository.SessionStore
+	flightService *FlightService
+}
+
+func NewUserService(users repository.UserStore, scores repository.LeaderboardStore, sessions repository.SessionStore, flightService *FlightService) *UserService {
+	return &UserService{
+		users:         users,
+		scores:        scores,
+		sessions:      sessions,
+		flightService: flightService,
+	}
+}
+
+// SetHome sets the country and airport a player competes for, creating a guest
+// profile if the username is unknown, and moves the player's existing scores
+// to the new home's leaderboards. Registered players' homes can only be set
+// by the player, identified by actorID. A guest proves they're the player with
+// the session ID of a game they played under the username.
+func (s *UserService) SetHome(ctx context.Context, actorID, username string, req models.SetHomeRequest) (*models.User, error) {
+	country := strings.ToUpper(strings.TrimSpace(req.Country))
+	if country != "" && !isLetters(country, 2) {
+		return nil, ErrInvalidCountry
+	}
+	airport := strings.ToUpper(strings.TrimSpace(req.Airport))
+	if airport != "" {
+		if _, ok := s.flightService.GetAirport(airport); !ok {
+			return nil, ErrInvalidAirport
+		}
+	}
+
+	user, err := s.users.GetUserByUsername(ctx, username)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if user != nil && user.Registered() {
+		if user.ID.Hex() != actorID {
+			return nil, ErrNotAccountOwner
+		}
+	} else {
+		if err := s.checkGuestPlayer(ctx, username, req.SessionID); err != nil {
+			return nil, err
+		}
+		if user, err = findOrCreateUser(ctx, s.users, username); err != nil {
+			return nil, err
+		}
+		if user.Registered() {
+			// Registered since it was read
+			return nil, ErrNotAccountOwner
+		}
+	}
+	user.HomeCountry = country
+	user.HomeAirport = airport
+	if err := s.users.UpdateUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	if err := s.scores.UpdatePlayerHome(ctx, username, country, airport); err != nil {
+		return nil, fmt.Errorf("failed to update leaderboard entries: %w", err)
+	}
+	return user, nil
+}
+
+// checkGuestPlayer checks that a guest game was played under a username
+func (s *UserService) checkGuestPlayer(ctx context.Context, username, sessionID string) error {
+	if sessionID == "" {
+		return ErrNotGuestPlayer
+	}
+	session, err := s.sessions.GetSession(ctx, sessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrNotGuestPlayer
+	}
+	if err != nil {
+		return err
+	}
+	if session.UserID != "" || session.Username != username {
+		return ErrNotGuestPlayer
+	}
+	return nil
+}
+
+// findOrCreateUser returns the user with a username, creating a guest profile if needed
+func findOrCreateUser(ctx context.Context, users repository.UserStore, username string) (*models.User, error) {
+	user, err := users.GetUserByUsername(ctx, username)
+	if !errors.Is(err, repository.ErrNotFound) {
+		return user, err
+	}
+
+	user = &models.User{
+		Username:    username,
+		CreatedAt:   time.Now(),
+		Progression: models.Progression{Level: 1},
+	}
+	err = users.CreateUser(ctx, user)
+	if errors.Is(err, repository.ErrDuplicate) {
+		// Registered concurrently
+		return users.GetUserByUsername(ctx, username)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// isLetters reports whether s is n ASCII capital letters
+func isLetters(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"time"
+
+	"github.com/skyquest/server/internal/models"
+)
+
+// CalendarWindows are the windows archived when their period ends
+var CalendarWindows = []models.LeaderboardWindow{models.WindowDay, models.WindowWeek, models.WindowMonth}
+
+// rollingWindows maps rolling windows to their length
+var rollingWindows = map[models.LeaderboardWindow]time.Duration{
+	models.Window24Hours: 24 * time.Hour,
+	models.Window7Days:   7 * 24 * time.Hour,
+	models.Window30Days:  30 * 24 * time.Hour,
+}
+
+// ValidWindow reports whether window names a leaderboard window
+func ValidWindow(window models.LeaderboardWindow) bool {
+	if window == models.WindowAllTime {
+		return true
+	}
+	if _, ok := rollingWindows[window]; ok {
+		return true
+	}
+	for _, w := range CalendarWindows {
+		if w == window {
+			return true
+		}
+	}
+	return false
+}
+
+// windowBounds returns the [since, until) range a window covers at now: the
+// current calendar period, or the rolling period ending now
+func windowBounds(window models.LeaderboardWindow, now time.Time) (since, until time.Time) {
+	if length, ok := rollingWindows[window]; ok {
+		return now.Add(-length), now
+	}
+	start := periodStart(window, now)
+	return start, nextPeriod(window, start)
+}
+
+// previousPeriod returns the calendar period that ended most recently before now
+func previousPeriod(window models.LeaderboardWindow, now time.Time) (start, end time.Time) {
+	end = periodStart(window, now)
+	return periodStart(window, end.Add(-time.Nanosecond)), end
+}
+
+// periodStart returns the start of the UTC calendar period containing t
+func periodStart(window models.LeaderboardWindow, t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch window {
+	case models.WindowWeek:
+		// Weeks start on Monday
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case models.WindowMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// nextPeriod returns the start of the calendar period after the one starting at start
+func nextPeriod(window models.LeaderboardWindow, start time.Time) time.Time {
+	switch window {
+	case models.WindowWeek:
+		return start.AddDate(0, 0, 7)
+	case models.WindowMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
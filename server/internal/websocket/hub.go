@@ -3,18 +3,27 @@ package websocket
 import (
 	"encoding/json"
 	"log"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/skyquest/server/internal/models"
 )
 
+// Identity is who a client plays as: the session of a solo game, or a
+// player in a multiplayer room
+type Identity struct {
+	Player string // session ID of a solo game, or player ID in a room
+	Room   string // lobby code; empty for solo games
+}
+
 // Client represents a WebSocket client connection
 type Client struct {
 	hub      *Hub
 	conn     *websocket.Conn
 	send     chan []byte
-	sessionID string
+	identity Identity // guarded by the hub's mutex
 }
 
 // Hub maintains the set of active clients and broadcasts messages
@@ -24,6 +33,18 @@ type Hub struct {
 	register   chan *Client
 	unregister chan *Client
 	mutex      sync.RWMutex
+	// rooms holds the clients of each multiplayer room by lobby code
+	rooms map[string]map[*Client]bool
+	// onRegister is called when a client asks to play a session, with the
+	// login token it sent if any. It returns the session's state, or an error
+	// if the client may not play it.
+	onRegister func(sessionID, token string) (*models.GameStateResponse, error)
+	// onRoomMessage is called with "room:" messages from clients, and
+	// onRoomLeave when a room's client disconnects
+	onRoomMessage func(client *Client, msg models.WSMessage)
+	onRoomLeave   func(identity Identity)
+	// onSpectate is called with "spectate:" messages from clients
+	onSpectate func(client *Client, msg models.WSMessage)
 }
 
 // NewHub creates a new Hub instance
@@ -33,6 +54,7 @@ func NewHub() *Hub {
 		broadcast:  make(chan []byte, 256),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		rooms:      make(map[string]map[*Client]bool),
 	}
 }
 
@@ -43,31 +65,173 @@ func (h *Hub) Run() {
 		case client := <-h.register:
 			h.mutex.Lock()
 			h.clients[client] = true
+			// A session asked for when connecting is only played once checked
+			requested := client.identity
+			client.identity = Identity{}
 			h.mutex.Unlock()
 			log.Printf("Client connected. Total clients: %d", len(h.clients))
+			if requested.Room == "" && requested.Player != "" {
+				// Don't block the hub loop on the callback
+				go h.registerSession(client, requested.Player, "")
+			}
 
 		case client := <-h.unregister:
 			h.mutex.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-			}
+			h.dropLocked(client)
 			h.mutex.Unlock()
 			log.Printf("Client disconnected. Total clients: %d", len(h.clients))
 
 		case message := <-h.broadcast:
-			h.mutex.RLock()
+			h.mutex.Lock()
 			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-				}
+				h.deliverLocked(client, message)
 			}
-			h.mutex.RUnlock()
+			h.mutex.Unlock()
+		}
+	}
+}
+
+// OnRegister sets the callback checking that a client may play a session it
+// registers for and returning the session's state. Without it clients can't
+// register. It must be set before Run is started.
+func (h *Hub) OnRegister(fn func(sessionID, token string) (*models.GameStateResponse, error)) {
+	h.onRegister = fn
+}
+
+// OnRoomMessage sets the callbacks handling room messages from clients and
+// room clients disconnecting. They must be set before Run is started.
+func (h *Hub) OnRoomMessage(onMessage func(client *Client, msg models.WSMessage), onLeave func(identity Identity)) {
+	h.onRoomMessage = onMessage
+	h.onRoomLeave = onLeave
+}
+
+// OnSpectate sets the callback handling spectate messages from clients. It
+// must be set before Run is started.
+func (h *Hub) OnSpectate(fn func(client *Client, msg models.WSMessage)) {
+	h.onSpectate = fn
+}
+
+// JoinRoom makes a client a player in a room, leaving any room it was in.
+// Spectators join with no player. Clients that have disconnected are ignored.
+func (h *Hub) JoinRoom(client *Client, room, player string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if !h.clients[client] {
+		return
+	}
+	h.leaveRoomLocked(client)
+	client.identity = Identity{Player: player, Room: room}
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[*Client]bool)
+	}
+	h.rooms[room][client] = true
+}
+
+// SendToRoom sends a message to every client in a room
+func (h *Hub) SendToRoom(room string, msg models.WSMessage) {
+	h.sendToRoom(room, "", msg)
+}
+
+// SendToRoomPlayer sends a message to a player's clients in a room
+func (h *Hub) SendToRoomPlayer(room, player string, msg models.WSMessage) {
+	h.sendToRoom(room, player, msg)
+}
+
+func (h *Hub) sendToRoom(room, player string, msg models.WSMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error marshaling room message: %v", err)
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for client := range h.rooms[room] {
+		if player == "" || client.identity.Player == player {
+			h.deliverLocked(client, data)
+		}
+	}
+}
+
+// Send sends a message to one client
+func (h *Hub) Send(client *Client, msg models.WSMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.deliverLocked(client, data)
+}
+
+// deliverLocked queues a message for a client, dropping clients that can't
+// keep up. Clients that have disconnected are skipped.
+func (h *Hub) deliverLocked(client *Client, data []byte) {
+	if !h.clients[client] {
+		return
+	}
+	select {
+	case client.send <- data:
+	default:
+		h.dropLocked(client)
+	}
+}
+
+// dropLocked removes a client from the hub and its room and closes its
+// channel. Dropping a client that's already gone does nothing.
+func (h *Hub) dropLocked(client *Client) {
+	if !h.clients[client] {
+		return
+	}
+	h.leaveRoomLocked(client)
+	delete(h.clients, client)
+	close(client.send)
+	if client.identity.Room != "" && h.onRoomLeave != nil {
+		// Don't block the hub on the callback, which may send to the room
+		go h.onRoomLeave(client.identity)
+	}
+}
+
+// InRoom reports whether a player has a client connected to a room
+func (h *Hub) InRoom(room, player string) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for client := range h.rooms[room] {
+		if client.identity.Player == player {
+			return true
 		}
 	}
+	return false
+}
+
+func (h *Hub) leaveRoomLocked(client *Client) {
+	room := client.identity.Room
+	if room == "" {
+		return
+	}
+	delete(h.rooms[room], client)
+	if len(h.rooms[room]) == 0 {
+		delete(h.rooms, room)
+	}
+}
+
+// registerSession makes a client the player of a solo game if onRegister lets
+// it play the game, and sends it the game's state
+func (h *Hub) registerSession(client *Client, sessionID, token string) {
+	if h.onRegister == nil {
+		return
+	}
+	state, err := h.onRegister(sessionID, token)
+	if err != nil {
+		return
+	}
+	client.SetSessionID(sessionID)
+	h.Send(client, models.WSMessage{
+		Type:    "game:state",
+		Payload: models.WSGameState{State: state},
+	})
 }
 
 // Register adds a client to the hub
@@ -104,17 +268,12 @@ func (h *Hub) SendToClient(sessionID string, msg models.WSMessage) {
 		return
 	}
 
-	h.mutex.RLock()
-	defer h.mutex.RUnlock()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
 
 	for client := range h.clients {
-		if client.sessionID == sessionID {
-			select {
-			case client.send <- data:
-			default:
-				close(client.send)
-				delete(h.clients, client)
-			}
+		if client.identity.Room == "" && client.identity.Player == sessionID {
+			h.deliverLocked(client, data)
 			break
 		}
 	}
@@ -157,13 +316,40 @@ func (h *Hub) SendGameEnd(sessionID string, totalScore int, rank int) {
 	})
 }
 
-// NewClient creates a new client
-func NewClient(hub *Hub, conn *websocket.Conn, sessionID string) *Client {
+// SendGameExpired notifies a client that their idle game was abandoned
+func (h *Hub) SendGameExpired(sessionID string, totalScore int, roundsPlayed int) {
+	h.SendToClient(sessionID, models.WSMessage{
+		Type: "game:expired",
+		Payload: models.WSGameExpired{
+			SessionID:    sessionID,
+			TotalScore:   totalScore,
+			RoundsPlayed: roundsPlayed,
+		},
+	})
+}
+
+// SendAchievementUnlocked announces an achievement a player unlocked in a game
+func (h *Hub) SendAchievementUnlocked(sessionID string, achievement models.Achievement, unlockedAt time.Time) {
+	h.SendToClient(sessionID, models.WSMessage{
+		Type: "achievement:unlocked",
+		Payload: models.WSAchievementUnlocked{
+			SessionID:   sessionID,
+			ID:          achievement.ID,
+			Name:        achievement.Name,
+			Description: achievement.Description,
+			UnlockedAt:  unlockedAt,
+		},
+	})
+}
+
+// NewClient creates a new client. The identity's session, if any, is the solo
+// game the client asks to play; it's registered only once checked.
+func NewClient(hub *Hub, conn *websocket.Conn, identity Identity) *Client {
 	return &Client{
-		hub:       hub,
-		conn:      conn,
-		send:      make(chan []byte, 256),
-		sessionID: sessionID,
+		hub:      hub,
+		conn:     conn,
+		send:     make(chan []byte, 256),
+		identity: identity,
 	}
 }
 
@@ -177,9 +363,19 @@ func (c *Client) GetSendChannel() chan []byte {
 	return c.send
 }
 
-// SetSessionID sets the session ID for the client
+// SetSessionID makes the client the player of a solo game, leaving any room
 func (c *Client) SetSessionID(sessionID string) {
-	c.sessionID = sessionID
+	c.hub.mutex.Lock()
+	defer c.hub.mutex.Unlock()
+	c.hub.leaveRoomLocked(c)
+	c.identity = Identity{Player: sessionID}
+}
+
+// Identity returns who the client plays as
+func (c *Client) Identity() Identity {
+	c.hub.mutex.RLock()
+	defer c.hub.mutex.RUnlock()
+	return c.identity
 }
 
 // ReadPump pumps messages from the WebSocket connection to the hub
@@ -204,13 +400,19 @@ func (c *Client) ReadPump() {
 			continue
 		}
 
-		switch msg.Type {
-		case "register":
+		switch {
+		case msg.Type == "register":
 			if payload, ok := msg.Payload.(map[string]interface{}); ok {
 				if sessionID, ok := payload["sessionId"].(string); ok {
-					c.sessionID = sessionID
+					// A logged-in player's games need their token
+					token, _ := payload["token"].(string)
+					c.hub.registerSession(c, sessionID, token)
 				}
 			}
+		case strings.HasPrefix(msg.Type, "room:") && c.hub.onRoomMessage != nil:
+			c.hub.onRoomMessage(c, msg)
+		case strings.HasPrefix(msg.Type, "spectate:") && c.hub.onSpectate != nil:
+			c.hub.onSpectate(c, msg)
 		}
 	}
 }
@@ -0,0 +1,66 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/skyquest/server/internal/models"
+)
+
+func TestRegisterSessionChecked(t *testing.T) {
+	hub := NewHub()
+	checked := make(chan [2]string, 2)
+	hub.OnRegister(func(sessionID, token string) (*models.GameStateResponse, error) {
+		checked <- [2]string{sessionID, token}
+		if sessionID != "mine" {
+			return nil, errors.New("game belongs to another player")
+		}
+		return &models.GameStateResponse{SessionID: sessionID}, nil
+	})
+	go hub.Run()
+
+	// A session asked for when connecting is checked as a guest's
+	theirs := NewClient(hub, nil, Identity{Player: "theirs"})
+	hub.Register(theirs)
+	if got := <-checked; got != [2]string{"theirs", ""} {
+		t.Fatalf("checked %v, want session theirs without a token", got)
+	}
+	// Wait for the hub to finish with the client
+	hub.Register(NewClient(hub, nil, Identity{}))
+	if identity := theirs.Identity(); identity.Player != "" {
+		t.Errorf("client registered for a game it may not play: %+v", identity)
+	}
+	hub.SendToClient("theirs", models.WSMessage{Type: "round:start"})
+	select {
+	case data := <-theirs.send:
+		t.Errorf("client of a game it may not play was sent %s", data)
+	default:
+	}
+
+	// A session the client may play is registered, with its state sent
+	mine := NewClient(hub, nil, Identity{})
+	hub.Register(mine)
+	hub.registerSession(mine, "mine", "token")
+	if got := <-checked; got != [2]string{"mine", "token"} {
+		t.Fatalf("checked %v, want session mine with its token", got)
+	}
+	if identity := mine.Identity(); identity.Player != "mine" {
+		t.Errorf("client not registered for its game: %+v", identity)
+	}
+	select {
+	case data := <-mine.send:
+		var msg struct {
+			Type    string `json:"type"`
+			Payload struct {
+				State models.GameStateResponse `json:"state"`
+			} `json:"payload"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Type != "game:state" || msg.Payload.State.SessionID != "mine" {
+			t.Errorf("client got %s, want its game's state", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("client wasn't sent its game's state")
+	}
+}